@@ -0,0 +1,257 @@
+package casper
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gogap/errors"
+	"github.com/gogap/logs"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+const (
+	CTX_ASYNC_ID = "CTX_ASYNC_ID"
+)
+
+const (
+	ASYNC_STATUS_PENDING = "pending"
+	ASYNC_STATUS_DONE    = "done"
+	ASYNC_STATUS_TIMEOUT = "timeout"
+)
+
+const (
+	DefaultAsyncResultTTL = 10 * time.Minute
+
+	asyncSweepInterval = time.Minute
+)
+
+var asyncResultStore AsyncResultStore = NewMemoryAsyncResultStore()
+
+// where the final result of an async invocation goes, both are optional
+type AsyncCallback struct {
+	Webhook string `json:"webhook"` // the result is posted as json
+	Graph   string `json:"graph"`   // the result is the payload result of the graph
+}
+
+type AsyncResult struct {
+	Id         string      `json:"id"`
+	Api        string      `json:"api"`
+	Status     string      `json:"status"`
+	Code       uint64      `json:"code"`
+	Message    string      `json:"message"`
+	Result     interface{} `json:"result"`
+	CreatedAt  time.Time   `json:"created_at"`
+	FinishedAt time.Time   `json:"finished_at,omitempty"`
+}
+
+type AsyncResultStore interface {
+	Put(result *AsyncResult, ttl time.Duration) error
+	Get(id string) (result *AsyncResult, exist bool, err error)
+}
+
+func SetAsyncResultStore(store AsyncResultStore) {
+	if store == nil {
+		panic("could not set a nil AsyncResultStore")
+	}
+
+	asyncResultStore = store
+}
+
+type memoryAsyncResult struct {
+	result    AsyncResult
+	expiredAt time.Time
+}
+
+type MemoryAsyncResultStore struct {
+	locker    sync.RWMutex
+	results   map[string]*memoryAsyncResult
+	lastSweep time.Time
+}
+
+func NewMemoryAsyncResultStore() *MemoryAsyncResultStore {
+	return &MemoryAsyncResultStore{
+		results:   make(map[string]*memoryAsyncResult),
+		lastSweep: time.Now()}
+}
+
+func (p *MemoryAsyncResultStore) Put(result *AsyncResult, ttl time.Duration) error {
+	now := time.Now()
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.results[result.Id] = &memoryAsyncResult{result: *result, expiredAt: now.Add(ttl)}
+
+	if now.Sub(p.lastSweep) > asyncSweepInterval {
+		for id, item := range p.results {
+			if now.After(item.expiredAt) {
+				delete(p.results, id)
+			}
+		}
+		p.lastSweep = now
+	}
+
+	return nil
+}
+
+func (p *MemoryAsyncResultStore) Get(id string) (result *AsyncResult, exist bool, err error) {
+	p.locker.RLock()
+	defer p.locker.RUnlock()
+
+	if item, ok := p.results[id]; ok && time.Now().Before(item.expiredAt) {
+		r := item.result
+		return &r, true, nil
+	}
+	return
+}
+
+// AsyncInvoker sends the message to the graph and returns without waiting,
+// the final result is kept in the result store and sent to the callback
+type AsyncInvoker struct {
+	messenger Messenger
+	timeout   time.Duration
+	ttl       time.Duration
+	client    *http.Client
+}
+
+func NewAsyncInvoker(messenger Messenger, timeout, ttl time.Duration) *AsyncInvoker {
+	if timeout <= 0 {
+		timeout = REQ_TIMEOUT
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultAsyncResultTTL
+	}
+
+	return &AsyncInvoker{
+		messenger: messenger,
+		timeout:   timeout,
+		ttl:       ttl,
+		client: &http.Client{
+			Timeout: REQ_TIMEOUT,
+			// the webhooks are checked, the urls they redirect to are not
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			}}}
+}
+
+func (p *AsyncInvoker) Invoke(apiName string, comMsg *ComponentMessage, callback *AsyncCallback) (id string, err error) {
+	comMsg.Payload.SetContext(CTX_ASYNC_ID, comMsg.Id)
+
+	var ch chan *Payload
+	if id, ch, err = p.messenger.SendMessage(apiName, comMsg); err != nil {
+		return
+	}
+
+	result := &AsyncResult{
+		Id:        id,
+		Api:       apiName,
+		Status:    ASYNC_STATUS_PENDING,
+		CreatedAt: time.Now()}
+
+	if err = asyncResultStore.Put(result, p.ttl); err != nil {
+		p.messenger.OnMessageEvent(id, MSG_EVENT_PROCESSED)
+		return
+	}
+
+	go p.wait(result, ch, callback)
+
+	return
+}
+
+func (p *AsyncInvoker) Result(id string) (result *AsyncResult, err error) {
+	exist := false
+	if result, exist, err = asyncResultStore.Get(id); err != nil {
+		return
+	} else if !exist {
+		err = errorcode.ERR_ASYNC_RESULT_NOT_EXIST.New(errors.Params{"id": id})
+	}
+	return
+}
+
+func (p *AsyncInvoker) wait(result *AsyncResult, ch chan *Payload, callback *AsyncCallback) {
+	defer p.messenger.OnMessageEvent(result.Id, MSG_EVENT_PROCESSED)
+
+	select {
+	case payload := <-ch:
+		result.Status = ASYNC_STATUS_DONE
+		result.Code = payload.Code
+		result.Message = payload.Message
+		result.Result = payload.GetResult()
+	case <-time.After(p.timeout):
+		err := errorcode.ERR_REQUEST_TIMEOUT.New(errors.Params{"id": result.Id})
+		result.Status = ASYNC_STATUS_TIMEOUT
+		result.Code = err.Code()
+		result.Message = err.Error()
+	}
+	result.FinishedAt = time.Now()
+
+	if err := asyncResultStore.Put(result, p.ttl); err != nil {
+		logs.Error(err)
+	}
+
+	logs.Debug("async invocation finished:", result.Id, result.Status, result.Code)
+
+	if callback == nil {
+		return
+	}
+
+	if callback.Webhook != "" {
+		p.postWebhook(callback.Webhook, result)
+	}
+
+	if callback.Graph != "" {
+		p.sendToGraph(callback.Graph, result)
+	}
+}
+
+func (p *AsyncInvoker) postWebhook(url string, result *AsyncResult) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		logs.Error(errorcode.ERR_JSON_MARSHAL_ERROR.New(errors.Params{"err": err}))
+		return
+	}
+
+	resp, err := p.client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		logs.Error(errorcode.ERR_ASYNC_CALLBACK_FAILED.New(errors.Params{"id": result.Id, "callback": url, "err": err}))
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		logs.Error(errorcode.ERR_ASYNC_CALLBACK_FAILED.New(errors.Params{"id": result.Id, "callback": url, "err": resp.Status}))
+	}
+}
+
+func (p *AsyncInvoker) sendToGraph(graphName string, result *AsyncResult) {
+	comMsg, err := p.messenger.NewMessage(result)
+	if err != nil {
+		logs.Error(errorcode.ERR_COULD_NOT_NEW_COMPONENT_MSG.New(errors.Params{"err": err}))
+		return
+	}
+
+	comMsg.Headers().fillRequest(comMsg.Id, "async", graphName, p.timeout)
+	comMsg.Payload.fillDeprecatedContext(REQ_X_API)
+	comMsg.Payload.SetContext(CTX_ASYNC_ID, result.Id)
+
+	msgId, ch, err := p.messenger.SendMessage(graphName, comMsg)
+	if err != nil {
+		logs.Error(errorcode.ERR_ASYNC_CALLBACK_FAILED.New(errors.Params{"id": result.Id, "callback": graphName, "err": err}))
+		return
+	}
+	defer p.messenger.OnMessageEvent(msgId, MSG_EVENT_PROCESSED)
+
+	select {
+	case payload := <-ch:
+		if payload.Code != 0 {
+			logs.Error(errorcode.ERR_ASYNC_CALLBACK_FAILED.New(errors.Params{"id": result.Id, "callback": graphName, "err": payload.Message}))
+		}
+	case <-time.After(p.timeout):
+		logs.Error(errorcode.ERR_ASYNC_CALLBACK_FAILED.New(errors.Params{"id": result.Id, "callback": graphName, "err": "timeout"}))
+	}
+}
@@ -0,0 +1,216 @@
+package casper
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gogap/errors"
+	"github.com/gogap/logs"
+	uuid "github.com/nu7hatch/gouuid"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+const (
+	DefaultBlobThreshold = 1024 * 1024
+)
+
+var (
+	blobStore     BlobStore
+	blobThreshold int = DefaultBlobThreshold
+)
+
+// the large results are put into the blob store, and the message carries
+// the key only, the store should be reachable by all the components of the
+// graph, e.g. a shared directory or an object storage
+type BlobStore interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+// the results larger than threshold bytes (in json) are offloaded, it is
+// disabled if the store is nil, threshold <= 0 is DefaultBlobThreshold
+func SetBlobStore(store BlobStore, threshold int) {
+	if threshold <= 0 {
+		threshold = DefaultBlobThreshold
+	}
+
+	blobStore = store
+	blobThreshold = threshold
+}
+
+// FileBlobStore keeps the blobs as the files of a directory
+type FileBlobStore struct {
+	dir string
+}
+
+func NewFileBlobStore(dir string) (store *FileBlobStore, err error) {
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		err = errorcode.ERR_BLOB_STORE_FAILED.New(errors.Params{"op": "init", "key": dir, "err": err})
+		return
+	}
+
+	return &FileBlobStore{dir: dir}, nil
+}
+
+func (p *FileBlobStore) Put(key string, data []byte) (err error) {
+	// write a temp file and rename it, so Get never reads a partial blob
+	var tmp *os.File
+	if tmp, err = ioutil.TempFile(p.dir, ".tmp-"); err != nil {
+		return
+	}
+
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), p.path(key))
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return
+}
+
+func (p *FileBlobStore) Get(key string) ([]byte, error) {
+	return ioutil.ReadFile(p.path(key))
+}
+
+func (p *FileBlobStore) Delete(key string) (err error) {
+	if err = os.Remove(p.path(key)); os.IsNotExist(err) {
+		err = nil
+	}
+	return
+}
+
+func (p *FileBlobStore) path(key string) string {
+	// the keys are generated by casper, but never leave the directory
+	return filepath.Join(p.dir, strings.Replace(filepath.Base(key), "..", "", -1))
+}
+
+// offloadResult puts the result into the blob store if it is too large,
+// the key is kept by the payload until the graph completes
+func (p *Payload) offloadResult() (err error) {
+	if blobStore == nil || p.result == nil || p.resultRef != "" {
+		return
+	}
+
+	var data []byte
+	if data, err = json.Marshal(p.result); err != nil {
+		return
+	}
+
+	if len(data) <= blobThreshold {
+		return
+	}
+
+	var u *uuid.UUID
+	if u, err = uuid.NewV4(); err != nil {
+		return
+	}
+
+	key := u.String()
+	if err = blobStore.Put(key, data); err != nil {
+		err = errorcode.ERR_BLOB_STORE_FAILED.New(errors.Params{"op": "put", "key": key, "err": err})
+		return
+	}
+
+	logs.Debug("result offloaded to blob:", key, len(data))
+
+	p.result = nil
+	p.resultRef = key
+	p.blobs = append(p.blobs, key)
+	return
+}
+
+// loadResult fetches the offloaded result, it is cached by the payload
+func (p *Payload) loadResult() (err error) {
+	if p.resultRef == "" || p.result != nil {
+		return
+	}
+
+	if blobStore == nil {
+		err = errorcode.ERR_BLOB_STORE_FAILED.New(errors.Params{"op": "get", "key": p.resultRef, "err": "blob store is not set"})
+		return
+	}
+
+	var data []byte
+	if data, err = blobStore.Get(p.resultRef); err != nil {
+		err = errorcode.ERR_BLOB_STORE_FAILED.New(errors.Params{"op": "get", "key": p.resultRef, "err": err})
+		return
+	}
+
+	// the numbers are kept as they are, like the json codec does
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var result interface{}
+	if err = decoder.Decode(&result); err != nil {
+		return
+	}
+
+	p.result = result
+	return
+}
+
+// resolveResult loads the offloaded result and drops the reference, for
+// the replies which leave casper
+func (p *Payload) resolveResult() (err error) {
+	if err = p.loadResult(); err != nil {
+		return
+	}
+	p.resultRef = ""
+	return
+}
+
+// the blobs of the payloads which reached the entrance, they are deleted
+// once the entrance processed the message
+type blobTracker struct {
+	locker sync.Mutex
+	blobs  map[string][]string
+}
+
+func (p *blobTracker) track(msgId string, blobs []string) {
+	if len(blobs) == 0 {
+		return
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.blobs == nil {
+		p.blobs = make(map[string][]string)
+	}
+	p.blobs[msgId] = append(p.blobs[msgId], blobs...)
+}
+
+func (p *blobTracker) release(msgId string) {
+	p.locker.Lock()
+	blobs := p.blobs[msgId]
+	delete(p.blobs, msgId)
+	p.locker.Unlock()
+
+	deleteBlobs(blobs)
+}
+
+func deleteBlobs(blobs []string) {
+	if blobStore == nil {
+		return
+	}
+
+	for _, key := range blobs {
+		if err := blobStore.Delete(key); err != nil {
+			logs.Error(errorcode.ERR_BLOB_STORE_FAILED.New(errors.Params{"op": "delete", "key": key, "err": err}))
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package casper
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBlobResultAcrossCodecs(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "blobs")
+
+	// the blob store is configured by the component
+	if _, err := newComponent(ComponentConfig{Name: "blob", MQType: "zmq", In: "tcp://127.0.0.1:5997", BlobStore: dir, BlobThreshold: 64}, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer SetBlobStore(nil, 0)
+
+	type result struct {
+		Id   int64  `json:"id"`
+		Text string `json:"text"`
+	}
+
+	tests := []struct {
+		codec   string
+		text    string
+		offload bool
+	}{
+		{"json", "small", false},
+		{"json", strings.Repeat("a", 64), true},
+		{"msgpack", "small", false},
+		{"msgpack", strings.Repeat("b", 64), true},
+		{"protobuf", "small", false},
+		{"protobuf", strings.Repeat("c", 64), true},
+	}
+
+	for _, test := range tests {
+		comMsg, _ := NewComponentMessage(nil, result{Id: math.MaxInt64, Text: test.text})
+		if err := comMsg.Payload.offloadResult(); err != nil {
+			t.Fatal(err)
+		}
+
+		ref := comMsg.Payload.resultRef
+		if offloaded := ref != "" && comMsg.Payload.result == nil; offloaded != test.offload {
+			t.Errorf("%s: the result of %d bytes is offloaded: %v", test.codec, len(test.text), offloaded)
+			continue
+		}
+
+		codec, _ := GetCodec(test.codec)
+		data, err := codec.Marshal(comMsg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if test.offload && bytes.Contains(data, []byte(test.text)) {
+			t.Errorf("%s: the offloaded result is still in the message", test.codec)
+		}
+
+		// the receiving end
+		received := new(ComponentMessage)
+		if err = codec.Unmarshal(data, received); err != nil {
+			t.Fatal(err)
+		}
+
+		if received.Payload.resultRef != ref {
+			t.Errorf("%s: the reference is %q, not %q", test.codec, received.Payload.resultRef, ref)
+		}
+
+		var got result
+		if err = received.Payload.UnmarshalResult(&got); err != nil {
+			t.Errorf("%s: %v", test.codec, err)
+		} else if got.Id != math.MaxInt64 || got.Text != test.text {
+			t.Errorf("%s: the result is resolved as %+v", test.codec, got)
+		}
+
+		// the replies leave casper without the reference
+		if err = received.Payload.resolveResult(); err != nil || received.Payload.resultRef != "" || received.Payload.result == nil {
+			t.Errorf("%s: the result is not resolved: %v", test.codec, err)
+		}
+
+		if test.offload {
+			deleteBlobs(comMsg.Payload.blobs)
+			if _, err = os.Stat(filepath.Join(dir, ref)); !os.IsNotExist(err) {
+				t.Errorf("%s: the blob is not deleted: %v", test.codec, err)
+			}
+		}
+	}
+}
@@ -1,9 +1,8 @@
 package casper
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"sync"
 
 	"github.com/gogap/logs"
 )
@@ -30,55 +29,71 @@ type App struct {
 	Entrance
 
 	messenger Messenger
+	async     *AsyncInvoker
+
+	conf         AppConfig
+	reloadLocker sync.Mutex
 }
 
 type CasperConfigs struct {
 	Apps       []AppConfig       `json:"apps"`
 	Components []ComponentConfig `json:"components"`
+
+	// where the entries are, for the errors
+	appPositions  []configPosition
+	compPositions []configPosition
+
+	warnings ConfigErrors // see AllowUnknownTypes
 }
 
 type AppConfig struct {
-	Name        string              `json:"name"`
-	Description string              `json:"description"`
-	In          string              `json:"in"`
-	MQType      string              `json:"mq_type"`
-	Entrance    EntranceOptions     `json:"entrance"`
-	Graphs      map[string][]string `json:"graphs"`
+	Name              string              `json:"name"`
+	Description       string              `json:"description"`
+	In                string              `json:"in"`
+	MQType            string              `json:"mq_type"`
+	Codec             string              `json:"codec"`
+	Compression       string              `json:"compression"`
+	CompressThreshold int                 `json:"compress_threshold"`
+	MaxMessageSize    int                 `json:"max_message_size"`
+	MaxContextEntries int                 `json:"max_context_entries"`
+	MaxCommandEntries int                 `json:"max_command_entries"`
+	Tap               string              `json:"tap"`
+	BlobStore         string              `json:"blob_store"`
+	BlobThreshold     int                 `json:"blob_threshold"`
+	Entrance          EntranceOptions     `json:"entrance"`
+	Graphs            map[string][]string `json:"graphs"`
 }
 
 func (p *AppConfig) ComponentConfig() ComponentConfig {
 	return ComponentConfig{
-		Name:        p.Name,
-		Description: p.Description,
-		In:          p.In,
-		MQType:      p.MQType}
+		Name:              p.Name,
+		Description:       p.Description,
+		In:                p.In,
+		MQType:            p.MQType,
+		Codec:             p.Codec,
+		Compression:       p.Compression,
+		CompressThreshold: p.CompressThreshold,
+		MaxMessageSize:    p.MaxMessageSize,
+		MaxContextEntries: p.MaxContextEntries,
+		MaxCommandEntries: p.MaxCommandEntries,
+		Tap:               p.Tap,
+		BlobStore:         p.BlobStore,
+		BlobThreshold:     p.BlobThreshold}
 }
 
+// BuildApps is LoadApps, but panics on the errors
 func BuildApps(filePaths []string) {
-	for _, filePath := range filePaths {
-		BuildApp(filePath)
+	if err := LoadApps(filePaths); err != nil {
+		logs.Error(err)
+		panic(err)
 	}
 }
 
+// BuildApp is LoadApp, but panics on the errors
 func BuildApp(filePath string) {
-	conf := CasperConfigs{}
-
-	if bConf, e := ioutil.ReadFile(filePath); e != nil {
-		panic(e)
-	} else if e := json.Unmarshal(bConf, &conf); e != nil {
-		panic(e)
-	}
-
-	for _, compConf := range conf.Components {
-		if _, e := NewComponent(compConf); e != nil {
-			panic(e)
-		}
-	}
-
-	for _, appConf := range conf.Apps {
-		if _, e := NewApp(appConf); e != nil {
-			panic(e)
-		}
+	if err := LoadApp(filePath); err != nil {
+		logs.Error(err)
+		panic(err)
 	}
 }
 
@@ -89,16 +104,26 @@ func NewApp(appConf AppConfig) (app *App, err error) {
 	compMeta := compConf.Metadata()
 
 	appMessenger := NewMQChanMessenger(appConf.Graphs, compMeta)
-	appEntrance := entrancefactory.NewEntrance(appMessenger, appConf.Entrance.Type, appConf.Entrance.Options)
+
+	var appEntrance Entrance
+	if factory, ok := entrancefactory.(EntranceFactoryE); ok {
+		if appEntrance, err = factory.NewEntranceE(appMessenger, appConf.Entrance.Type, appConf.Entrance.Options); err != nil {
+			return
+		}
+	} else {
+		appEntrance = entrancefactory.NewEntrance(appMessenger, appConf.Entrance.Type, appConf.Entrance.Options)
+	}
 
 	if appComponent, e := NewComponentWithMessenger(compConf, appMessenger); e != nil {
-		panic(e)
+		return nil, e
 	} else {
 		newApp.Component = *appComponent
 	}
 
 	newApp.messenger = appMessenger
+	newApp.async = NewAsyncInvoker(appMessenger, REQ_TIMEOUT, DefaultAsyncResultTTL)
 	newApp.Entrance = appEntrance
+	newApp.conf = appConf
 
 	app = newApp
 
@@ -130,6 +155,27 @@ func SetEntranceFactory(factory EntranceFactory) {
 	entrancefactory = factory
 }
 
+func (p *App) Messenger() Messenger {
+	return p.messenger
+}
+
+// InvokeAsync sends body to the graph of api and returns the invocation id
+// without waiting, the final result could be queried by AsyncResult
+func (p *App) InvokeAsync(api string, body interface{}, callback *AsyncCallback) (id string, err error) {
+	var comMsg *ComponentMessage
+	if comMsg, err = p.messenger.NewMessage(body); err != nil {
+		return
+	}
+	comMsg.Headers().fillRequest(comMsg.Id, "async", api, p.async.timeout)
+	comMsg.Payload.fillDeprecatedContext(REQ_X_API)
+
+	return p.async.Invoke(api, comMsg, callback)
+}
+
+func (p *App) AsyncResult(id string) (result *AsyncResult, err error) {
+	return p.async.Result(id)
+}
+
 func (p *App) Run() {
 	if err := p.Component.Run(); err != nil {
 		panic(err)
@@ -139,6 +185,25 @@ func (p *App) Run() {
 	}
 }
 
+// Stop stops the entrance of the app if it could be stopped, the requests
+// being handled are waited for
+func (p *App) Stop() error {
+	if stopper, ok := p.Entrance.(EntranceStopper); ok {
+		return stopper.Stop()
+	}
+	return nil
+}
+
+// JobsStatus is the status of the jobs if the entrance of the app runs jobs,
+// e.g. the cron entrance
+func (p *App) JobsStatus() (status []CronJobStatus, ok bool) {
+	var jobs interface{ JobsStatus() []CronJobStatus }
+	if jobs, ok = p.Entrance.(interface{ JobsStatus() []CronJobStatus }); ok {
+		status = jobs.JobsStatus()
+	}
+	return
+}
+
 func CallService(serviceType, addr string, msg *ComponentMessage) (reply *ComponentMessage, err error) {
 	switch serviceType {
 	case "zmq":
@@ -0,0 +1,221 @@
+/*
+the clients to call the casper apps
+*/
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gogap/errors"
+
+	"github.com/gogap/casper"
+	"github.com/gogap/casper/errorcode"
+)
+
+type Request struct {
+	Api     string
+	Body    interface{}
+	Headers map[string]string
+	Context map[string]interface{}
+}
+
+type Reply struct {
+	Id      string
+	Code    uint64
+	Message string
+	Result  json.RawMessage
+	Headers map[string]string
+	Hops    []*casper.Hop // the components the request went through, in order
+}
+
+// a transport sends one request to a casper app and waits for the reply,
+// it should be safe for concurrent use
+type Transport interface {
+	RoundTrip(ctx context.Context, req *Request) (reply *Reply, err error)
+	Close() error
+}
+
+type callOptions struct {
+	headers      map[string]string
+	context      map[string]interface{}
+	timeout      time.Duration
+	retries      int
+	retryBackoff time.Duration
+	reply        *Reply
+}
+
+type CallOption func(*callOptions)
+
+func WithHeader(name, value string) CallOption {
+	return func(p *callOptions) {
+		p.headers[name] = value
+	}
+}
+
+func WithContext(key string, value interface{}) CallOption {
+	return func(p *callOptions) {
+		p.context[key] = value
+	}
+}
+
+// the timeout of every attempt, default is casper.REQ_TIMEOUT, the
+// deadline of ctx wins if it is earlier
+func WithTimeout(timeout time.Duration) CallOption {
+	return func(p *callOptions) {
+		p.timeout = timeout
+	}
+}
+
+// only transport errors are retried, the error replied by the graph is not
+func WithRetries(retries int, backoff time.Duration) CallOption {
+	return func(p *callOptions) {
+		p.retries = retries
+		p.retryBackoff = backoff
+	}
+}
+
+// keep the raw reply, e.g. for the message id and the headers
+func WithReply(reply *Reply) CallOption {
+	return func(p *callOptions) {
+		p.reply = reply
+	}
+}
+
+type Client struct {
+	transport Transport
+	options   []CallOption
+}
+
+// the options are the defaults of every call
+func New(transport Transport, opts ...CallOption) *Client {
+	return &Client{transport: transport, options: opts}
+}
+
+func (p *Client) Close() error {
+	return p.transport.Close()
+}
+
+// Call sends req to the graph of api and decodes the result into resp,
+// the error is an errors.ErrCode if the graph replied a non-zero code
+func (p *Client) Call(ctx context.Context, api string, req interface{}, resp interface{}, opts ...CallOption) (err error) {
+	options := &callOptions{
+		headers: map[string]string{},
+		context: map[string]interface{}{},
+		timeout: casper.REQ_TIMEOUT}
+
+	for _, opt := range p.options {
+		opt(options)
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if req == nil {
+		req = map[string]interface{}{}
+	}
+
+	request := &Request{
+		Api:     api,
+		Body:    req,
+		Headers: options.headers,
+		Context: options.context}
+
+	var reply *Reply
+	for attempt := 0; attempt <= options.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(options.retryBackoff):
+			}
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, options.timeout)
+		reply, err = p.transport.RoundTrip(attemptCtx, request)
+		cancel()
+
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+	}
+
+	if err != nil {
+		return
+	}
+
+	if options.reply != nil {
+		*options.reply = *reply
+	}
+
+	if reply.Code != 0 {
+		return errors.T(reply.Code, "{{.message}}").New(errors.Params{"message": reply.Message})
+	}
+
+	if resp != nil && len(reply.Result) > 0 {
+		if e := json.Unmarshal(reply.Result, resp); e != nil {
+			err = errorcode.ERR_JSON_UNMARSHAL_ERROR.New(errors.Params{"err": e})
+			return
+		}
+	}
+
+	return
+}
+
+// the reply of the zmq and the in-process transports
+func replyOfPayload(id string, payload *casper.Payload) (reply *Reply, err error) {
+	reply = &Reply{
+		Id:      id,
+		Code:    payload.Code,
+		Message: payload.Message,
+		Headers: map[string]string{},
+		Hops:    payload.Hops()}
+
+	if result := payload.GetResult(); result != nil {
+		if reply.Result, err = json.Marshal(result); err != nil {
+			err = errorcode.ERR_JSON_MARSHAL_ERROR.New(errors.Params{"err": err})
+			return
+		}
+	}
+
+	var headers []*casper.NameValue
+	if headers, err = casper.GetCommandHeaders(payload); err != nil {
+		return
+	}
+
+	for _, nv := range headers {
+		reply.Headers[nv.Name] = nv.Value
+	}
+	return
+}
+
+// the request context and headers of the zmq and the in-process
+// transports, headers are the HTTPHeaders as the http entrance does
+func setPayloadContext(ctx context.Context, payload *casper.Payload, req *Request) {
+	for key, value := range req.Context {
+		payload.SetContext(key, value)
+	}
+
+	headers := payload.Headers()
+	headers.Api = req.Api
+	headers.TraceId = req.Headers[casper.HTTP_HEADER_TRACE_ID]
+	headers.SpanId = req.Headers[casper.HTTP_HEADER_SPAN_ID]
+	headers.Tenant = req.Headers[casper.HTTP_HEADER_TENANT]
+
+	if deadline, ok := ctx.Deadline(); ok {
+		headers.Deadline = deadline
+	}
+
+	if len(req.Headers) > 0 {
+		headers.HTTPHeaders = req.Headers
+	}
+
+	// the deprecated keys, for the handlers which still read them, the zmq
+	// entrance fills them as well, the in-process transport has no entrance
+	payload.SetContext(casper.REQ_X_API, req.Api)
+	if len(req.Headers) > 0 {
+		payload.SetContext(casper.CTX_HTTP_HEADERS, req.Headers)
+	}
+}
@@ -0,0 +1,115 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gogap/errors"
+
+	"github.com/gogap/casper"
+	"github.com/gogap/casper/errorcode"
+)
+
+// HTTPTransport talks to the martini entrance, the context of the request
+// could not be sent over http, only the headers
+type HTTPTransport struct {
+	url        string
+	apiHeader  string
+	hopsHeader string
+	client     *http.Client
+}
+
+// httpClient could be nil, the connections are pooled by http.Client
+func NewHTTPTransport(url string, httpClient *http.Client) *HTTPTransport {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+
+	return &HTTPTransport{
+		url:       url,
+		apiHeader: casper.DefaultAPIHeader,
+		client:    httpClient}
+}
+
+// the same as the api_header option of the entrance
+func (p *HTTPTransport) SetAPIHeader(name string) *HTTPTransport {
+	p.apiHeader = name
+	return p
+}
+
+// the same as the hops_header option of the entrance, the hops of the
+// replies are asked for if it is set
+func (p *HTTPTransport) SetHopsHeader(name string) *HTTPTransport {
+	p.hopsHeader = name
+	return p
+}
+
+func (p *HTTPTransport) RoundTrip(ctx context.Context, req *Request) (reply *Reply, err error) {
+	var body []byte
+	if body, err = json.Marshal(req.Body); err != nil {
+		err = errorcode.ERR_JSON_MARSHAL_ERROR.New(errors.Params{"err": err})
+		return
+	}
+
+	var httpReq *http.Request
+	if httpReq, err = http.NewRequest("POST", p.url, bytes.NewReader(body)); err != nil {
+		return
+	}
+	httpReq = httpReq.WithContext(ctx)
+
+	for name, value := range req.Headers {
+		httpReq.Header.Set(name, value)
+	}
+	httpReq.Header.Set(p.apiHeader, req.Api)
+	httpReq.Header.Set("Content-Type", "application/json")
+	if p.hopsHeader != "" {
+		httpReq.Header.Set(p.hopsHeader, "1")
+	}
+
+	var httpResp *http.Response
+	if httpResp, err = p.client.Do(httpReq); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = errorcode.ERR_REQUEST_TIMEOUT.New(errors.Params{"id": p.url})
+		}
+		return
+	}
+	defer httpResp.Body.Close()
+
+	var resp struct {
+		Code    uint64          `json:"code"`
+		Message string          `json:"message"`
+		Result  json.RawMessage `json:"result"`
+	}
+
+	if e := json.NewDecoder(httpResp.Body).Decode(&resp); e != nil {
+		err = errorcode.ERR_HTTP_RESPONSE_INVALID.New(errors.Params{"url": p.url, "status": httpResp.Status, "err": e})
+		return
+	}
+
+	reply = &Reply{
+		Id:      httpResp.Header.Get("X-Response-Id"),
+		Code:    resp.Code,
+		Message: resp.Message,
+		Result:  resp.Result,
+		Headers: map[string]string{}}
+
+	for name := range httpResp.Header {
+		reply.Headers[name] = httpResp.Header.Get(name)
+	}
+
+	if hops := httpResp.Header.Get(p.hopsHeader); p.hopsHeader != "" && hops != "" {
+		if e := json.Unmarshal([]byte(hops), &reply.Hops); e != nil {
+			err = errorcode.ERR_HTTP_RESPONSE_INVALID.New(errors.Params{"url": p.url, "status": httpResp.Status, "err": e})
+			return
+		}
+		delete(reply.Headers, http.CanonicalHeaderKey(p.hopsHeader))
+	}
+
+	return
+}
+
+func (p *HTTPTransport) Close() error {
+	return nil
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+
+	"github.com/gogap/errors"
+
+	"github.com/gogap/casper"
+	"github.com/gogap/casper/errorcode"
+)
+
+// InProcTransport sends the request through the messenger of an app which
+// runs in the same process, without any entrance
+type InProcTransport struct {
+	messenger casper.Messenger
+}
+
+func NewInProcTransport(messenger casper.Messenger) *InProcTransport {
+	return &InProcTransport{messenger: messenger}
+}
+
+func NewAppTransport(appName string) (transport *InProcTransport, err error) {
+	app := casper.GetAppByName(appName)
+	if app == nil {
+		err = errorcode.ERR_APP_NOT_EXIST.New(errors.Params{"name": appName})
+		return
+	}
+	return NewInProcTransport(app.Messenger()), nil
+}
+
+func (p *InProcTransport) RoundTrip(ctx context.Context, req *Request) (reply *Reply, err error) {
+	var msg *casper.ComponentMessage
+	if msg, err = p.messenger.NewMessage(req.Body); err != nil {
+		err = errorcode.ERR_COULD_NOT_NEW_COMPONENT_MSG.New(errors.Params{"err": err})
+		return
+	}
+
+	setPayloadContext(ctx, msg.Payload, req)
+
+	msgId := ""
+	var ch chan *casper.Payload
+	if msgId, ch, err = p.messenger.SendMessage(req.Api, msg); err != nil {
+		return
+	}
+	defer p.messenger.OnMessageEvent(msgId, casper.MSG_EVENT_PROCESSED)
+
+	select {
+	case payload := <-ch:
+		return replyOfPayload(msgId, payload)
+	case <-ctx.Done():
+		err = ctx.Err()
+		if err == context.DeadlineExceeded {
+			err = errorcode.ERR_REQUEST_TIMEOUT.New(errors.Params{"id": msgId})
+		}
+		return
+	}
+}
+
+func (p *InProcTransport) Close() error {
+	return nil
+}
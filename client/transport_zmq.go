@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/gogap/errors"
+	zmq "github.com/pebbe/zmq4"
+
+	"github.com/gogap/casper"
+	"github.com/gogap/casper/errorcode"
+)
+
+const (
+	defaultZMQPoolSize = 16
+	zmqPollInterval    = 100 * time.Millisecond
+)
+
+// ZMQTransport talks to the zmq entrance, the REQ sockets are pooled, a
+// socket which timed out is closed because it could not be used any more
+type ZMQTransport struct {
+	endpoint          string
+	codec             string
+	compression       string
+	compressThreshold int
+	sockets           chan *zmq.Socket
+}
+
+func NewZMQTransport(endpoint string, poolSize int) *ZMQTransport {
+	if poolSize <= 0 {
+		poolSize = defaultZMQPoolSize
+	}
+
+	return &ZMQTransport{
+		endpoint: endpoint,
+		sockets:  make(chan *zmq.Socket, poolSize)}
+}
+
+// the codec of the requests, default is json, the entrance replies with
+// the same codec
+func (p *ZMQTransport) SetCodec(name string) (err error) {
+	if _, err = casper.GetCodec(name); err != nil {
+		return
+	}
+	p.codec = name
+	return
+}
+
+// the requests larger than threshold are compressed, the entrance replies
+// with the same compression
+func (p *ZMQTransport) SetCompression(name string, threshold int) (err error) {
+	if _, err = casper.GetCompressor(name); err != nil {
+		return
+	}
+	p.compression = name
+	p.compressThreshold = threshold
+	return
+}
+
+func (p *ZMQTransport) RoundTrip(ctx context.Context, req *Request) (reply *Reply, err error) {
+	var msg *casper.ComponentMessage
+	if msg, err = casper.NewComponentMessage(nil, req.Body); err != nil {
+		err = errorcode.ERR_COULD_NOT_NEW_COMPONENT_MSG.New(errors.Params{"err": err})
+		return
+	}
+
+	setPayloadContext(ctx, msg.Payload, req)
+
+	var request *casper.Packet
+	if request, err = casper.EncodePacket(p.codec, msg); err == nil {
+		err = request.Compress(p.compression, p.compressThreshold)
+	}
+
+	if err != nil {
+		err = errorcode.ERR_COMPONENT_MSG_SERIALIZE_FAILED.New(errors.Params{"in": p.endpoint, "mqType": "zmq", "err": err})
+		return
+	}
+
+	var socket *zmq.Socket
+	if socket, err = p.get(); err != nil {
+		return
+	}
+
+	if _, err = socket.SendMessage(casper.NewZMQPacket(request)); err != nil {
+		p.discard(socket)
+		return
+	}
+
+	var frames [][]byte
+	if frames, err = p.recv(ctx, socket); err != nil {
+		p.discard(socket)
+		return
+	}
+	p.put(socket)
+
+	packet, ok := casper.ParseZMQPacket(frames)
+	if !ok {
+		err = errorcode.ERR_ZMQ_RECV_MSG_INVALID.New(errors.Params{"url": p.endpoint})
+		return
+	}
+
+	replyMsg := new(casper.ComponentMessage)
+	if e := casper.DecodePacket(packet, replyMsg); e != nil || replyMsg.Payload == nil {
+		err = errorcode.ERR_COULD_NOT_PARSE_COMPONENT_MSG.New(errors.Params{"in": p.endpoint, "mqType": "zmq", "msg": e})
+		return
+	}
+
+	return replyOfPayload(replyMsg.Id, replyMsg.Payload)
+}
+
+func (p *ZMQTransport) Close() error {
+	for {
+		select {
+		case socket := <-p.sockets:
+			socket.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *ZMQTransport) recv(ctx context.Context, socket *zmq.Socket) (packet [][]byte, err error) {
+	poller := zmq.NewPoller()
+	poller.Add(socket, zmq.POLLIN)
+
+	for {
+		if err = ctx.Err(); err != nil {
+			if err == context.DeadlineExceeded {
+				err = errorcode.ERR_REQUEST_TIMEOUT.New(errors.Params{"id": p.endpoint})
+			}
+			return
+		}
+
+		var polled []zmq.Polled
+		if polled, err = poller.Poll(zmqPollInterval); err != nil {
+			err = errorcode.ERR_ZMQ_RECV_MSG_FAILED.New(errors.Params{"url": p.endpoint, "err": err})
+			return
+		}
+
+		if len(polled) == 1 {
+			if packet, err = socket.RecvMessageBytes(0); err != nil {
+				err = errorcode.ERR_ZMQ_RECV_MSG_FAILED.New(errors.Params{"url": p.endpoint, "err": err})
+			}
+			return
+		}
+	}
+}
+
+func (p *ZMQTransport) get() (socket *zmq.Socket, err error) {
+	select {
+	case socket = <-p.sockets:
+		return
+	default:
+	}
+
+	if socket, err = zmq.NewSocket(zmq.REQ); err != nil {
+		err = errorcode.ERR_NEW_ZMQ_FAILED.New(errors.Params{"url": p.endpoint, "type": "REQ", "err": err})
+		return
+	}
+
+	if err = socket.Connect(p.endpoint); err != nil {
+		socket.Close()
+		err = errorcode.ERR_ZMQ_COULD_NOT_CONNECT_TO_URL.New(errors.Params{"url": p.endpoint, "type": "REQ", "err": err})
+		return
+	}
+	return
+}
+
+func (p *ZMQTransport) put(socket *zmq.Socket) {
+	select {
+	case p.sockets <- socket:
+	default:
+		socket.Close()
+	}
+}
+
+func (p *ZMQTransport) discard(socket *zmq.Socket) {
+	socket.SetLinger(0)
+	socket.Close()
+}
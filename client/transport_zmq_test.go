@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gogap/errors"
+	zmq "github.com/pebbe/zmq4"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+func TestZMQTransportDiscardSocket(t *testing.T) {
+	// the router never replies
+	endpoint := "tcp://127.0.0.1:5998"
+	router, err := zmq.NewSocket(zmq.ROUTER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer router.Close()
+	if err = router.Bind(endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  func() (context.Context, context.CancelFunc)
+		code uint64
+		err  error
+	}{
+		{"timeout", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 50*time.Millisecond)
+		}, errorcode.ERR_REQUEST_TIMEOUT.New().Code(), nil},
+		{"canceled", func() (context.Context, context.CancelFunc) {
+			return canceled, func() {}
+		}, 0, context.Canceled},
+	}
+
+	for _, test := range tests {
+		transport := NewZMQTransport(endpoint, 1)
+
+		// the pooled socket is taken by the request
+		socket, err := transport.get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		transport.put(socket)
+
+		ctx, cancel := test.ctx()
+		_, err = transport.RoundTrip(ctx, &Request{Api: "slow"})
+		cancel()
+
+		if test.err != nil && err != test.err {
+			t.Errorf("%s: expected %v, got %v", test.name, test.err, err)
+		} else if test.err == nil && (!errors.IsErrCode(err) || err.(errors.ErrCode).Code() != test.code) {
+			t.Errorf("%s: expected the error %d, got %v", test.name, test.code, err)
+		}
+
+		// the reply of the request might still come, so the socket
+		// should not be used by the next requests
+		if len(transport.sockets) != 0 {
+			t.Errorf("%s: the socket is put back to the pool", test.name)
+		}
+
+		transport.Close()
+	}
+}
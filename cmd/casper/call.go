@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gogap/casper"
+	"github.com/gogap/casper/client"
+)
+
+func init() {
+	registerCommand("call", "--app-addr <addr> --api <api> [flags]",
+		"call a graph by the zmq or the http entrance and print the reply", runCall)
+}
+
+// the repeated k=v flags
+type keyValues []string
+
+func (p *keyValues) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *keyValues) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("%s should be key=value", value)
+	}
+	*p = append(*p, value)
+	return nil
+}
+
+// the values which are json are decoded, e.g. uid=1 is a number, the others
+// are strings
+func (p keyValues) context() map[string]interface{} {
+	values := map[string]interface{}{}
+	for _, kv := range p {
+		kvs := strings.SplitN(kv, "=", 2)
+
+		var v interface{}
+		if json.Unmarshal([]byte(kvs[1]), &v) != nil {
+			v = kvs[1]
+		}
+		values[kvs[0]] = v
+	}
+	return values
+}
+
+func (p keyValues) headers() map[string]string {
+	values := map[string]string{}
+	for _, kv := range p {
+		kvs := strings.SplitN(kv, "=", 2)
+		values[kvs[0]] = kvs[1]
+	}
+	return values
+}
+
+// the result of a call
+type callResult struct {
+	reply   *client.Reply
+	err     error
+	elapsed time.Duration
+}
+
+func runCall(args []string) (err error) {
+	fs := newFlagSet("call")
+	addr := fs.String("app-addr", "", "the entrance, tcp://... for zmq, http://... for http")
+	api := fs.String("api", "", "the graph to call")
+	body := fs.String("body", "{}", "the json body, @file reads it from the file, @- from stdin")
+	timeout := fs.Duration("timeout", casper.REQ_TIMEOUT, "the timeout of each call")
+	codec := fs.String("codec", "", "the codec of zmq, default is json")
+	apiHeader := fs.String("api-header", casper.DefaultAPIHeader, "the api header of http")
+	hopsHeader := fs.String("hops-header", "X-Casper-Hops", "the hops header of http, empty to not ask for the chain")
+	repeat := fs.Int("repeat", 1, "the number of calls, the summary is printed instead of the replies if it is more than 1")
+	concurrency := fs.Int("concurrency", 1, "the calls at the same time")
+
+	var contexts, headers keyValues
+	fs.Var(&contexts, "context", "k=v of the request context, repeatable, zmq only")
+	fs.Var(&headers, "header", "k=v of the request headers, repeatable")
+
+	if args, err = parseFlags(fs, args); err != nil {
+		return
+	} else if len(args) > 0 {
+		return usageError("unexpected argument " + args[0])
+	}
+
+	if *addr == "" || *api == "" {
+		return usageError("--app-addr and --api are required")
+	} else if *repeat < 1 || *concurrency < 1 {
+		return usageError("--repeat and --concurrency should be positive")
+	}
+
+	isHTTP := strings.HasPrefix(*addr, "http://") || strings.HasPrefix(*addr, "https://")
+
+	// the http entrance has no context, it would be dropped silently
+	if isHTTP && len(contexts) > 0 {
+		return usageError("--context could not be sent over http, use --header or a zmq address")
+	}
+
+	var reqBody interface{}
+	if reqBody, err = readBody(*body); err != nil {
+		return
+	}
+
+	var transport client.Transport
+	switch {
+	case isHTTP:
+		transport = client.NewHTTPTransport(*addr, nil).SetAPIHeader(*apiHeader).SetHopsHeader(*hopsHeader)
+	default:
+		zmqTransport := client.NewZMQTransport(*addr, *concurrency)
+		if err = zmqTransport.SetCodec(*codec); err != nil {
+			return
+		}
+		transport = zmqTransport
+	}
+	defer transport.Close()
+
+	req := &client.Request{
+		Api:     *api,
+		Body:    reqBody,
+		Headers: headers.headers(),
+		Context: contexts.context()}
+
+	call := func() callResult {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+
+		start := time.Now()
+		reply, err := transport.RoundTrip(ctx, req)
+		return callResult{reply: reply, err: err, elapsed: time.Since(start)}
+	}
+
+	if *repeat == 1 {
+		return printCall(call())
+	}
+
+	start := time.Now()
+	results := make([]callResult, *repeat)
+
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results[j] = call()
+			}
+		}()
+	}
+	for i := range results {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	printSummary(results, time.Since(start))
+	return
+}
+
+func readBody(body string) (v interface{}, err error) {
+	data := []byte(body)
+	if body == "@-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else if strings.HasPrefix(body, "@") {
+		data, err = ioutil.ReadFile(body[1:])
+	}
+	if err != nil {
+		return
+	}
+
+	if err = json.Unmarshal(data, &v); err != nil {
+		err = usageError("--body is not json: " + err.Error())
+	}
+	return
+}
+
+func printCall(result callResult) (err error) {
+	if result.err != nil {
+		return result.err
+	}
+
+	reply := result.reply
+	envelope := struct {
+		Id      string            `json:"id"`
+		Code    uint64            `json:"code"`
+		Message string            `json:"message,omitempty"`
+		Result  json.RawMessage   `json:"result,omitempty"`
+		Headers map[string]string `json:"headers,omitempty"`
+		Hops    []*casper.Hop     `json:"hops,omitempty"`
+	}{reply.Id, reply.Code, reply.Message, reply.Result, reply.Headers, reply.Hops}
+
+	var data []byte
+	if data, err = json.MarshalIndent(envelope, "", "  "); err != nil {
+		return
+	}
+	fmt.Println(string(data))
+
+	fmt.Println()
+	fmt.Printf("elapsed: %v\n", result.elapsed)
+
+	if len(reply.Hops) == 0 {
+		return
+	}
+
+	fmt.Println("chain:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "  #\tCOMPONENT\tIN\tOUTCOME\tHANDLE\tHELD\tQUEUED")
+	for i, hop := range reply.Hops {
+		// the time in the mq before the component received it
+		queued := ""
+		if i > 0 && !reply.Hops[i-1].SentAt.IsZero() {
+			queued = hop.ReceivedAt.Sub(reply.Hops[i-1].SentAt).String()
+		}
+		fmt.Fprintf(w, "  %d\t%s\t%s\t%s\t%v\t%v\t%s\n", i+1, hop.Component, hop.In, hop.Outcome, hop.HandleDuration(), hop.Duration(), queued)
+	}
+	return w.Flush()
+}
+
+func printSummary(results []callResult, total time.Duration) {
+	var elapsed []time.Duration
+	failed := 0
+	codes := map[uint64]int{}
+	errs := map[string]int{}
+
+	for _, result := range results {
+		elapsed = append(elapsed, result.elapsed)
+		if result.err != nil {
+			failed++
+			errs[result.err.Error()]++
+		} else {
+			codes[result.reply.Code]++
+		}
+	}
+	sort.Slice(elapsed, func(i, j int) bool { return elapsed[i] < elapsed[j] })
+
+	var sum time.Duration
+	for _, d := range elapsed {
+		sum += d
+	}
+
+	percentile := func(p float64) time.Duration {
+		return elapsed[int(float64(len(elapsed)-1)*p)]
+	}
+
+	fmt.Printf("calls: %d, failed: %d, total: %v, %.1f calls/s\n", len(results), failed, total, float64(len(results))/total.Seconds())
+	fmt.Printf("latency: min %v, avg %v, p50 %v, p90 %v, p99 %v, max %v\n",
+		elapsed[0], sum/time.Duration(len(elapsed)), percentile(0.5), percentile(0.9), percentile(0.99), elapsed[len(elapsed)-1])
+
+	codeKeys := make([]uint64, 0, len(codes))
+	for code := range codes {
+		codeKeys = append(codeKeys, code)
+	}
+	sort.Slice(codeKeys, func(i, j int) bool { return codeKeys[i] < codeKeys[j] })
+	for _, code := range codeKeys {
+		fmt.Printf("code %d: %d\n", code, codes[code])
+	}
+
+	for e, n := range errs {
+		fmt.Printf("error %s: %d\n", e, n)
+	}
+}
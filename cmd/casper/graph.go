@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gogap/casper"
+)
+
+func init() {
+	registerCommand("graph", "<conf> [overlay...] [--format dot|mermaid]", "render the graphs of the apps", runGraph)
+}
+
+// a node of the topology, an app or a component
+type graphNode struct {
+	id    string
+	label []string // the lines
+	app   bool
+}
+
+// an edge of the topology, the messages of a graph flow from from to to
+type graphEdge struct {
+	from, to string
+	graph    string
+	reply    bool // the result is sent back to the entrance
+}
+
+type topology struct {
+	nodes []*graphNode
+	edges []graphEdge
+}
+
+func runGraph(args []string) (err error) {
+	fs := newFlagSet("graph")
+	format := fs.String("format", "dot", "dot or mermaid")
+	allowUnknown := allowUnknownFlag(fs)
+	if args, err = parseFlags(fs, args); err != nil {
+		return
+	}
+
+	var files []string
+	if files, err = configFiles(args); err != nil {
+		return
+	}
+
+	var render func(io.Writer, *topology)
+	switch *format {
+	case "dot":
+		render = renderDot
+	case "mermaid":
+		render = renderMermaid
+	default:
+		return usageError("unknown format " + *format)
+	}
+
+	var conf *casper.CasperConfigs
+	if conf, err = loadConfigs(files, *allowUnknown); err != nil {
+		return
+	}
+
+	render(os.Stdout, newTopology(conf))
+	return
+}
+
+// the nodes are the apps and the components used by the graphs, each step of
+// a graph is an edge, the apps are the entrances of their graphs, the steps
+// are sorted by the names of the apps and the graphs, so the diffs are stable
+func newTopology(conf *casper.CasperConfigs) *topology {
+	topo := &topology{}
+
+	ins := map[string]string{}
+	for _, comp := range conf.Components {
+		ins[comp.Name] = comp.In
+	}
+
+	nodes := map[string]*graphNode{}
+	node := func(name string) string {
+		if _, exist := nodes[name]; !exist {
+			n := &graphNode{id: name, label: []string{name}}
+			if in := ins[name]; in != "" {
+				n.label = append(n.label, in)
+			}
+			nodes[name] = n
+			topo.nodes = append(topo.nodes, n)
+		}
+		return name
+	}
+
+	apps := append([]casper.AppConfig(nil), conf.Apps...)
+	sort.Slice(apps, func(i, j int) bool { return apps[i].Name < apps[j].Name })
+
+	for _, app := range apps {
+		nodes[app.Name] = &graphNode{id: app.Name, label: []string{app.Name, app.Entrance.Type + " entrance", app.In}, app: true}
+		topo.nodes = append(topo.nodes, nodes[app.Name])
+	}
+
+	for _, app := range apps {
+		graphNames := make([]string, 0, len(app.Graphs))
+		for name := range app.Graphs {
+			graphNames = append(graphNames, name)
+		}
+		sort.Strings(graphNames)
+
+		for _, graphName := range graphNames {
+			from := app.Name
+			for i, compName := range app.Graphs[graphName] {
+				if i == 0 && compName == "self" {
+					compName = app.Name
+				}
+				to := node(compName)
+				topo.edges = append(topo.edges, graphEdge{from: from, to: to, graph: graphName})
+				from = to
+			}
+			topo.edges = append(topo.edges, graphEdge{from: from, to: app.Name, graph: graphName, reply: true})
+		}
+	}
+
+	sort.SliceStable(topo.nodes, func(i, j int) bool {
+		if topo.nodes[i].app != topo.nodes[j].app {
+			return topo.nodes[i].app
+		}
+		return topo.nodes[i].id < topo.nodes[j].id
+	})
+	return topo
+}
+
+func renderDot(w io.Writer, topo *topology) {
+	quote := func(s string) string {
+		return `"` + strings.Replace(strings.Replace(s, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+	}
+
+	fmt.Fprintln(w, "digraph casper {")
+	fmt.Fprintln(w, "\trankdir=LR;")
+	for _, n := range topo.nodes {
+		shape := "ellipse"
+		if n.app {
+			shape = "box"
+		}
+		fmt.Fprintf(w, "\t%s [shape=%s, label=%s];\n", quote(n.id), shape, strings.Replace(quote(strings.Join(n.label, "\n")), "\n", `\n`, -1))
+	}
+	for _, e := range topo.edges {
+		style := ""
+		if e.reply {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(w, "\t%s -> %s [label=%s%s];\n", quote(e.from), quote(e.to), quote(e.graph), style)
+	}
+	fmt.Fprintln(w, "}")
+}
+
+var mermaidUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+func renderMermaid(w io.Writer, topo *topology) {
+	// the ids of mermaid are words, the names might have dots
+	ids, used := map[string]string{}, map[string]bool{}
+	for _, n := range topo.nodes {
+		id := mermaidUnsafe.ReplaceAllString(n.id, "_")
+		for i := 2; used[id]; i++ {
+			id = fmt.Sprintf("%s_%d", mermaidUnsafe.ReplaceAllString(n.id, "_"), i)
+		}
+		ids[n.id], used[id] = id, true
+	}
+
+	quote := func(s string) string {
+		return `"` + strings.Replace(s, `"`, "#quot;", -1) + `"`
+	}
+
+	fmt.Fprintln(w, "flowchart LR")
+	for _, n := range topo.nodes {
+		label := quote(strings.Join(n.label, "<br/>"))
+		if n.app {
+			fmt.Fprintf(w, "    %s[%s]\n", ids[n.id], label)
+		} else {
+			fmt.Fprintf(w, "    %s(%s)\n", ids[n.id], label)
+		}
+	}
+	for _, e := range topo.edges {
+		arrow := "-->"
+		if e.reply {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(w, "    %s %s|%s| %s\n", ids[e.from], arrow, quote(e.graph), ids[e.to])
+	}
+}
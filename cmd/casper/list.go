@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gogap/casper"
+)
+
+func init() {
+	registerCommand("list", "<conf> [overlay...]", "list the apps, the entrances and the components", runList)
+}
+
+func runList(args []string) (err error) {
+	fs := newFlagSet("list")
+	allowUnknown := allowUnknownFlag(fs)
+	if args, err = parseFlags(fs, args); err != nil {
+		return
+	}
+
+	var files []string
+	if files, err = configFiles(args); err != nil {
+		return
+	}
+
+	var conf *casper.CasperConfigs
+	if conf, err = loadConfigs(files, *allowUnknown); err != nil {
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(w, "APP\tENTRANCE\tIN\tMQ\tGRAPHS")
+	for _, app := range conf.Apps {
+		graphs := make([]string, 0, len(app.Graphs))
+		for name := range app.Graphs {
+			graphs = append(graphs, name)
+		}
+		sort.Strings(graphs)
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", app.Name, app.Entrance.Type, app.In, app.MQType, strings.Join(graphs, ","))
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "COMPONENT\tIN\tMQ\tCODEC\tCOMPRESSION")
+	for _, comp := range conf.Components {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", comp.Name, comp.In, comp.MQType, orDefault(comp.Codec, "json"), orDefault(comp.Compression, "none"))
+	}
+
+	return w.Flush()
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
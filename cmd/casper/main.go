@@ -0,0 +1,135 @@
+/*
+the casper command, to check and inspect the configs
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/gogap/casper"
+)
+
+type command struct {
+	usage string // the arguments
+	brief string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{}
+
+func registerCommand(name, usage, brief string, run func(args []string) error) {
+	commands[name] = command{usage: name + " " + usage, brief: brief, run: run}
+}
+
+// the error of the wrong arguments, the usage is printed
+type usageError string
+
+func (p usageError) Error() string {
+	return string(p)
+}
+
+// the flags are wrong, the flag package has printed the error and the usage
+var errFlags = errors.New("invalid flags")
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: casper <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stderr, 0, 4, 4, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\t%s\n", commands[name].usage, commands[name].brief)
+	}
+	w.Flush()
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "--help" || os.Args[1] == "help" {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, exist := commands[os.Args[1]]
+	if !exist {
+		fmt.Fprintf(os.Stderr, "casper: unknown command %s\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(os.Args[2:]); err == errFlags {
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if _, ok := err.(usageError); ok {
+			fmt.Fprintf(os.Stderr, "usage: casper %s\n", cmd.usage)
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+// parseFlags allows the flags after the arguments, e.g. graph a.conf --format dot
+func parseFlags(fs *flag.FlagSet, args []string) (positional []string, err error) {
+	for {
+		if err = fs.Parse(args); err != nil {
+			return nil, errFlags
+		}
+
+		if args = fs.Args(); len(args) == 0 {
+			return
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: casper %s\n", commands[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// the config files, the later ones are the overlays of the former ones
+func configFiles(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return nil, usageError("config file is required")
+	}
+	return args, nil
+}
+
+// the cli has only the built-in entrances, mq types, codecs, compressions
+// and taps, the custom ones of the apps are unknown to it
+func allowUnknownFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("allow-unknown", false, "the unknown entrances, mq types, codecs, compressions and taps are warnings, e.g. the custom ones of the apps")
+}
+
+// loadConfigs is casper.LoadConfigs, the warnings are printed
+func loadConfigs(files []string, allowUnknown bool) (conf *casper.CasperConfigs, err error) {
+	casper.AllowUnknownTypes(allowUnknown)
+	if conf, err = casper.LoadConfigs(files...); err != nil {
+		return
+	}
+	printWarnings(conf)
+	return
+}
+
+func printWarnings(conf *casper.CasperConfigs) {
+	for _, warning := range conf.Warnings() {
+		fmt.Fprintln(os.Stderr, "warning:", warning)
+	}
+}
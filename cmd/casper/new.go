@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/gogap/casper"
+)
+
+func init() {
+	registerCommand("new", "component|app <name> --config <conf> [flags]",
+		"generate the skeleton of a component or an app and add it to the config", runNew)
+}
+
+// the ports are allocated from them, the mq ones and the entrance ones
+const (
+	mqBasePort       = 5001
+	entranceBasePort = 8080
+)
+
+var componentName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]*$`)
+
+// the config of the new component or app, the fields are in the order of the config files
+type newComponentEntry struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+	MQType      string `json:"mq_type" yaml:"mq_type"`
+	In          string `json:"in" yaml:"in"`
+}
+
+type newEntranceEntry struct {
+	Type    string                 `json:"type" yaml:"type"`
+	Options map[string]interface{} `json:"options" yaml:"options"`
+}
+
+type newAppEntry struct {
+	Name        string              `json:"name" yaml:"name"`
+	Description string              `json:"description" yaml:"description"`
+	MQType      string              `json:"mq_type" yaml:"mq_type"`
+	In          string              `json:"in" yaml:"in"`
+	Entrance    newEntranceEntry    `json:"entrance" yaml:"entrance"`
+	Graphs      map[string][]string `json:"graphs" yaml:"graphs"`
+}
+
+func runNew(args []string) (err error) {
+	fs := newFlagSet("new")
+	config := fs.String("config", "", "the config file the entry is added to, it is created if not exist")
+	dir := fs.String("dir", ".", "the directory of the go files")
+	pkg := fs.String("package", "", "the package of the go files, default is the one of the directory, or main")
+	host := fs.String("host", "127.0.0.1", "the host of the addresses")
+	entrance := fs.String("entrance", "martini", "the entrance of the app, martini, jsonrpc, zmq, grpc or stdio")
+	allowUnknown := allowUnknownFlag(fs)
+
+	if args, err = parseFlags(fs, args); err != nil {
+		return
+	} else if len(args) != 2 || (args[0] != "component" && args[0] != "app") {
+		return usageError("new component <name> or new app <name>")
+	} else if *config == "" {
+		return usageError("--config is required")
+	}
+
+	kind, name := args[0], args[1]
+	if !componentName.MatchString(name) {
+		return usageError("invalid name " + name + ", it should be letters, digits, _, . or -")
+	}
+
+	var data []byte
+	if data, err = ioutil.ReadFile(*config); os.IsNotExist(err) {
+		data, err = emptyConfig(*config), nil
+	}
+	if err != nil {
+		return
+	}
+
+	casper.AllowUnknownTypes(*allowUnknown)
+
+	var conf *casper.CasperConfigs
+	if conf, err = casper.ParseConfig(*config, data); err != nil {
+		return
+	}
+	printWarnings(conf)
+
+	if configHasName(conf, name) {
+		return fmt.Errorf("%s already exists in %s", name, *config)
+	}
+
+	ports := newPortAllocator(conf, *host)
+
+	var section string
+	var entry interface{}
+	switch kind {
+	case "component":
+		section = "components"
+		entry = &newComponentEntry{Name: name, MQType: "zmq", In: ports.zmqUrl()}
+	case "app":
+		var options map[string]interface{}
+		if options, err = entranceOptions(*entrance, name, *host, ports); err != nil {
+			return
+		}
+		section = "apps"
+		entry = &newAppEntry{
+			Name:     name,
+			MQType:   "zmq",
+			In:       ports.zmqUrl(),
+			Entrance: newEntranceEntry{Type: *entrance, Options: options},
+			Graphs:   map[string][]string{"ping": {"self"}}}
+	}
+
+	var newData []byte
+	if newData, err = insertConfigEntry(*config, data, section, entry); err != nil {
+		return
+	}
+
+	// the config is written only if it is still valid
+	if _, err = casper.ParseConfig(*config, newData); err != nil {
+		return fmt.Errorf("the new config is invalid, nothing is written:\n%v", err)
+	}
+
+	if *pkg == "" {
+		*pkg = packageOfDir(*dir)
+	}
+
+	var files map[string][]byte
+	if files, err = newGoFiles(name, *pkg); err != nil {
+		return
+	}
+
+	for file := range files {
+		if _, e := os.Stat(filepath.Join(*dir, file)); e == nil {
+			return fmt.Errorf("%s already exists", filepath.Join(*dir, file))
+		}
+	}
+
+	if err = writeFile(*config, newData); err != nil {
+		return
+	}
+	fmt.Printf("added %s %s to %s\n", kind, name, *config)
+
+	names := make([]string, 0, len(files))
+	for file := range files {
+		names = append(names, file)
+	}
+	sort.Strings(names)
+
+	for _, file := range names {
+		path := filepath.Join(*dir, file)
+		if err = writeFile(path, files[file]); err != nil {
+			return
+		}
+		fmt.Println("created", path)
+	}
+
+	if kind == "component" {
+		fmt.Printf("\nrun it by:\n\tcasper.BuildComponent(%q)\n\tcasper.GetComponentByName(%q).SetHandler(%s).Run()\n", *config, name, handlerName(name))
+	} else {
+		fmt.Printf("\nrun it by:\n\tcasper.BuildApp(%q)\n\tapp := casper.GetAppByName(%q)\n\tapp.SetHandler(%s)\n\tapp.Run()\n", *config, name, handlerName(name))
+	}
+	return
+}
+
+// the mode of the file is kept
+func writeFile(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode()
+	}
+	return ioutil.WriteFile(path, data, mode)
+}
+
+func configHasName(conf *casper.CasperConfigs, name string) bool {
+	for _, app := range conf.Apps {
+		if app.Name == name {
+			return true
+		}
+	}
+	for _, comp := range conf.Components {
+		if comp.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func entranceOptions(typ, name, host string, ports *portAllocator) (options map[string]interface{}, err error) {
+	switch typ {
+	case "martini", "jsonrpc":
+		port := ports.next(entranceBasePort)
+		return map[string]interface{}{"host": host, "port": port, "domain": fmt.Sprintf("%s:%d", host, port), "path": "/" + name}, nil
+	case "zmq":
+		return map[string]interface{}{"address": ports.zmqUrl()}, nil
+	case "grpc":
+		return map[string]interface{}{"address": fmt.Sprintf("%s:%d", host, ports.next(entranceBasePort))}, nil
+	case "stdio":
+		return map[string]interface{}{"input": "-", "output": "-"}, nil
+	}
+	return nil, usageError("unsupported entrance " + typ)
+}
+
+// the port allocation, the ports are not used by the config, and could be listened now
+type portAllocator struct {
+	host string
+	used map[int]bool
+}
+
+var portOfAddress = regexp.MustCompile(`:(\d+)$`)
+
+func newPortAllocator(conf *casper.CasperConfigs, host string) *portAllocator {
+	p := &portAllocator{host: host, used: map[int]bool{}}
+
+	use := func(address string) {
+		if m := portOfAddress.FindStringSubmatch(address); m != nil {
+			port, _ := strconv.Atoi(m[1])
+			p.used[port] = true
+		}
+	}
+
+	for _, comp := range conf.Components {
+		use(comp.In)
+	}
+	for _, app := range conf.Apps {
+		use(app.In)
+		for key, value := range app.Entrance.Options {
+			switch key {
+			case "address", "port":
+				use(":" + fmt.Sprint(value))
+			}
+		}
+	}
+	return p
+}
+
+func (p *portAllocator) next(base int) int {
+	for port := base; port < 65536; port++ {
+		if p.used[port] {
+			continue
+		}
+
+		l, err := net.Listen("tcp", net.JoinHostPort(p.host, strconv.Itoa(port)))
+		if err != nil {
+			continue
+		}
+		l.Close()
+
+		p.used[port] = true
+		return port
+	}
+	return 0
+}
+
+func (p *portAllocator) zmqUrl() string {
+	return fmt.Sprintf("tcp://%s:%d", p.host, p.next(mqBasePort))
+}
+
+// the package of the go files in dir, the tests are skipped
+func packageOfDir(dir string) string {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if m := regexp.MustCompile(`(?m)^package (\w+)`).FindSubmatch(data); m != nil {
+			return string(m[1])
+		}
+	}
+	return "main"
+}
+
+// e.g. user.info-get is UserInfoGet
+func exportedName(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, part := range parts {
+		parts[i] = strings.ToUpper(part[:1]) + part[1:]
+	}
+	return strings.Join(parts, "")
+}
+
+func handlerName(name string) string {
+	return exportedName(name) + "Handler"
+}
+
+// the handler and its test, by the file names, the apps have the handler of
+// the graphs of self
+func newGoFiles(name, pkg string) (files map[string][]byte, err error) {
+	params := map[string]string{
+		"Package": pkg,
+		"Name":    name,
+		"Handler": handlerName(name)}
+
+	base := strings.ToLower(strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), "_"))
+
+	templates := map[string]*template.Template{
+		base + "_handler.go":      handlerTemplate,
+		base + "_handler_test.go": handlerTestTemplate}
+
+	files = map[string][]byte{}
+	for file, tmpl := range templates {
+		var buf bytes.Buffer
+		if err = tmpl.Execute(&buf, params); err != nil {
+			return
+		}
+		if files[file], err = format.Source(buf.Bytes()); err != nil {
+			return
+		}
+	}
+	return
+}
+
+var handlerTemplate = template.Must(template.New("handler").Parse(`package {{.Package}}
+
+import (
+	"github.com/gogap/casper"
+)
+
+// {{.Handler}} handles the messages of {{.Name}}, the result is sent to the
+// next component of the graph
+func {{.Handler}}(payload *casper.Payload) (result interface{}, err error) {
+	var req map[string]interface{}
+	if err = payload.UnmarshalResult(&req); err != nil {
+		return
+	}
+
+	// TODO: the business of {{.Name}}
+
+	return req, nil
+}
+`))
+
+var handlerTestTemplate = template.Must(template.New("handler_test").Parse(`package {{.Package}}
+
+import (
+	"testing"
+
+	"github.com/gogap/casper"
+)
+
+func Test{{.Handler}}(t *testing.T) {
+	result, _, err := casper.CallHandler({{.Handler}}, map[string]interface{}{"hello": "{{.Name}}"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.(map[string]interface{})["hello"] != "{{.Name}}" {
+		t.Fatalf("unexpected result: %v", result)
+	}
+}
+`))
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// the entries are inserted into the text of the config, so the comments,
+// the order and the indents of the others are kept
+
+func emptyConfig(file string) []byte {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml", ".toml":
+		return nil
+	}
+	return []byte("{\n}\n")
+}
+
+func insertConfigEntry(file string, data []byte, section string, entry interface{}) ([]byte, error) {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return insertYamlEntry(data, section, entry)
+	case ".toml":
+		return insertTomlEntry(data, section, entry)
+	}
+	return insertJsonEntry(data, section, entry)
+}
+
+// the indent of the line of offset
+func lineIndent(data []byte, offset int) string {
+	start := bytes.LastIndexByte(data[:offset], '\n') + 1
+	end := start
+	for end < len(data) && (data[end] == ' ' || data[end] == '\t') {
+		end++
+	}
+	return string(data[start:end])
+}
+
+// the smallest indent of the lines, 4 spaces if none
+func indentUnit(data []byte) string {
+	unit := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if indent != "" && indent != line && (unit == "" || len(indent) < len(unit)) {
+			unit = indent
+		}
+	}
+	if unit == "" {
+		return "    "
+	}
+	return unit
+}
+
+func lastNonSpace(data []byte, end int) int {
+	i := end - 1
+	for i >= 0 && strings.IndexByte(" \t\r\n", data[i]) >= 0 {
+		i--
+	}
+	return i
+}
+
+func insertJsonEntry(data []byte, section string, entry interface{}) (newData []byte, err error) {
+	unit := indentUnit(data)
+
+	render := func(prefix string) string {
+		rendered, _ := json.MarshalIndent(entry, prefix, unit)
+		return string(rendered)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, e := dec.Token(); e != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("the config should be a json object")
+	}
+
+	for dec.More() {
+		var key json.Token
+		if key, err = dec.Token(); err != nil {
+			return
+		}
+
+		start := int(dec.InputOffset())
+		for start < len(data) && strings.IndexByte(" \t\r\n:", data[start]) >= 0 {
+			start++
+		}
+
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return
+		}
+
+		if key != section {
+			continue
+		} else if len(value) == 0 || value[0] != '[' {
+			return nil, fmt.Errorf("%s of the config is not an array", section)
+		}
+
+		end := int(dec.InputOffset()) - 1 // the ]
+		last := lastNonSpace(data, end)
+
+		first := start + 1
+		for first < end && strings.IndexByte(" \t\r\n", data[first]) >= 0 {
+			first++
+		}
+
+		var insert string
+		switch {
+		case first == end:
+			// [], the elements are on their own lines
+			indent := lineIndent(data, start)
+			insert = "\n" + indent + unit + render(indent+unit) + "\n" + indent
+		case bytes.IndexByte(data[start:first], '\n') >= 0:
+			// [\n{...},\n{...}\n]
+			indent := lineIndent(data, first)
+			insert = ",\n" + indent + render(indent)
+		default:
+			// [{...}, {...}], the new one is rendered as the last one is closed
+			insert = ", " + render(lineIndent(data, last))
+		}
+
+		return append(append(append([]byte{}, data[:last+1]...), insert...), data[last+1:]...), nil
+	}
+
+	// the section is added to the end of the object
+	end := bytes.LastIndexByte(data, '}')
+	last := lastNonSpace(data, end)
+
+	insert := "\n" + unit + strconv.Quote(section) + ": [\n" + unit + unit + render(unit+unit) + "\n" + unit + "]"
+	if data[last] != '{' {
+		insert = "," + insert
+	}
+	if bytes.IndexByte(data[last:end], '\n') < 0 {
+		insert += "\n"
+	}
+	return append(append(append([]byte{}, data[:last+1]...), insert...), data[last+1:]...), nil
+}
+
+var yamlTopKey = regexp.MustCompile(`^([A-Za-z0-9_]+)\s*:(.*)$`)
+
+func insertYamlEntry(data []byte, section string, entry interface{}) (newData []byte, err error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err = enc.Encode([]interface{}{entry}); err != nil {
+		return
+	}
+	enc.Close()
+
+	item := func(indent string) (lines []string) {
+		for _, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+			lines = append(lines, indent+line)
+		}
+		return
+	}
+
+	lines := strings.Split(string(data), "\n")
+
+	header, itemIndent := -1, ""
+	for i, line := range lines {
+		m := yamlTopKey.FindStringSubmatch(line)
+		if m == nil || m[1] != section {
+			continue
+		}
+
+		switch rest := strings.TrimSpace(strings.SplitN(m[2], "#", 2)[0]); rest {
+		case "":
+		case "[]":
+			lines[i] = section + ":"
+		default:
+			return nil, fmt.Errorf("%s of the config is a flow sequence, the entry could not be inserted", section)
+		}
+		header = i
+		break
+	}
+
+	if header < 0 {
+		// the sequences are indented as the others of the file
+		for _, line := range lines {
+			if trimmed := strings.TrimLeft(line, " "); strings.HasPrefix(trimmed, "- ") {
+				itemIndent = line[:len(line)-len(trimmed)]
+				break
+			}
+		}
+
+		for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+			lines = lines[:len(lines)-1]
+		}
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(append(lines, section+":"), item(itemIndent)...)
+		return []byte(strings.Join(lines, "\n") + "\n"), nil
+	}
+
+	// the block ends at the next key of the top level, the comments and the
+	// blank lines after it belong to the next one
+	last, itemIndent, found := header, "", false
+	for i := header + 1; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		} else if trimmed == line && !strings.HasPrefix(line, "- ") && line != "-" {
+			break
+		}
+
+		if !found && strings.HasPrefix(trimmed, "- ") {
+			itemIndent, found = line[:len(line)-len(trimmed)], true
+		}
+		last = i
+	}
+	if !found {
+		itemIndent = "  "
+	}
+
+	result := append(append([]string{}, lines[:last+1]...), item(itemIndent)...)
+	result = append(result, lines[last+1:]...)
+	return []byte(strings.Join(result, "\n")), nil
+}
+
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func insertTomlEntry(data []byte, section string, entry interface{}) (newData []byte, err error) {
+	if regexp.MustCompile(`(?m)^\s*` + regexp.QuoteMeta(section) + `\s*=`).Match(data) {
+		return nil, fmt.Errorf("%s of the config is an inline array, the entry could not be inserted", section)
+	}
+
+	key := func(k string) string {
+		if tomlBareKey.MatchString(k) {
+			return k
+		}
+		return strconv.Quote(k)
+	}
+
+	var value func(v interface{}) string
+	value = func(v interface{}) string {
+		switch val := v.(type) {
+		case string:
+			return strconv.Quote(val)
+		case []string:
+			values := make([]string, len(val))
+			for i := range val {
+				values[i] = value(val[i])
+			}
+			return "[" + strings.Join(values, ", ") + "]"
+		}
+		return fmt.Sprint(v)
+	}
+
+	var buf bytes.Buffer
+	table := func(values map[string]interface{}) {
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			fmt.Fprintf(&buf, "%s = %s\n", key(k), value(values[k]))
+		}
+	}
+
+	fmt.Fprintf(&buf, "[[%s]]\n", section)
+	switch e := entry.(type) {
+	case *newComponentEntry:
+		fmt.Fprintf(&buf, "name = %s\ndescription = %s\nmq_type = %s\nin = %s\n", value(e.Name), value(e.Description), value(e.MQType), value(e.In))
+	case *newAppEntry:
+		fmt.Fprintf(&buf, "name = %s\ndescription = %s\nmq_type = %s\nin = %s\n", value(e.Name), value(e.Description), value(e.MQType), value(e.In))
+		fmt.Fprintf(&buf, "\n[%s.entrance]\ntype = %s\n", section, value(e.Entrance.Type))
+		fmt.Fprintf(&buf, "\n[%s.entrance.options]\n", section)
+		table(e.Entrance.Options)
+
+		graphs := map[string]interface{}{}
+		for name, graph := range e.Graphs {
+			graphs[name] = graph
+		}
+		fmt.Fprintf(&buf, "\n[%s.graphs]\n", section)
+		table(graphs)
+	}
+
+	newData = bytes.TrimRight(data, " \t\r\n")
+	if len(newData) > 0 {
+		newData = append(newData, "\n\n"...)
+	}
+	return append(newData, buf.Bytes()...), nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestInsertConfigEntry(t *testing.T) {
+	comp := &newComponentEntry{Name: "b", Description: "new", MQType: "zmq", In: "tcp://127.0.0.1:5002"}
+	app := &newAppEntry{Name: "app", MQType: "zmq", In: "tcp://127.0.0.1:5003",
+		Entrance: newEntranceEntry{Type: "martini", Options: map[string]interface{}{"port": 8080, "host": "0.0.0.0"}},
+		Graphs:   map[string][]string{"hello": {"b"}}}
+
+	tests := []struct {
+		name    string
+		file    string
+		config  string
+		section string
+		entry   interface{}
+		result  string // empty if it fails
+	}{
+		// json
+		{"empty json", "casper.json", "{\n}\n", "components", comp, `{
+    "components": [
+        {
+            "name": "b",
+            "description": "new",
+            "mq_type": "zmq",
+            "in": "tcp://127.0.0.1:5002"
+        }
+    ]
+}
+`},
+		{"empty json array", "casper.json", "{\n  \"components\": []\n}\n", "components", comp, `{
+  "components": [
+    {
+      "name": "b",
+      "description": "new",
+      "mq_type": "zmq",
+      "in": "tcp://127.0.0.1:5002"
+    }
+  ]
+}
+`},
+		{"json array", "casper.json", "{\n  \"components\": [\n    {\"name\": \"a\"}\n  ]\n}\n", "components", comp, `{
+  "components": [
+    {"name": "a"},
+    {
+      "name": "b",
+      "description": "new",
+      "mq_type": "zmq",
+      "in": "tcp://127.0.0.1:5002"
+    }
+  ]
+}
+`},
+		{"json array of a line", "casper.json", `{"components": [{"name": "a"}]}`, "components", comp, `{"components": [{"name": "a"}, {
+    "name": "b",
+    "description": "new",
+    "mq_type": "zmq",
+    "in": "tcp://127.0.0.1:5002"
+}]}`},
+		{"json without the section", "casper.json", "{\n\t\"apps\": []\n}\n", "components", comp, "{\n\t\"apps\": [],\n\t\"components\": [\n\t\t{\n\t\t\t\"name\": \"b\",\n\t\t\t\"description\": \"new\",\n\t\t\t\"mq_type\": \"zmq\",\n\t\t\t\"in\": \"tcp://127.0.0.1:5002\"\n\t\t}\n\t]\n}\n"},
+		{"json section not an array", "casper.json", `{"components": {}}`, "components", comp, ""},
+		{"json not an object", "casper.json", `[]`, "components", comp, ""},
+
+		// yaml
+		{"empty yaml", "casper.yaml", "", "components", comp, `components:
+- name: b
+  description: new
+  mq_type: zmq
+  in: tcp://127.0.0.1:5002
+`},
+		{"yaml", "casper.yml", "# casper\ncomponents:\n  - name: a\n    in: x\n\n# the apps\napps:\n  - name: app\n", "components", comp, `# casper
+components:
+  - name: a
+    in: x
+  - name: b
+    description: new
+    mq_type: zmq
+    in: tcp://127.0.0.1:5002
+
+# the apps
+apps:
+  - name: app
+`},
+		{"empty yaml sequence", "casper.yaml", "components: []\n", "components", comp, `components:
+  - name: b
+    description: new
+    mq_type: zmq
+    in: tcp://127.0.0.1:5002
+`},
+		{"yaml without the section", "casper.yaml", "apps:\n- name: app\n", "components", comp, `apps:
+- name: app
+
+components:
+- name: b
+  description: new
+  mq_type: zmq
+  in: tcp://127.0.0.1:5002
+`},
+		{"yaml flow sequence", "casper.yaml", "components: [{name: a}]\n", "components", comp, ""},
+
+		// toml
+		{"empty toml", "casper.toml", "", "components", comp, `[[components]]
+name = "b"
+description = "new"
+mq_type = "zmq"
+in = "tcp://127.0.0.1:5002"
+`},
+		{"toml app", "casper.toml", "[[components]]\nname = \"a\"\n\n", "apps", app, `[[components]]
+name = "a"
+
+[[apps]]
+name = "app"
+description = ""
+mq_type = "zmq"
+in = "tcp://127.0.0.1:5003"
+
+[apps.entrance]
+type = "martini"
+
+[apps.entrance.options]
+host = "0.0.0.0"
+port = 8080
+
+[apps.graphs]
+hello = ["b"]
+`},
+		{"toml inline array", "casper.toml", "components = []\n", "components", comp, ""},
+	}
+
+	for _, test := range tests {
+		data, err := insertConfigEntry(test.file, []byte(test.config), test.section, test.entry)
+		if test.result == "" {
+			if err == nil {
+				t.Errorf("%s: the entry is inserted: %s", test.name, data)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if string(data) != test.result {
+			t.Errorf("%s: inserted as\n%s\nnot\n%s", test.name, data, test.result)
+		}
+	}
+}
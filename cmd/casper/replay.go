@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gogap/casper"
+	"github.com/gogap/casper/client"
+)
+
+func init() {
+	registerCommand("replay", "--file <recordings> --app-addr <addr> [flags]",
+		"send the recorded requests again and compare the replies", runReplay)
+}
+
+const maxRecordingSize = 64 * 1024 * 1024
+
+// a difference between the replies
+type replyDiff struct {
+	path     string
+	recorded interface{}
+	replayed interface{}
+	missing  string // "recorded" or "replayed" if the value is only in one of them
+}
+
+func runReplay(args []string) (err error) {
+	fs := newFlagSet("replay")
+	file := fs.String("file", "", "the recordings of the record option of the entrance")
+	addr := fs.String("app-addr", "", "the entrance, tcp://... for zmq, http://... for http")
+	api := fs.String("api", "", "replay the recordings of the api only")
+	timeout := fs.Duration("timeout", casper.REQ_TIMEOUT, "the timeout of each request")
+	apiHeader := fs.String("api-header", casper.DefaultAPIHeader, "the api header of http")
+	ignore := fs.String("ignore", "", "the paths not compared, separated by comma, e.g. result.updated_at,message")
+
+	if args, err = parseFlags(fs, args); err != nil {
+		return
+	} else if len(args) > 0 {
+		return usageError("unexpected argument " + args[0])
+	} else if *file == "" || *addr == "" {
+		return usageError("--file and --app-addr are required")
+	}
+
+	var ignored []string
+	for _, path := range strings.Split(*ignore, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			ignored = append(ignored, path)
+		}
+	}
+
+	var f *os.File
+	if f, err = os.Open(*file); err != nil {
+		return
+	}
+	defer f.Close()
+
+	isHTTP := strings.HasPrefix(*addr, "http://") || strings.HasPrefix(*addr, "https://")
+
+	var transport client.Transport
+	if isHTTP {
+		transport = client.NewHTTPTransport(*addr, nil).SetAPIHeader(*apiHeader)
+	} else {
+		transport = client.NewZMQTransport(*addr, 1)
+	}
+	defer transport.Close()
+
+	color := isTerminal(os.Stdout)
+	total, same, differ, failed, skipped := 0, 0, 0, 0, 0
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxRecordingSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		recording := &casper.Recording{}
+		if e := json.Unmarshal(scanner.Bytes(), recording); e != nil {
+			return fmt.Errorf("%s:%d: %v", *file, line, e)
+		}
+
+		if *api != "" && recording.Api != *api {
+			continue
+		}
+		total++
+
+		// the requests rejected before the message is made, and the async
+		// ones, whose replies are the ids of the invocations
+		if len(recording.Request) == 0 || recording.Async {
+			skipped++
+			fmt.Printf("%s %s:%d %s\n", paint("SKIP", yellow, color), *file, line, recording.Api)
+			continue
+		}
+
+		var req *client.Request
+		if req, err = replayRequest(recording, *apiHeader); err != nil {
+			return fmt.Errorf("%s:%d: %v", *file, line, err)
+		}
+
+		// the http entrance has no context, the reply would differ
+		if isHTTP && len(req.Context) > 0 {
+			keys := make([]string, 0, len(req.Context))
+			for key := range req.Context {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			failed++
+			fmt.Printf("%s %s:%d %s: the context %s could not be sent over http, replay it by a zmq address\n",
+				paint("FAIL", red, color), *file, line, recording.Api, strings.Join(keys, ", "))
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		start := time.Now()
+		reply, e := transport.RoundTrip(ctx, req)
+		elapsed := time.Since(start)
+		cancel()
+
+		title := fmt.Sprintf("%s:%d %s (%dms -> %dms)", *file, line, recording.Api, recording.Elapsed, elapsed/time.Millisecond)
+		if e != nil {
+			failed++
+			fmt.Printf("%s %s: %v\n", paint("FAIL", red, color), title, e)
+			continue
+		}
+
+		diffs := diffReplies(recording.Reply, reply, ignored)
+		if len(diffs) == 0 {
+			same++
+			fmt.Printf("%s %s\n", paint("SAME", green, color), title)
+			continue
+		}
+
+		differ++
+		fmt.Printf("%s %s\n", paint("DIFF", yellow, color), title)
+		for _, diff := range diffs {
+			printDiff(diff, color)
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return
+	}
+
+	fmt.Printf("\n%d replayed, %d same, %d different, %d failed, %d skipped\n", total, same, differ, failed, skipped)
+	if differ+failed > 0 {
+		return fmt.Errorf("%d replies are different, %d requests failed", differ, failed)
+	}
+	return
+}
+
+// the headers and the cookies of the entrance are sent as they were, the
+// redacted values are sent as casper.REDACTED, the context keys filled by
+// the entrance are filled again by it, so they are not sent
+func replayRequest(recording *casper.Recording, apiHeader string) (req *client.Request, err error) {
+	var msg *casper.ComponentMessage
+	if msg, err = recording.Message(); err != nil {
+		return
+	}
+
+	headers := msg.Headers()
+	req = &client.Request{
+		Api:     recording.Api,
+		Body:    msg.Payload.GetResult(),
+		Headers: map[string]string{},
+		Context: msg.Payload.GetContexts()}
+
+	for _, key := range []string{casper.REQ_X_API, apiHeader, casper.CTX_HTTP_COOKIES, casper.CTX_HTTP_HEADERS} {
+		delete(req.Context, key)
+	}
+
+	for name, value := range headers.HTTPHeaders {
+		req.Headers[name] = value
+	}
+
+	var cookies []string
+	for name, value := range headers.Cookies {
+		cookies = append(cookies, name+"="+value)
+	}
+	if len(cookies) > 0 {
+		sort.Strings(cookies)
+		req.Headers["Cookie"] = strings.Join(cookies, "; ")
+	}
+	return
+}
+
+func diffReplies(recorded casper.RecordedReply, replayed *client.Reply, ignored []string) (diffs []replyDiff) {
+	decode := func(data []byte) (v interface{}) {
+		if len(data) > 0 {
+			dec := json.NewDecoder(bytes.NewReader(data))
+			dec.UseNumber()
+			dec.Decode(&v)
+		}
+		return
+	}
+
+	a := map[string]interface{}{"code": json.Number(fmt.Sprint(recorded.Code)), "message": recorded.Message, "result": decode(recorded.Result)}
+	b := map[string]interface{}{"code": json.Number(fmt.Sprint(replayed.Code)), "message": replayed.Message, "result": decode(replayed.Result)}
+
+	diffValues("", a, b, ignored, &diffs)
+	return
+}
+
+func diffValues(path string, a, b interface{}, ignored []string, diffs *[]replyDiff) {
+	for _, prefix := range ignored {
+		if path == prefix || strings.HasPrefix(path, prefix+".") || strings.HasPrefix(path, prefix+"[") {
+			return
+		}
+	}
+
+	// the recorded value is unknown
+	if a == casper.REDACTED {
+		return
+	}
+
+	mapA, okA := a.(map[string]interface{})
+	mapB, okB := b.(map[string]interface{})
+	if okA && okB {
+		keys := map[string]bool{}
+		for key := range mapA {
+			keys[key] = true
+		}
+		for key := range mapB {
+			keys[key] = true
+		}
+
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+
+		for _, key := range sorted {
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+
+			valueA, existA := mapA[key]
+			valueB, existB := mapB[key]
+			switch {
+			case !existA:
+				*diffs = append(*diffs, replyDiff{path: keyPath, replayed: valueB, missing: "recorded"})
+			case !existB:
+				*diffs = append(*diffs, replyDiff{path: keyPath, recorded: valueA, missing: "replayed"})
+			default:
+				diffValues(keyPath, valueA, valueB, ignored, diffs)
+			}
+		}
+		return
+	}
+
+	sliceA, okA := a.([]interface{})
+	sliceB, okB := b.([]interface{})
+	if okA && okB && len(sliceA) == len(sliceB) {
+		for i := range sliceA {
+			diffValues(fmt.Sprintf("%s[%d]", path, i), sliceA[i], sliceB[i], ignored, diffs)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*diffs = append(*diffs, replyDiff{path: path, recorded: a, replayed: b})
+	}
+}
+
+func printDiff(diff replyDiff, color bool) {
+	value := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+
+	recorded, replayed := value(diff.recorded), value(diff.replayed)
+	switch diff.missing {
+	case "recorded":
+		recorded = "(missing)"
+	case "replayed":
+		replayed = "(missing)"
+	}
+
+	fmt.Printf("    %s\n", paint("- "+diff.path+": "+recorded, red, color))
+	fmt.Printf("    %s\n", paint("+ "+diff.path+": "+replayed, green, color))
+}
+
+const (
+	red    = "31"
+	green  = "32"
+	yellow = "33"
+)
+
+func paint(s, color string, enabled bool) string {
+	if !enabled {
+		return s
+	}
+	return "\x1b[" + color + "m" + s + "\x1b[0m"
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gogap/casper"
+)
+
+func TestReplayRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		contexts map[string]interface{}
+		expected map[string]interface{}
+	}{
+		{"entrance keys", map[string]interface{}{
+			casper.REQ_X_API:        "g",
+			"X-Api-Name":            "g",
+			casper.CTX_HTTP_COOKIES: map[string]interface{}{"session": "1"},
+			casper.CTX_HTTP_HEADERS: map[string]interface{}{"X-Id": "1"},
+		}, map[string]interface{}{}},
+		{"user keys", map[string]interface{}{
+			casper.REQ_X_API: "g",
+			"user_id":        "1",
+		}, map[string]interface{}{"user_id": "1"}},
+	}
+
+	for _, test := range tests {
+		msg, _ := casper.NewComponentMessage(nil, map[string]interface{}{"hello": "replay"})
+		for key, value := range test.contexts {
+			msg.Payload.SetContext(key, value)
+		}
+		msg.Headers().HTTPHeaders = map[string]string{"X-Id": "1"}
+		msg.Headers().Cookies = map[string]string{"session": "1", "lang": "en"}
+
+		data, err := msg.Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := replayRequest(&casper.Recording{Api: "g", Request: data}, "X-Api-Name")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(req.Context, test.expected) {
+			t.Errorf("%s: the context is %v, not %v", test.name, req.Context, test.expected)
+		}
+		if req.Api != "g" || req.Headers["X-Id"] != "1" || req.Headers["Cookie"] != "lang=en; session=1" {
+			t.Errorf("%s: the request is %+v", test.name, req)
+		}
+	}
+}
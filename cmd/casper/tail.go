@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	zmq "github.com/pebbe/zmq4"
+
+	"github.com/gogap/casper"
+)
+
+func init() {
+	registerCommand("tail", "--tap <addr> [flags]",
+		"print the messages published to the tap of the components", runTail)
+}
+
+// the events printed, the empty ones match all
+type tailFilter struct {
+	api       string
+	component string
+	id        string
+	code      int64 // -1 matches all
+	errors    bool  // the non-zero codes only
+	direction string
+}
+
+func (p *tailFilter) match(event *casper.TapEvent) bool {
+	switch {
+	case p.api != "" && event.Api != p.api:
+	case p.component != "" && event.Component != p.component:
+	case p.id != "" && event.Id != p.id:
+	case p.code >= 0 && event.Code != uint64(p.code):
+	case p.errors && event.Code == 0:
+	case p.direction != "" && event.Direction != p.direction:
+	default:
+		return true
+	}
+	return false
+}
+
+func runTail(args []string) (err error) {
+	fs := newFlagSet("tail")
+	addr := fs.String("tap", "", "the tap option of the components, e.g. tcp://127.0.0.1:7777")
+	filter := tailFilter{}
+	fs.StringVar(&filter.api, "api", "", "the api of the messages")
+	fs.StringVar(&filter.component, "component", "", "the component which published the messages")
+	fs.StringVar(&filter.id, "id", "", "the id of the message")
+	fs.Int64Var(&filter.code, "code", -1, "the code of the payloads")
+	fs.BoolVar(&filter.errors, "errors", false, "the messages with the non-zero codes only")
+	fs.StringVar(&filter.direction, "direction", "", "received or sent")
+	full := fs.Bool("full", false, "print the whole messages")
+	raw := fs.Bool("raw", false, "print the events as json lines")
+
+	if args, err = parseFlags(fs, args); err != nil {
+		return
+	} else if len(args) > 0 {
+		return usageError("unexpected argument " + args[0])
+	} else if *addr == "" {
+		return usageError("--tap is required")
+	}
+
+	var socket *zmq.Socket
+	if socket, err = zmq.NewSocket(zmq.SUB); err != nil {
+		return
+	}
+	defer socket.Close()
+
+	if err = socket.Connect(*addr); err != nil {
+		return
+	}
+
+	// the topic is the component, the others are filtered here
+	if err = socket.SetSubscribe(filter.component); err != nil {
+		return
+	}
+
+	for {
+		var frames [][]byte
+		if frames, err = socket.RecvMessageBytes(0); err != nil {
+			return
+		}
+
+		if len(frames) != 2 {
+			continue
+		}
+
+		event := &casper.TapEvent{}
+		if e := json.Unmarshal(frames[1], event); e != nil {
+			fmt.Fprintln(os.Stderr, "invalid event:", e)
+			continue
+		}
+
+		if filter.match(event) {
+			printEvent(event, *full, *raw, frames[1])
+		}
+	}
+}
+
+func printEvent(event *casper.TapEvent, full, raw bool, data []byte) {
+	if raw {
+		fmt.Println(string(data))
+		return
+	}
+
+	direction := "<-"
+	peer := ""
+	if event.Direction == casper.TAP_SENT {
+		direction, peer = "->", " "+event.To
+	}
+
+	line := fmt.Sprintf("%s %-16s %s%s %s id=%s code=%d", event.At.Format("15:04:05.000"), event.Component, direction, peer, orDefault(event.Api, "-"), event.Id, event.Code)
+	fmt.Println(line)
+
+	if !full {
+		return
+	}
+
+	var indented bytes.Buffer
+	if json.Indent(&indented, event.Message, "    ", "  ") == nil {
+		fmt.Println("    " + strings.TrimSpace(indented.String()))
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gogap/casper"
+)
+
+func init() {
+	registerCommand("validate", "<conf> [overlay...]", "check the configs, all the mistakes are printed", runValidate)
+}
+
+func runValidate(args []string) (err error) {
+	fs := newFlagSet("validate")
+	allowUnknown := allowUnknownFlag(fs)
+	if args, err = parseFlags(fs, args); err != nil {
+		return
+	}
+
+	var files []string
+	if files, err = configFiles(args); err != nil {
+		return
+	}
+
+	var conf *casper.CasperConfigs
+	if conf, err = loadConfigs(files, *allowUnknown); err != nil {
+		return
+	}
+
+	fmt.Printf("ok, %d apps, %d components\n", len(conf.Apps), len(conf.Components))
+	return
+}
@@ -0,0 +1,224 @@
+package casper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gogap/errors"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+// the id is in the zmq frame header next to componentPacket
+const (
+	CODEC_JSON     byte = 0x00
+	CODEC_MSGPACK  byte = 0x01
+	CODEC_PROTOBUF byte = 0x02
+)
+
+var (
+	codecs     map[string]Codec = make(map[string]Codec)
+	codecsById map[byte]Codec   = make(map[byte]Codec)
+)
+
+// the message codecs
+//
+// the codec of a component is the one it wants to receive, senders encode
+// the message with the codec of the next component, receivers decode by the
+// codec id in the packet, so a component without codec (json) could still
+// talk to the old versions
+type Codec interface {
+	Id() byte
+	Name() string
+	Marshal(msg *ComponentMessage) ([]byte, error)
+	Unmarshal(data []byte, msg *ComponentMessage) error
+}
+
+// the version of the envelope, the messages without version are version 0
+//
+// compatibility rules:
+//   - a new version only adds optional fields, receivers use the zero value
+//     if a field is missing, so the old messages are still valid
+//   - receivers ignore the fields they do not know, so the newer messages
+//     are decoded as far as they are understood
+//   - a field is never removed, renamed or retyped, if it has to be, it is a
+//     breaking change, fromEnvelope rejects the older messages with
+//     ERR_ENVELOPE_VERSION_UNSUPPORTED, every version is accepted so far
+//   - the golden messages of every version are in testdata/envelope
+//
+// versions:
+//   - 1: version
+//   - 2: headers
+//   - 3: hops
+//   - 4: result_ref and blobs of the payload
+const (
+	ENVELOPE_VERSION = 4
+)
+
+// the layout of ComponentMessage on the wire
+type messageEnvelope struct {
+	Version  int                  `json:"version"`
+	Id       string               `json:"id"`
+	Entrance *ComponentMetadata   `json:"entrance"`
+	Graph    []*ComponentMetadata `json:"graph"`
+	Chain    []string             `json:"chain"`
+	Headers  Headers              `json:"headers"`
+	Hops     []*Hop               `json:"hops"`
+	Payload  payloadEnvelope      `json:"payload"`
+}
+
+type payloadEnvelope struct {
+	Code    uint64            `json:"code"`
+	Message string            `json:"message"`
+	Context componentContext  `json:"context"`
+	Command componentCommands `json:"command"`
+	Result  interface{}       `json:"result"`
+
+	ResultRef string   `json:"result_ref,omitempty"`
+	Blobs     []string `json:"blobs,omitempty"`
+}
+
+func init() {
+	RegisterCodec(new(jsonCodec))
+}
+
+func RegisterCodec(codec Codec) {
+	if codec == nil {
+		panic("Register Codec nil")
+	}
+	if _, dup := codecs[codec.Name()]; dup {
+		panic("Register Codec duplicate for " + codec.Name())
+	}
+	if _, dup := codecsById[codec.Id()]; dup {
+		panic(fmt.Sprintf("Register Codec duplicate id %d for %s", codec.Id(), codec.Name()))
+	}
+	codecs[codec.Name()] = codec
+	codecsById[codec.Id()] = codec
+}
+
+// the empty name is json
+func GetCodec(name string) (codec Codec, err error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "json"
+	}
+
+	if c, exist := codecs[name]; exist {
+		return c, nil
+	}
+
+	err = errorcode.ERR_CODEC_NOT_EXIST.New(errors.Params{"codec": name})
+	return
+}
+
+func GetCodecById(id byte) (codec Codec, err error) {
+	if c, exist := codecsById[id]; exist {
+		return c, nil
+	}
+
+	err = errorcode.ERR_CODEC_NOT_EXIST.New(errors.Params{"codec": id})
+	return
+}
+
+func EncodePacket(codecName string, comMsg *ComponentMessage) (packet *Packet, err error) {
+	var codec Codec
+	if codec, err = GetCodec(codecName); err != nil {
+		return
+	}
+
+	var data []byte
+	if data, err = codec.Marshal(comMsg); err != nil {
+		return
+	}
+
+	return &Packet{Codec: codec.Id(), Message: data}, nil
+}
+
+// the packet is decompressed first if it is compressed, up to
+// DefaultMaxMessageSize, decompress it before to have another limit
+func DecodePacket(packet *Packet, comMsg *ComponentMessage) (err error) {
+	if err = packet.Decompress(0); err != nil {
+		return
+	}
+
+	var codec Codec
+	if codec, err = GetCodecById(packet.Codec); err != nil {
+		return
+	}
+
+	return codec.Unmarshal(packet.Message, comMsg)
+}
+
+func (p *ComponentMessage) envelope() *messageEnvelope {
+	tmp := &messageEnvelope{}
+	tmp.Version = ENVELOPE_VERSION
+	tmp.Id = p.Id
+	tmp.Entrance = p.entrance
+	tmp.Graph = p.graph
+	tmp.Chain = p.chain
+	if p.Payload != nil {
+		tmp.Headers = p.Payload.headers
+		tmp.Hops = p.Payload.hops
+		tmp.Payload.Code = p.Payload.Code
+		tmp.Payload.Message = p.Payload.Message
+		tmp.Payload.Context = p.Payload.context
+		tmp.Payload.Command = p.Payload.command
+		tmp.Payload.Result = p.Payload.result
+		tmp.Payload.ResultRef = p.Payload.resultRef
+		tmp.Payload.Blobs = p.Payload.blobs
+		if p.Payload.resultRef != "" {
+			// the cached result of the blob is not sent
+			tmp.Payload.Result = nil
+		}
+	}
+	return tmp
+}
+
+func (p *ComponentMessage) fromEnvelope(tmp *messageEnvelope) (err error) {
+	p.version = tmp.Version
+	p.Id = tmp.Id
+	p.entrance = tmp.Entrance
+	p.graph = tmp.Graph
+	p.chain = tmp.Chain
+	p.Payload = &Payload{
+		Code:    tmp.Payload.Code,
+		Message: tmp.Payload.Message,
+		context: tmp.Payload.Context,
+		command: tmp.Payload.Command,
+		result:  tmp.Payload.Result,
+		headers: tmp.Headers,
+		hops:    tmp.Hops,
+
+		resultRef: tmp.Payload.ResultRef,
+		blobs:     tmp.Payload.Blobs}
+	return
+}
+
+type jsonCodec struct{}
+
+func (p *jsonCodec) Id() byte {
+	return CODEC_JSON
+}
+
+func (p *jsonCodec) Name() string {
+	return "json"
+}
+
+func (p *jsonCodec) Marshal(msg *ComponentMessage) ([]byte, error) {
+	return json.Marshal(msg.envelope())
+}
+
+// the numbers of the result and the commands are json.Number as the ones of
+// the context, so an int64 result is still an int64 on the next component
+func (p *jsonCodec) Unmarshal(data []byte, msg *ComponentMessage) (err error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	tmp := &messageEnvelope{}
+	if err = decoder.Decode(tmp); err != nil {
+		return
+	}
+	return msg.fromEnvelope(tmp)
+}
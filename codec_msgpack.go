@@ -0,0 +1,49 @@
+package casper
+
+import (
+	"bytes"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// the same layout as json, the field names are taken from the json tags
+type msgpackCodec struct{}
+
+func init() {
+	RegisterCodec(new(msgpackCodec))
+}
+
+func (p *msgpackCodec) Id() byte {
+	return CODEC_MSGPACK
+}
+
+func (p *msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (p *msgpackCodec) Marshal(msg *ComponentMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.SetSortMapKeys(true)
+
+	tmp := msg.envelope()
+	tmp.Payload.Context = tmp.Payload.Context.withNativeNumbers()
+	tmp.Payload.Command = tmp.Payload.Command.withNativeNumbers()
+	tmp.Payload.Result = nativeNumbers(tmp.Payload.Result)
+	if err := enc.Encode(tmp); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (p *msgpackCodec) Unmarshal(data []byte, msg *ComponentMessage) (err error) {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+
+	tmp := &messageEnvelope{}
+	if err = dec.Decode(tmp); err != nil {
+		return
+	}
+	return msg.fromEnvelope(tmp)
+}
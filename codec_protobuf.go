@@ -0,0 +1,634 @@
+package casper
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// the envelope is ComponentMessage of proto/casper.proto, context, command
+// and result are Value messages, like google.protobuf.Value but the integers
+// are int64 or uint64, a Struct would have double numbers only, the int64 of
+// the contexts would lose their precision, see contextInt64
+//
+// the values are decoded as the json codec does, but the integers are int64
+// or uint64 and the floats are float64, the values other than the json types
+// are encoded as their json
+type protobufCodec struct{}
+
+func init() {
+	RegisterCodec(new(protobufCodec))
+}
+
+func (p *protobufCodec) Id() byte {
+	return CODEC_PROTOBUF
+}
+
+func (p *protobufCodec) Name() string {
+	return "protobuf"
+}
+
+func (p *protobufCodec) Marshal(msg *ComponentMessage) (data []byte, err error) {
+	tmp := msg.envelope()
+
+	data = protowire.AppendTag(data, 6, protowire.VarintType)
+	data = protowire.AppendVarint(data, uint64(tmp.Version))
+	data = appendWireString(data, 1, tmp.Id)
+	if tmp.Entrance != nil {
+		data = protowire.AppendTag(data, 2, protowire.BytesType)
+		data = protowire.AppendBytes(data, marshalWireMetadata(tmp.Entrance))
+	}
+	for _, meta := range tmp.Graph {
+		if meta != nil {
+			data = protowire.AppendTag(data, 3, protowire.BytesType)
+			data = protowire.AppendBytes(data, marshalWireMetadata(meta))
+		}
+	}
+	for _, in := range tmp.Chain {
+		data = protowire.AppendTag(data, 4, protowire.BytesType)
+		data = protowire.AppendString(data, in)
+	}
+	if headers := marshalWireHeaders(&tmp.Headers); len(headers) > 0 {
+		data = protowire.AppendTag(data, 7, protowire.BytesType)
+		data = protowire.AppendBytes(data, headers)
+	}
+	for _, hop := range tmp.Hops {
+		if hop != nil {
+			data = protowire.AppendTag(data, 8, protowire.BytesType)
+			data = protowire.AppendBytes(data, marshalWireHop(hop))
+		}
+	}
+
+	var payload []byte
+	if tmp.Payload.Code != 0 {
+		payload = protowire.AppendTag(payload, 1, protowire.VarintType)
+		payload = protowire.AppendVarint(payload, tmp.Payload.Code)
+	}
+	payload = appendWireString(payload, 2, tmp.Payload.Message)
+	for _, key := range sortedKeys(tmp.Payload.Context) {
+		if payload, err = appendWireValueEntry(payload, 3, key, tmp.Payload.Context[key]); err != nil {
+			return
+		}
+	}
+	for _, key := range sortedCommandKeys(tmp.Payload.Command) {
+		if payload, err = appendWireValueEntry(payload, 4, key, tmp.Payload.Command[key]); err != nil {
+			return
+		}
+	}
+	if tmp.Payload.Result != nil {
+		var result []byte
+		if result, err = marshalWireValue(tmp.Payload.Result); err != nil {
+			return
+		}
+		payload = protowire.AppendTag(payload, 5, protowire.BytesType)
+		payload = protowire.AppendBytes(payload, result)
+	}
+	payload = appendWireString(payload, 6, tmp.Payload.ResultRef)
+	for _, key := range tmp.Payload.Blobs {
+		payload = protowire.AppendTag(payload, 7, protowire.BytesType)
+		payload = protowire.AppendString(payload, key)
+	}
+
+	data = protowire.AppendTag(data, 5, protowire.BytesType)
+	data = protowire.AppendBytes(data, payload)
+
+	return
+}
+
+func (p *protobufCodec) Unmarshal(data []byte, msg *ComponentMessage) (err error) {
+	tmp := &messageEnvelope{}
+
+	err = consumeWireFields(data, func(num protowire.Number, typ protowire.Type, data []byte) (n int, err error) {
+		if num == 6 && typ == protowire.VarintType {
+			var v uint64
+			if v, n = protowire.ConsumeVarint(data); n >= 0 {
+				tmp.Version = int(v)
+			}
+			return
+		}
+
+		if typ != protowire.BytesType {
+			return protowire.ConsumeFieldValue(num, typ, data), nil
+		}
+
+		switch num {
+		case 1:
+			return consumeWireString(data, &tmp.Id)
+		case 2:
+			tmp.Entrance = new(ComponentMetadata)
+			return consumeWireMetadata(data, tmp.Entrance)
+		case 3:
+			meta := new(ComponentMetadata)
+			n, err = consumeWireMetadata(data, meta)
+			tmp.Graph = append(tmp.Graph, meta)
+			return
+		case 4:
+			in := ""
+			n, err = consumeWireString(data, &in)
+			tmp.Chain = append(tmp.Chain, in)
+			return
+		case 7:
+			return consumeWireHeaders(data, &tmp.Headers)
+		case 8:
+			hop := new(Hop)
+			n, err = consumeWireHop(data, hop)
+			tmp.Hops = append(tmp.Hops, hop)
+			return
+		case 5:
+			var payload []byte
+			if payload, n = protowire.ConsumeBytes(data); n < 0 {
+				return
+			}
+			err = consumeWireFields(payload, func(num protowire.Number, typ protowire.Type, data []byte) (n int, err error) {
+				switch {
+				case num == 1 && typ == protowire.VarintType:
+					var v uint64
+					if v, n = protowire.ConsumeVarint(data); n >= 0 {
+						tmp.Payload.Code = v
+					}
+					return
+				case num == 2 && typ == protowire.BytesType:
+					return consumeWireString(data, &tmp.Payload.Message)
+				case num == 3 && typ == protowire.BytesType:
+					if tmp.Payload.Context == nil {
+						tmp.Payload.Context = componentContext{}
+					}
+					key, value := "", interface{}(nil)
+					n, err = consumeWireValueEntry(data, &key, &value)
+					tmp.Payload.Context[key] = value
+					return
+				case num == 4 && typ == protowire.BytesType:
+					if tmp.Payload.Command == nil {
+						tmp.Payload.Command = componentCommands{}
+					}
+					key, value := "", interface{}(nil)
+					n, err = consumeWireValueEntry(data, &key, &value)
+					values, _ := value.([]interface{})
+					tmp.Payload.Command[key] = values
+					return
+				case num == 5 && typ == protowire.BytesType:
+					return consumeWireValue(data, &tmp.Payload.Result)
+				case num == 6 && typ == protowire.BytesType:
+					return consumeWireString(data, &tmp.Payload.ResultRef)
+				case num == 7 && typ == protowire.BytesType:
+					key := ""
+					n, err = consumeWireString(data, &key)
+					tmp.Payload.Blobs = append(tmp.Payload.Blobs, key)
+					return
+				}
+				return protowire.ConsumeFieldValue(num, typ, data), nil
+			})
+			return
+		}
+		return protowire.ConsumeFieldValue(num, typ, data), nil
+	})
+
+	if err != nil {
+		return
+	}
+
+	return msg.fromEnvelope(tmp)
+}
+
+func marshalWireMetadata(meta *ComponentMetadata) (data []byte) {
+	data = appendWireString(data, 1, meta.Name)
+	data = appendWireString(data, 2, meta.MQType)
+	data = appendWireString(data, 3, meta.In)
+	data = appendWireString(data, 4, meta.Codec)
+	data = appendWireString(data, 5, meta.Compression)
+	data = appendWireInt(data, 6, meta.CompressThreshold)
+	data = appendWireInt(data, 7, meta.MaxMessageSize)
+	data = appendWireInt(data, 8, meta.MaxContextEntries)
+	data = appendWireInt(data, 9, meta.MaxCommandEntries)
+	return
+}
+
+func consumeWireMetadata(data []byte, meta *ComponentMetadata) (n int, err error) {
+	var entry []byte
+	if entry, n = protowire.ConsumeBytes(data); n < 0 {
+		return
+	}
+
+	err = consumeWireFields(entry, func(num protowire.Number, typ protowire.Type, data []byte) (n int, err error) {
+		if typ == protowire.VarintType {
+			var v uint64
+			if v, n = protowire.ConsumeVarint(data); n < 0 {
+				return
+			}
+			switch num {
+			case 6:
+				meta.CompressThreshold = int(v)
+			case 7:
+				meta.MaxMessageSize = int(v)
+			case 8:
+				meta.MaxContextEntries = int(v)
+			case 9:
+				meta.MaxCommandEntries = int(v)
+			}
+			return
+		}
+
+		if typ == protowire.BytesType {
+			switch num {
+			case 1:
+				return consumeWireString(data, &meta.Name)
+			case 2:
+				return consumeWireString(data, &meta.MQType)
+			case 3:
+				return consumeWireString(data, &meta.In)
+			case 4:
+				return consumeWireString(data, &meta.Codec)
+			case 5:
+				return consumeWireString(data, &meta.Compression)
+			}
+		}
+		return protowire.ConsumeFieldValue(num, typ, data), nil
+	})
+	return
+}
+
+func marshalWireHeaders(headers *Headers) (data []byte) {
+	data = appendWireString(data, 1, headers.Api)
+	data = appendWireString(data, 2, headers.Entrance)
+	data = appendWireString(data, 3, headers.TraceId)
+	data = appendWireString(data, 4, headers.SpanId)
+	data = appendWireString(data, 5, headers.Tenant)
+	if headers.Attempt != 0 {
+		data = protowire.AppendTag(data, 6, protowire.VarintType)
+		data = protowire.AppendVarint(data, uint64(headers.Attempt))
+	}
+	data = appendWireTime(data, 7, headers.Deadline)
+	data = appendWireTime(data, 8, headers.CreatedAt)
+	data = appendWireMap(data, 9, headers.Cookies)
+	data = appendWireMap(data, 10, headers.HTTPHeaders)
+	return
+}
+
+func consumeWireHeaders(data []byte, headers *Headers) (n int, err error) {
+	var entry []byte
+	if entry, n = protowire.ConsumeBytes(data); n < 0 {
+		return
+	}
+
+	err = consumeWireFields(entry, func(num protowire.Number, typ protowire.Type, data []byte) (n int, err error) {
+		if typ == protowire.VarintType {
+			var v uint64
+			if v, n = protowire.ConsumeVarint(data); n < 0 {
+				return
+			}
+			switch num {
+			case 6:
+				headers.Attempt = int(v)
+			case 7:
+				headers.Deadline = time.Unix(0, int64(v))
+			case 8:
+				headers.CreatedAt = time.Unix(0, int64(v))
+			}
+			return
+		}
+
+		if typ == protowire.BytesType {
+			switch num {
+			case 1:
+				return consumeWireString(data, &headers.Api)
+			case 2:
+				return consumeWireString(data, &headers.Entrance)
+			case 3:
+				return consumeWireString(data, &headers.TraceId)
+			case 4:
+				return consumeWireString(data, &headers.SpanId)
+			case 5:
+				return consumeWireString(data, &headers.Tenant)
+			case 9:
+				if headers.Cookies == nil {
+					headers.Cookies = map[string]string{}
+				}
+				return consumeWireMapEntry(data, headers.Cookies)
+			case 10:
+				if headers.HTTPHeaders == nil {
+					headers.HTTPHeaders = map[string]string{}
+				}
+				return consumeWireMapEntry(data, headers.HTTPHeaders)
+			}
+		}
+		return protowire.ConsumeFieldValue(num, typ, data), nil
+	})
+	return
+}
+
+func marshalWireHop(hop *Hop) (data []byte) {
+	data = appendWireString(data, 1, hop.Component)
+	data = appendWireString(data, 2, hop.In)
+	data = appendWireString(data, 3, hop.Instance)
+	data = appendWireString(data, 4, hop.Host)
+	data = appendWireTime(data, 5, hop.ReceivedAt)
+	data = appendWireTime(data, 6, hop.HandledAt)
+	data = appendWireTime(data, 7, hop.SentAt)
+	data = appendWireString(data, 8, hop.Outcome)
+	if hop.Code != 0 {
+		data = protowire.AppendTag(data, 9, protowire.VarintType)
+		data = protowire.AppendVarint(data, hop.Code)
+	}
+	return
+}
+
+func consumeWireHop(data []byte, hop *Hop) (n int, err error) {
+	var entry []byte
+	if entry, n = protowire.ConsumeBytes(data); n < 0 {
+		return
+	}
+
+	err = consumeWireFields(entry, func(num protowire.Number, typ protowire.Type, data []byte) (n int, err error) {
+		if typ == protowire.VarintType {
+			var v uint64
+			if v, n = protowire.ConsumeVarint(data); n < 0 {
+				return
+			}
+			switch num {
+			case 5:
+				hop.ReceivedAt = time.Unix(0, int64(v))
+			case 6:
+				hop.HandledAt = time.Unix(0, int64(v))
+			case 7:
+				hop.SentAt = time.Unix(0, int64(v))
+			case 9:
+				hop.Code = v
+			}
+			return
+		}
+
+		if typ == protowire.BytesType {
+			switch num {
+			case 1:
+				return consumeWireString(data, &hop.Component)
+			case 2:
+				return consumeWireString(data, &hop.In)
+			case 3:
+				return consumeWireString(data, &hop.Instance)
+			case 4:
+				return consumeWireString(data, &hop.Host)
+			case 8:
+				return consumeWireString(data, &hop.Outcome)
+			}
+		}
+		return protowire.ConsumeFieldValue(num, typ, data), nil
+	})
+	return
+}
+
+// the zero and the negative values are omitted
+func appendWireInt(data []byte, num protowire.Number, v int) []byte {
+	if v <= 0 {
+		return data
+	}
+	data = protowire.AppendTag(data, num, protowire.VarintType)
+	return protowire.AppendVarint(data, uint64(v))
+}
+
+// unix nanoseconds, the zero time is omitted
+func appendWireTime(data []byte, num protowire.Number, t time.Time) []byte {
+	if t.IsZero() {
+		return data
+	}
+	data = protowire.AppendTag(data, num, protowire.VarintType)
+	return protowire.AppendVarint(data, uint64(t.UnixNano()))
+}
+
+func sortedKeys(values map[string]interface{}) (keys []string) {
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+func sortedCommandKeys(commands componentCommands) (keys []string) {
+	for key := range commands {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// an entry of map<string, Value>, the values of a command are a list value
+func appendWireValueEntry(data []byte, num protowire.Number, key string, v interface{}) ([]byte, error) {
+	value, err := marshalWireValue(v)
+	if err != nil {
+		return data, err
+	}
+
+	var entry []byte
+	entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+	entry = protowire.AppendString(entry, key)
+	entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+	entry = protowire.AppendBytes(entry, value)
+
+	data = protowire.AppendTag(data, num, protowire.BytesType)
+	return protowire.AppendBytes(data, entry), nil
+}
+
+func consumeWireValueEntry(data []byte, key *string, v *interface{}) (n int, err error) {
+	var entry []byte
+	if entry, n = protowire.ConsumeBytes(data); n < 0 {
+		return
+	}
+
+	err = consumeWireFields(entry, func(num protowire.Number, typ protowire.Type, data []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return consumeWireString(data, key)
+		case num == 2 && typ == protowire.BytesType:
+			return consumeWireValue(data, v)
+		}
+		return protowire.ConsumeFieldValue(num, typ, data), nil
+	})
+	return
+}
+
+// the Value message, the keys of the maps are sorted so the output is stable
+func marshalWireValue(v interface{}) (data []byte, err error) {
+	switch val := v.(type) {
+	case nil:
+		data = protowire.AppendTag(data, 1, protowire.VarintType)
+		data = protowire.AppendVarint(data, 0)
+	case bool:
+		data = protowire.AppendTag(data, 2, protowire.VarintType)
+		data = protowire.AppendVarint(data, protowire.EncodeBool(val))
+	case int:
+		data = appendWireInt64(data, int64(val))
+	case int8:
+		data = appendWireInt64(data, int64(val))
+	case int16:
+		data = appendWireInt64(data, int64(val))
+	case int32:
+		data = appendWireInt64(data, int64(val))
+	case int64:
+		data = appendWireInt64(data, val)
+	case uint:
+		data = appendWireUint64(data, uint64(val))
+	case uint8:
+		data = appendWireUint64(data, uint64(val))
+	case uint16:
+		data = appendWireUint64(data, uint64(val))
+	case uint32:
+		data = appendWireUint64(data, uint64(val))
+	case uint64:
+		data = appendWireUint64(data, val)
+	case float32:
+		data = appendWireDouble(data, float64(val))
+	case float64:
+		data = appendWireDouble(data, val)
+	case json.Number:
+		if i, e := val.Int64(); e == nil {
+			data = appendWireInt64(data, i)
+		} else if u, e := strconv.ParseUint(val.String(), 10, 64); e == nil {
+			data = appendWireUint64(data, u)
+		} else if f, e := val.Float64(); e == nil {
+			data = appendWireDouble(data, f)
+		} else {
+			err = e
+		}
+	case string:
+		data = protowire.AppendTag(data, 6, protowire.BytesType)
+		data = protowire.AppendString(data, val)
+	case []interface{}:
+		var list []byte
+		for _, item := range val {
+			var value []byte
+			if value, err = marshalWireValue(item); err != nil {
+				return
+			}
+			list = protowire.AppendTag(list, 1, protowire.BytesType)
+			list = protowire.AppendBytes(list, value)
+		}
+		data = protowire.AppendTag(data, 7, protowire.BytesType)
+		data = protowire.AppendBytes(data, list)
+	case map[string]interface{}:
+		var fields []byte
+		for _, key := range sortedKeys(val) {
+			if fields, err = appendWireValueEntry(fields, 1, key, val[key]); err != nil {
+				return
+			}
+		}
+		data = protowire.AppendTag(data, 8, protowire.BytesType)
+		data = protowire.AppendBytes(data, fields)
+	default:
+		// the structs, the typed maps and slices, as they are in json
+		var bJson []byte
+		if bJson, err = json.Marshal(v); err != nil {
+			return
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(bJson))
+		decoder.UseNumber()
+
+		var value interface{}
+		if err = decoder.Decode(&value); err != nil {
+			return
+		}
+		return marshalWireValue(value)
+	}
+	return
+}
+
+func consumeWireValue(data []byte, v *interface{}) (n int, err error) {
+	var value []byte
+	if value, n = protowire.ConsumeBytes(data); n < 0 {
+		return
+	}
+	*v, err = unmarshalWireValue(value)
+	return
+}
+
+// the Value without a kind is null
+func unmarshalWireValue(data []byte) (v interface{}, err error) {
+	err = consumeWireFields(data, func(num protowire.Number, typ protowire.Type, data []byte) (n int, err error) {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			_, n = protowire.ConsumeVarint(data)
+			v = nil
+			return
+		case (num == 2 || num == 3 || num == 4) && typ == protowire.VarintType:
+			var u uint64
+			if u, n = protowire.ConsumeVarint(data); n < 0 {
+				return
+			}
+			switch num {
+			case 2:
+				v = protowire.DecodeBool(u)
+			case 3:
+				v = int64(u)
+			case 4:
+				v = u
+			}
+			return
+		case num == 5 && typ == protowire.Fixed64Type:
+			var u uint64
+			if u, n = protowire.ConsumeFixed64(data); n >= 0 {
+				v = math.Float64frombits(u)
+			}
+			return
+		case num == 6 && typ == protowire.BytesType:
+			s := ""
+			n, err = consumeWireString(data, &s)
+			v = s
+			return
+		case num == 7 && typ == protowire.BytesType:
+			var list []byte
+			if list, n = protowire.ConsumeBytes(data); n < 0 {
+				return
+			}
+			values := []interface{}{}
+			err = consumeWireFields(list, func(num protowire.Number, typ protowire.Type, data []byte) (n int, err error) {
+				if num == 1 && typ == protowire.BytesType {
+					var value interface{}
+					n, err = consumeWireValue(data, &value)
+					values = append(values, value)
+					return
+				}
+				return protowire.ConsumeFieldValue(num, typ, data), nil
+			})
+			v = values
+			return
+		case num == 8 && typ == protowire.BytesType:
+			var fields []byte
+			if fields, n = protowire.ConsumeBytes(data); n < 0 {
+				return
+			}
+			m := map[string]interface{}{}
+			err = consumeWireFields(fields, func(num protowire.Number, typ protowire.Type, data []byte) (n int, err error) {
+				if num == 1 && typ == protowire.BytesType {
+					key, value := "", interface{}(nil)
+					n, err = consumeWireValueEntry(data, &key, &value)
+					m[key] = value
+					return
+				}
+				return protowire.ConsumeFieldValue(num, typ, data), nil
+			})
+			v = m
+			return
+		}
+		return protowire.ConsumeFieldValue(num, typ, data), nil
+	})
+	return
+}
+
+func appendWireInt64(data []byte, v int64) []byte {
+	data = protowire.AppendTag(data, 3, protowire.VarintType)
+	return protowire.AppendVarint(data, uint64(v))
+}
+
+func appendWireUint64(data []byte, v uint64) []byte {
+	data = protowire.AppendTag(data, 4, protowire.VarintType)
+	return protowire.AppendVarint(data, v)
+}
+
+func appendWireDouble(data []byte, v float64) []byte {
+	data = protowire.AppendTag(data, 5, protowire.Fixed64Type)
+	return protowire.AppendFixed64(data, math.Float64bits(v))
+}
@@ -0,0 +1,81 @@
+package casper
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestProtobufValues(t *testing.T) {
+	type named struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected interface{}
+	}{
+		{"null", nil, nil},
+		{"false", false, false},
+		{"true", true, true},
+		{"int", 42, int64(42)},
+		{"negative", int32(-7), int64(-7)},
+		{"max int64", int64(math.MaxInt64), int64(math.MaxInt64)},
+		{"max uint64", uint64(math.MaxUint64), uint64(math.MaxUint64)},
+		{"float", 1.5, 1.5},
+		{"empty string", "", ""},
+		{"string", "casper", "casper"},
+		{"empty list", []interface{}{}, []interface{}{}},
+		{"list", []interface{}{1, "a", nil, []interface{}{true}}, []interface{}{int64(1), "a", nil, []interface{}{true}}},
+		{"map", map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": nil}},
+			map[string]interface{}{"a": int64(1), "b": map[string]interface{}{"c": nil}}},
+		{"struct", named{Name: "casper", Count: 3}, map[string]interface{}{"name": "casper", "count": int64(3)}},
+		{"typed slice", []string{"a", "b"}, []interface{}{"a", "b"}},
+	}
+
+	for _, test := range tests {
+		data, err := marshalWireValue(test.value)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		value, err := unmarshalWireValue(data)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if !reflect.DeepEqual(value, test.expected) {
+			t.Errorf("%s: decoded %#v, not %#v", test.name, value, test.expected)
+		}
+	}
+}
+
+func TestProtobufPayload(t *testing.T) {
+	comMsg, _ := NewComponentMessage(nil, map[string]interface{}{"id": int64(math.MaxInt64)})
+	comMsg.Payload.SetContext("count", 42)
+	comMsg.Payload.SetContext("tags", []interface{}{"a", "b"})
+	comMsg.Payload.AppendCommand("SET_HEADERS", map[string]interface{}{"name": "X-Id", "value": "1"})
+
+	codec, _ := GetCodec("protobuf")
+	data, err := codec.Marshal(comMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := new(ComponentMessage)
+	if err = codec.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	payload := decoded.Payload
+	if !reflect.DeepEqual(payload.result, map[string]interface{}{"id": int64(math.MaxInt64)}) {
+		t.Errorf("result: %#v", payload.result)
+	}
+	if !reflect.DeepEqual(payload.context, componentContext{"count": int64(42), "tags": []interface{}{"a", "b"}}) {
+		t.Errorf("context: %#v", payload.context)
+	}
+	if !reflect.DeepEqual(payload.command, componentCommands{"SET_HEADERS": {map[string]interface{}{"name": "X-Id", "value": "1"}}}) {
+		t.Errorf("command: %#v", payload.command)
+	}
+}
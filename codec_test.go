@@ -0,0 +1,201 @@
+package casper
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const goldenDir = "testdata/envelope"
+
+// the golden files by the codec of the extension
+func goldenFiles(t *testing.T) map[string][]string {
+	files, err := filepath.Glob(filepath.Join(goldenDir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	goldens := map[string][]string{}
+	for _, file := range files {
+		if ext := filepath.Ext(file); ext != ".md" {
+			goldens[strings.TrimPrefix(ext, ".")] = append(goldens[strings.TrimPrefix(ext, ".")], file)
+		}
+	}
+	return goldens
+}
+
+func decodeGolden(t *testing.T, file string) *ComponentMessage {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codec, err := GetCodec(strings.TrimPrefix(filepath.Ext(file), "."))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comMsg := new(ComponentMessage)
+	if err = codec.Unmarshal(data, comMsg); err != nil {
+		t.Fatalf("decode %s: %v", file, err)
+	}
+	return comMsg
+}
+
+// the fields of testdata/envelope/README.md, by the version of the golden
+func checkGolden(t *testing.T, comMsg *ComponentMessage, version int) {
+	if comMsg.Id != "7f1f4f6e-9a43-4b8c-8d2a-3b5e0c6a1d20" {
+		t.Errorf("id: %s", comMsg.Id)
+	}
+
+	if comMsg.entrance == nil || comMsg.entrance.Name != "example" || comMsg.entrance.In != "tcp://127.0.0.1:5000" {
+		t.Errorf("entrance: %+v", comMsg.entrance)
+	}
+
+	var graph []string
+	for _, meta := range comMsg.graph {
+		graph = append(graph, meta.Name)
+	}
+	if strings.Join(graph, ",") != "com2,example" {
+		t.Errorf("graph: %v", graph)
+	}
+
+	if strings.Join(comMsg.chain, ",") != "tcp://127.0.0.1:5000,tcp://127.0.0.1:5001" {
+		t.Errorf("chain: %v", comMsg.chain)
+	}
+
+	payload := comMsg.Payload
+	if api, err := payload.GetContextString("X-API"); err != nil || api != "example.hello" {
+		t.Errorf("context X-API: %v, %v", api, err)
+	}
+	if count, err := payload.GetContextInt("count"); err != nil || count != 42 {
+		t.Errorf("context count: %v, %v", count, err)
+	}
+
+	if n := payload.GetCommandValueSize("SET_HEADERS"); n != 1 {
+		t.Errorf("command SET_HEADERS: %d values", n)
+	}
+
+	var result map[string]interface{}
+	if err := payload.UnmarshalResult(&result); err != nil || len(result) != 1 || result["name"] != "casper" {
+		t.Errorf("result: %v, %v", result, err)
+	}
+
+	headers := payload.headers
+	if version >= 2 {
+		deadline, _ := time.Parse(time.RFC3339, "2026-01-01T00:00:15Z")
+		if headers.Api != "example.hello" || headers.Tenant != "acme" || headers.Attempt != 1 || !headers.Deadline.Equal(deadline) {
+			t.Errorf("headers: %+v", headers)
+		}
+	} else if headers.Api != "" || headers.Attempt != 0 || !headers.Deadline.IsZero() {
+		t.Errorf("headers of version %d: %+v", version, headers)
+	}
+
+	hops := payload.hops
+	if version >= 3 {
+		if len(hops) != 1 || hops[0].Component != "com1" || hops[0].Outcome != "ok" || hops[0].HandleDuration() != 2*time.Millisecond {
+			t.Errorf("hops: %+v", hops)
+		}
+	} else if len(hops) != 0 {
+		t.Errorf("hops of version %d: %+v", version, hops)
+	}
+
+	if version >= 4 {
+		if len(payload.blobs) != 1 || payload.blobs[0] != "3d9a6c2e-5b1f-4e8a-9c7d-2f4b6a8e0c1d" || payload.resultRef != "" {
+			t.Errorf("blobs: %v, result_ref: %s", payload.blobs, payload.resultRef)
+		}
+	} else if len(payload.blobs) != 0 {
+		t.Errorf("blobs of version %d: %v", version, payload.blobs)
+	}
+}
+
+// the version of the fields a golden has, the future one has the fields of
+// version 1 only, the others are the ones this version does not know
+func goldenVersion(file string) int {
+	switch name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)); name {
+	case "future":
+		return 1
+	default:
+		return int(name[1] - '0')
+	}
+}
+
+func TestGoldenEnvelopes(t *testing.T) {
+	goldens := goldenFiles(t)
+
+	var codecNames []string
+	for name := range codecs {
+		codecNames = append(codecNames, name)
+	}
+	sort.Strings(codecNames)
+
+	for _, codecName := range codecNames {
+		if len(goldens[codecName]) == 0 {
+			t.Errorf("codec %s has no golden messages in %s", codecName, goldenDir)
+		}
+	}
+
+	for ext, files := range goldens {
+		for _, file := range files {
+			t.Run(filepath.Base(file), func(t *testing.T) {
+				if _, exist := codecs[ext]; !exist {
+					t.Fatalf("no codec of %s", ext)
+				}
+
+				comMsg := decodeGolden(t, file)
+				version := goldenVersion(file)
+				checkGolden(t, comMsg, version)
+
+				// whatever the codec of the next component is
+				for _, codecName := range codecNames {
+					checkGolden(t, hopThrough(t, comMsg, codecName), version)
+				}
+			})
+		}
+	}
+}
+
+func TestGoldenVersions(t *testing.T) {
+	versions := map[string]int{
+		"v0.json":     0,
+		"v1.json":     1,
+		"v2.msgpack":  2,
+		"v3.protobuf": 3,
+		"v4.json":     4,
+		"future.json": 99,
+	}
+
+	for name, version := range versions {
+		if v := decodeGolden(t, filepath.Join(goldenDir, name)).Version(); v != version {
+			t.Errorf("version of %s: %d, expected %d", name, v, version)
+		}
+	}
+}
+
+// the goldens of the current version are what this version sends, not the
+// msgpack one, msgpack decodes the small numbers to int8 and encodes them
+// back in another format
+func TestGoldenReencode(t *testing.T) {
+	for _, name := range []string{"v4.json", "v4.protobuf"} {
+		file := filepath.Join(goldenDir, name)
+
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		codec, _ := GetCodec(strings.TrimPrefix(filepath.Ext(file), "."))
+		encoded, err := codec.Marshal(decodeGolden(t, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(encoded, data) {
+			t.Errorf("%s is not encoded byte for byte:\n%q\n%q", name, encoded, data)
+		}
+	}
+}
@@ -4,8 +4,8 @@
 package casper
 
 import (
-	"encoding/json"
-	"os"
+	"sync"
+	"time"
 
 	"github.com/gogap/errors"
 	"github.com/gogap/logs"
@@ -15,6 +15,9 @@ import (
 
 var components map[string]*Component = make(map[string]*Component)
 
+// the components are replaced while reloading the configs
+var componentsLocker sync.RWMutex
+
 // 端点
 type EndPoint struct {
 	MessageQueue
@@ -29,21 +32,36 @@ type Component struct {
 	messenger   Messenger
 
 	handler ComponentHandler
+	running bool // its metadata could not be reloaded
+	tap     *tapper
 }
 
 func (p *Component) Metadata() ComponentMetadata {
 	return ComponentMetadata{
-		Name:   p.Name,
-		In:     p.endPoint.In,
-		MQType: p.endPoint.MQType}
+		Name:              p.Name,
+		In:                p.endPoint.In,
+		MQType:            p.endPoint.MQType,
+		Codec:             p.endPoint.Codec,
+		Compression:       p.endPoint.Compression,
+		CompressThreshold: p.endPoint.CompressThreshold,
+		MaxMessageSize:    p.endPoint.MaxMessageSize,
+		MaxContextEntries: p.endPoint.MaxContextEntries,
+		MaxCommandEntries: p.endPoint.MaxCommandEntries}
 }
 
 func (p *Component) GetComponentConfig() ComponentConfig {
 	return ComponentConfig{
-		Name:        p.Name,
-		Description: p.Description,
-		In:          p.endPoint.In,
-		MQType:      p.endPoint.MQType}
+		Name:              p.Name,
+		Description:       p.Description,
+		In:                p.endPoint.In,
+		MQType:            p.endPoint.MQType,
+		Codec:             p.endPoint.Codec,
+		Compression:       p.endPoint.Compression,
+		CompressThreshold: p.endPoint.CompressThreshold,
+		MaxMessageSize:    p.endPoint.MaxMessageSize,
+		MaxContextEntries: p.endPoint.MaxContextEntries,
+		MaxCommandEntries: p.endPoint.MaxCommandEntries,
+		Tap:               p.tap.tapUrl()}
 }
 
 type ComponentHandler func(*Payload) (result interface{}, err error)
@@ -54,65 +72,103 @@ type ComponentConfig struct {
 	Description string `json:"description"`
 	MQType      string `json:"mq_type"`
 	In          string `json:"in"`
+	Codec       string `json:"codec"` // the codec of the messages it receives, default is json
+
+	Compression       string `json:"compression"`        // gzip, zstd or snappy, default is none
+	CompressThreshold int    `json:"compress_threshold"` // bytes, default is DefaultCompressThreshold
+
+	MaxMessageSize    int `json:"max_message_size"`    // bytes of the packets it receives, default is DefaultMaxMessageSize
+	MaxContextEntries int `json:"max_context_entries"` // default is DefaultMaxContextEntries
+	MaxCommandEntries int `json:"max_command_entries"` // default is DefaultMaxCommandEntries
+
+	Tap string `json:"tap"` // the messages are published to it, a zmq url of PUB bound by the process, or the name of RegisterTap
+
+	BlobStore     string `json:"blob_store"`     // the directory of the large results, shared by the components of the graphs, default is none
+	BlobThreshold int    `json:"blob_threshold"` // bytes of the results (in json), default is DefaultBlobThreshold
 }
 
 func (p *ComponentConfig) Metadata() ComponentMetadata {
 	return ComponentMetadata{
-		Name:   p.Name,
-		In:     p.In,
-		MQType: p.MQType}
+		Name:              p.Name,
+		In:                p.In,
+		MQType:            p.MQType,
+		Codec:             p.Codec,
+		Compression:       p.Compression,
+		CompressThreshold: p.CompressThreshold,
+		MaxMessageSize:    p.MaxMessageSize,
+		MaxContextEntries: p.MaxContextEntries,
+		MaxCommandEntries: p.MaxCommandEntries}
 }
 
+// BuildComponent is LoadComponents, but panics on the errors
 func BuildComponent(fileName string) {
-	var conf struct {
-		Components []ComponentConfig `json:"components"`
+	if err := LoadComponents(fileName); err != nil {
+		logs.Error(err)
+		panic(err)
 	}
+}
 
-	r, err := os.Open(fileName)
-	logs.Info("load components config file:", fileName)
+func NewComponent(conf ComponentConfig) (component *Component, err error) {
+	messenger := NewMQChanMessenger(nil, conf.Metadata())
+	return NewComponentWithMessenger(conf, messenger)
+}
 
-	if err != nil {
-		err = errorcode.ERR_OPENFILE_ERROR.New(errors.Params{"fileName": fileName, "err": err})
-		logs.Error(err)
-		panic(err)
+func NewComponentWithMessenger(conf ComponentConfig, messenger Messenger) (component *Component, err error) {
+	if component, err = newComponent(conf, messenger); err != nil {
+		return
 	}
-	defer r.Close()
 
-	if err = json.NewDecoder(r).Decode(&conf); err != nil {
-		err = errorcode.ERR_JSON_UNMARSHAL_ERROR.New(errors.Params{"err": err})
-		logs.Error(err)
-		panic(err)
+	componentsLocker.Lock()
+	components[component.Name] = component
+	componentsLocker.Unlock()
+
+	logs.Pretty("new component:", component)
+	return
+}
+
+// the component is not registered
+func newComponent(conf ComponentConfig, messenger Messenger) (component *Component, err error) {
+	if _, err = GetCodec(conf.Codec); err != nil {
+		return
 	}
 
-	for _, compConf := range conf.Components {
-		if _, err = NewComponent(compConf); err != nil {
-			logs.Error(err)
-			panic(err)
+	if _, err = GetCompressor(conf.Compression); err != nil {
+		return
+	}
+
+	if conf.BlobStore != "" {
+		var store *FileBlobStore
+		if store, err = NewFileBlobStore(conf.BlobStore); err != nil {
+			return
 		}
+		SetBlobStore(store, conf.BlobThreshold)
 	}
 
-}
+	var tap *tapper
+	if tap, err = newTapper(conf.Tap, conf.Metadata()); err != nil {
+		return
+	}
 
-func NewComponent(conf ComponentConfig) (component *Component, err error) {
-	messenger := NewMQChanMessenger(nil, conf.Metadata())
-	return NewComponentWithMessenger(conf, messenger)
-}
+	// the messages sent by the entrance are published as well
+	if m, ok := messenger.(*MQChanMessenger); ok {
+		m.tap = tap
+	}
 
-func NewComponentWithMessenger(conf ComponentConfig, messenger Messenger) (component *Component, err error) {
 	comp := &Component{
 		Name:        conf.Name,
 		Description: conf.Description,
-		endPoint:    EndPoint{ComponentMetadata: ComponentMetadata{In: conf.In, MQType: conf.MQType}, MessageQueue: nil},
+		endPoint:    EndPoint{ComponentMetadata: conf.Metadata(), MessageQueue: nil},
 		messenger:   messenger,
-		handler:     nil}
-
-	components[comp.Name] = comp
+		handler:     nil,
+		tap:         tap}
 
-	logs.Pretty("new component:", comp)
 	return comp, nil
 }
 
 func GetComponentByName(name string) *Component {
+	componentsLocker.RLock()
+	defer componentsLocker.RUnlock()
+
 	if component, ok := components[name]; ok {
 		return component
 	}
@@ -154,6 +210,10 @@ func (p *Component) Run() (err error) {
 		return
 	}
 
+	componentsLocker.Lock()
+	p.running = true
+	componentsLocker.Unlock()
+
 	go p.recvMonitor()
 
 	return nil
@@ -161,38 +221,58 @@ func (p *Component) Run() (err error) {
 
 func (p *Component) recvMonitor() {
 	for {
-		msg, err := p.endPoint.RecvMessage()
+		packet, err := p.endPoint.RecvMessage()
 		if err != nil {
 			logs.Error(err)
 			continue
 		}
+		receivedAt := time.Now()
 
-		strMsg := string(msg)
-		logs.Debug(p.Name, "Recv:", strMsg)
+		// the too large packets could not be decoded, they are dropped
+		if err = p.endPoint.checkMessageSize(len(packet.Message)); err == nil {
+			err = packet.Decompress(p.endPoint.maxMessageSize())
+		}
+		if err != nil {
+			logs.Error(err)
+			continue
+		}
 
 		comMsg := new(ComponentMessage)
-		if err := comMsg.FromJson(msg); err != nil {
+		if err := DecodePacket(packet, comMsg); err != nil {
 			err = errorcode.ERR_COULD_NOT_PARSE_COMPONENT_MSG.New(
 				errors.Params{"in": p.endPoint.In,
 					"mqType": p.endPoint.MQType,
-					"msg":    strMsg})
+					"msg":    err})
 
 			logs.Error(err)
 			continue
 		}
 
+		logs.Debug(p.Name, "Recv:", comMsg.Id)
+		comMsg.receivedAt = receivedAt
+		p.tap.publish(TAP_RECEIVED, nil, comMsg, packet)
+
+		if err = p.endPoint.checkEntries(comMsg); err != nil {
+			logs.Error(err)
+			go p.reject(comMsg, err)
+			continue
+		}
+
 		go p.SendMsg(comMsg)
 	}
 }
 
 func (p *Component) SendMsg(comMsg *ComponentMessage) {
-	// 就是打日志用的
-	msg, _ := comMsg.Serialize()
-	strMsg := string(msg)
-
 	// 更新调用链
 	comMsg.chain = append(comMsg.chain, p.endPoint.In)
 
+	receivedAt := comMsg.receivedAt
+	if receivedAt.IsZero() {
+		receivedAt = time.Now()
+	}
+	hop := newHop(p.Name, p.endPoint.In, receivedAt)
+	comMsg.Payload.hops = append(comMsg.Payload.hops, hop)
+
 	// deal path
 	next := comMsg.TopGraph()
 
@@ -200,7 +280,7 @@ func (p *Component) SendMsg(comMsg *ComponentMessage) {
 		// 正常流程
 		next = comMsg.PopGraph()
 		if next == nil || next.Name == "" {
-			logs.Warn("next is nil. send to entrance:", strMsg)
+			logs.Warn("next is nil. send to entrance:", comMsg.Id)
 			next = comMsg.entrance
 			comMsg.graph = nil
 		}
@@ -208,10 +288,13 @@ func (p *Component) SendMsg(comMsg *ComponentMessage) {
 		// call handler
 		var ret interface{}
 		var err error
+		hop.Outcome = HOP_OUTCOME_SKIPPED
 		if p.handler != nil {
 			logs.Debug(p.Name, "begin call handler")
 			ret, err = p.handler(comMsg.Payload)
-			comMsg.Payload.result = nil
+			hop.HandledAt = time.Now()
+			hop.Outcome = HOP_OUTCOME_OK
+			comMsg.Payload.SetResult(nil)
 			if err != nil {
 				// 业务处理错误, 发给入口
 				warnErr := errorcode.ERR_HANDLER_RETURN_ERROR.New(errors.Params{"name": p.Name})
@@ -224,29 +307,29 @@ func (p *Component) SendMsg(comMsg *ComponentMessage) {
 					comMsg.Payload.Code = err.(errors.ErrCode).Code()
 					comMsg.Payload.Message = err.(errors.ErrCode).Error()
 				}
+				hop.Outcome = HOP_OUTCOME_ERROR
+				hop.Code = comMsg.Payload.Code
 				next = comMsg.entrance
 				comMsg.graph = nil
 			} else {
-				comMsg.Payload.result = ret
+				comMsg.Payload.SetResult(ret)
 				logs.Debug(p.Name, "end call handler")
 			}
 		}
 
 		// 正常发到下一站
-		logs.Debug("begin send to next component:", next.In, next.MQType, strMsg)
-		if msg, e := comMsg.Serialize(); e != nil {
-			err = errorcode.ERR_COULD_NOT_PARSE_COMPONENT_MSG.New(
-				errors.Params{"in": p.endPoint.In,
-					"mqType": p.endPoint.MQType,
-					"msg":    strMsg,
-					"err":    e})
-			logs.Error(err)
-		} else if _, err = p.messenger.SendToComponent(next, msg); err != nil {
+		logs.Debug("begin send to next component:", next.In, next.MQType, comMsg.Id)
+		hop.SentAt = time.Now()
+		if _, err = p.messenger.SendToComponent(next, comMsg); err != nil {
 			logs.Error(err)
+			if isLimitExceeded(err) {
+				p.reject(comMsg, err)
+			}
 		}
 	} else if next == nil || next.In == "" {
 		// 消息流出错了或是已经走到了入口
-		msg, _ := comMsg.Serialize()
+		hop.Outcome = HOP_OUTCOME_DELIVERED
+		hop.SentAt = time.Now()
 		if p.messenger != nil {
 			// 到入口了, 抛给上层
 			logs.Debug(p.Name, "send msg to entrance:", comMsg.entrance.Name, comMsg.entrance.In, comMsg.entrance.MQType)
@@ -255,22 +338,45 @@ func (p *Component) SendMsg(comMsg *ComponentMessage) {
 			}
 		} else {
 			// 链路错了， 发给入口
-			logs.Debug("msg's next null, send to entrance", strMsg)
-			if _, err := p.messenger.SendToComponent(comMsg.entrance, msg); err != nil {
+			logs.Debug("msg's next null, send to entrance", comMsg.Id)
+			if _, err := p.messenger.SendToComponent(comMsg.entrance, comMsg); err != nil {
 				logs.Error(err)
 			}
 		}
 	} else if next.In != p.endPoint.In {
 		// 发给正确的站点
-		if msg, err := comMsg.Serialize(); err != nil {
-			err = errorcode.ERR_COMPONENT_MSG_SERIALIZE_FAILED.New(
-				errors.Params{
-					"in":     p.endPoint.In,
-					"mqType": p.endPoint.MQType,
-					"err":    err})
-			logs.Error(err)
-		} else if _, err = p.messenger.SendToComponent(next, msg); err != nil {
+		hop.Outcome = HOP_OUTCOME_FORWARDED
+		hop.SentAt = time.Now()
+		if _, err := p.messenger.SendToComponent(next, comMsg); err != nil {
 			logs.Error(err)
 		}
 	}
 }
+
+// reject returns the message to the entrance with the error, the context,
+// the command and the result are dropped, so it is within the limits
+func (p *Component) reject(comMsg *ComponentMessage, err error) {
+	if comMsg.entrance == nil {
+		return
+	}
+
+	comMsg.Payload.Code = 500
+	if errors.IsErrCode(err) {
+		comMsg.Payload.Code = err.(errors.ErrCode).Code()
+	}
+	comMsg.Payload.Message = err.Error()
+	comMsg.Payload.context = nil
+	comMsg.Payload.command = nil
+	comMsg.Payload.SetResult(nil)
+	comMsg.graph = nil
+
+	if comMsg.entrance.In == p.endPoint.In {
+		err = p.messenger.ReceiveMessage(comMsg)
+	} else {
+		_, err = p.messenger.SendToComponent(comMsg.entrance, comMsg)
+	}
+
+	if err != nil {
+		logs.Error(err)
+	}
+}
@@ -0,0 +1,117 @@
+package casper
+
+import (
+	"time"
+)
+
+// the http headers (or grpc metadata) of the requests which are mapped to
+// the message headers by the entrances
+const (
+	HTTP_HEADER_TRACE_ID = "X-Trace-Id"
+	HTTP_HEADER_SPAN_ID  = "X-Span-Id"
+	HTTP_HEADER_TENANT   = "X-Tenant"
+)
+
+// the message headers
+//
+// the framework metadata of the message, it is set by the entrances and
+// travels with the message, the context of the payload is left to the
+// applications
+type Headers struct {
+	Api         string            `json:"api,omitempty"`      // the graph name
+	Entrance    string            `json:"entrance,omitempty"` // the type of the entrance which accepted the request
+	TraceId     string            `json:"trace_id,omitempty"` // from X-Trace-Id, or the id of the first message
+	SpanId      string            `json:"span_id,omitempty"`  // the span of the caller, from X-Span-Id
+	Tenant      string            `json:"tenant,omitempty"`
+	Attempt     int               `json:"attempt,omitempty"` // how many times the request was retried
+	Deadline    time.Time         `json:"deadline"`          // the entrance gives up after it
+	CreatedAt   time.Time         `json:"created_at"`
+	Cookies     map[string]string `json:"cookies,omitempty"`      // the http cookies of to_context.cookies
+	HTTPHeaders map[string]string `json:"http_headers,omitempty"` // the http headers of to_context.headers
+}
+
+func (p *ComponentMessage) Headers() *Headers {
+	if p.Payload == nil {
+		p.Payload = &Payload{}
+	}
+	return p.Payload.Headers()
+}
+
+// the handlers only have the payload, so the headers are kept by it
+func (p *Payload) Headers() *Headers {
+	return &p.headers
+}
+
+func (p *Headers) Expired() bool {
+	return !p.Deadline.IsZero() && time.Now().After(p.Deadline)
+}
+
+// the time left before the deadline, it is 0 if there is no deadline
+func (p *Headers) Remaining() time.Duration {
+	if p.Deadline.IsZero() {
+		return 0
+	}
+
+	if remaining := p.Deadline.Sub(time.Now()); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+func (p *Headers) GetCookie(name string) (value string, exist bool) {
+	value, exist = p.Cookies[name]
+	return
+}
+
+func (p *Headers) GetHTTPHeader(name string) (value string, exist bool) {
+	value, exist = p.HTTPHeaders[name]
+	return
+}
+
+// the fields which are already set (e.g. by the caller of the zmq entrance)
+// are kept, the deadline is the earlier one
+func (p *Headers) fillRequest(msgId, entranceType, apiName string, timeout time.Duration) {
+	now := time.Now()
+
+	if p.Api == "" {
+		p.Api = apiName
+	}
+
+	if p.Entrance == "" {
+		p.Entrance = entranceType
+	}
+
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = now
+	}
+
+	if deadline := now.Add(timeout); timeout > 0 && (p.Deadline.IsZero() || deadline.Before(p.Deadline)) {
+		p.Deadline = deadline
+	}
+
+	if p.TraceId == "" {
+		p.TraceId = msgId
+	}
+}
+
+// the context keys of the headers before the message headers, the
+// entrances still fill them for the handlers which read them, until the
+// deprecation period ends
+func (p *Payload) fillDeprecatedContext(apiKey string) {
+	p.SetContext(apiKey, p.headers.Api)
+
+	if p.headers.Cookies != nil {
+		p.SetContext(CTX_HTTP_COOKIES, p.headers.Cookies)
+	}
+
+	if p.headers.HTTPHeaders != nil {
+		p.SetContext(CTX_HTTP_HEADERS, p.headers.HTTPHeaders)
+	}
+}
+
+// get is the http header or the grpc metadata of the request
+func (p *Headers) fillTrace(get func(string) string) {
+	p.TraceId = get(HTTP_HEADER_TRACE_ID)
+	p.SpanId = get(HTTP_HEADER_SPAN_ID)
+	p.Tenant = get(HTTP_HEADER_TENANT)
+}
@@ -0,0 +1,77 @@
+package casper
+
+import (
+	"os"
+	"time"
+
+	uuid "github.com/nu7hatch/gouuid"
+)
+
+const (
+	HOP_OUTCOME_OK        = "ok"        // the handler returned the result
+	HOP_OUTCOME_ERROR     = "error"     // the handler returned an error, the message goes to the entrance
+	HOP_OUTCOME_SKIPPED   = "skipped"   // the component has no handler
+	HOP_OUTCOME_FORWARDED = "forwarded" // the message is not for the component, it is sent to the right one
+	HOP_OUTCOME_DELIVERED = "delivered" // the message is back to the entrance
+)
+
+var (
+	hopInstance string
+	hopHost     string
+)
+
+func init() {
+	if u, e := uuid.NewV4(); e == nil {
+		hopInstance = u.String()
+	}
+	hopHost, _ = os.Hostname()
+}
+
+// a stop of the message along the graph
+type Hop struct {
+	Component  string    `json:"component"`
+	In         string    `json:"in"`
+	Instance   string    `json:"instance"` // the process of the component, it changes after restart
+	Host       string    `json:"host"`
+	ReceivedAt time.Time `json:"received_at"`
+	HandledAt  time.Time `json:"handled_at"` // zero if the handler was not called
+	SentAt     time.Time `json:"sent_at"`
+	Outcome    string    `json:"outcome"`
+	Code       uint64    `json:"code,omitempty"` // the error code of the handler
+}
+
+// the time spent in the handler
+func (p *Hop) HandleDuration() time.Duration {
+	if p.HandledAt.IsZero() {
+		return 0
+	}
+	return p.HandledAt.Sub(p.ReceivedAt)
+}
+
+// the time the component held the message
+func (p *Hop) Duration() time.Duration {
+	return p.SentAt.Sub(p.ReceivedAt)
+}
+
+// the hops of the message in order, the time between the SentAt of a hop
+// and the ReceivedAt of the next one is spent in the mq
+func (p *ComponentMessage) Hops() []*Hop {
+	if p.Payload == nil {
+		return nil
+	}
+	return p.Payload.Hops()
+}
+
+// the entrances only have the payload of the reply, so the hops are kept by it
+func (p *Payload) Hops() []*Hop {
+	return p.hops
+}
+
+func newHop(name, in string, receivedAt time.Time) *Hop {
+	return &Hop{
+		Component:  name,
+		In:         in,
+		Instance:   hopInstance,
+		Host:       hopHost,
+		ReceivedAt: receivedAt}
+}
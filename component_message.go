@@ -3,25 +3,33 @@ package casper
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
+	"time"
 
+	"github.com/gogap/logs"
 	uuid "github.com/nu7hatch/gouuid"
 )
 
 type componentCommands map[string][]interface{}
 type componentContext map[string]interface{}
 
-type callChain struct {
-	ComponentName string
-	Endpoint      string
-}
-
 type ComponentMetadata struct {
-	Name   string `json:"name"`
-	MQType string `json:"mq_type"`
-	In     string `json:"in"`
+	Name              string `json:"name"`
+	MQType            string `json:"mq_type"`
+	In                string `json:"in"`
+	Codec             string `json:"codec,omitempty"`
+	Compression       string `json:"compression,omitempty"`
+	CompressThreshold int    `json:"compress_threshold,omitempty"`
+	MaxMessageSize    int    `json:"max_message_size,omitempty"`
+	MaxContextEntries int    `json:"max_context_entries,omitempty"`
+	MaxCommandEntries int    `json:"max_command_entries,omitempty"`
 }
 
 type ComponentMessage struct {
+	version    int
+	receivedAt time.Time
+
 	Id       string               `json:"id"`
 	entrance *ComponentMetadata   `json:"entrance"`
 	graph    []*ComponentMetadata `json:"graph"`
@@ -35,6 +43,11 @@ type Payload struct {
 	context componentContext  `json:"context"`
 	command componentCommands `json:"command"`
 	result  interface{}       `json:"result"`
+	headers Headers
+	hops    []*Hop
+
+	resultRef string   // the key of the result offloaded to the blob store
+	blobs     []string // the blobs created along the graph
 }
 
 func NewComponentMessage(entrance *ComponentMetadata, result interface{}) (msg *ComponentMessage, err error) {
@@ -47,6 +60,7 @@ func NewComponentMessage(entrance *ComponentMetadata, result interface{}) (msg *
 	}
 
 	msg = &ComponentMessage{
+		version:  ENVELOPE_VERSION,
 		Id:       msgId,
 		entrance: entrance,
 		graph:    nil,
@@ -62,6 +76,12 @@ func NewComponentMessage(entrance *ComponentMetadata, result interface{}) (msg *
 
 }
 
+// the envelope version of the received message, the sent message is always
+// ENVELOPE_VERSION
+func (p *ComponentMessage) Version() int {
+	return p.version
+}
+
 func (p *ComponentMessage) SetEntrance(entrance ComponentMetadata) {
 	p.entrance = &entrance
 }
@@ -86,70 +106,18 @@ func (p *ComponentMessage) PopGraph() *ComponentMetadata {
 }
 
 func (p *ComponentMessage) Serialize() ([]byte, error) {
-	type Msg struct {
-		Id       string               `json:"id"`
-		Entrance *ComponentMetadata   `json:"entrance"`
-		Graph    []*ComponentMetadata `json:"graph"`
-		Chain    []string             `json:"chain"`
-		Payload  struct {
-			Code    uint64            `json:"code"`
-			Message string            `json:"message"`
-			Context componentContext  `json:"context"`
-			Command componentCommands `json:"command"`
-			Result  interface{}       `json:"result"`
-		} `json:"payload"`
-	}
-
-	tmp := &Msg{}
-	tmp.Id = p.Id
-	tmp.Entrance = p.entrance
-	tmp.Graph = p.graph
-	tmp.Chain = p.chain
-	if p.Payload != nil {
-		tmp.Payload.Code = p.Payload.Code
-		tmp.Payload.Message = p.Payload.Message
-		tmp.Payload.Context = p.Payload.context
-		tmp.Payload.Command = p.Payload.command
-		tmp.Payload.Result = p.Payload.result
-	}
-
-	return json.Marshal(tmp)
+	return new(jsonCodec).Marshal(p)
 }
 
 func (p *ComponentMessage) FromJson(jsonStr []byte) (err error) {
-	var tmp struct {
-		Id       string               `json:"id"`
-		Entrance *ComponentMetadata   `json:"entrance"`
-		Graph    []*ComponentMetadata `json:"graph"`
-		Chain    []string             `json:"chain"`
-		Payload  struct {
-			Code    uint64            `json:"code"`
-			Message string            `json:"message"`
-			Context componentContext  `json:"context,omitempty"`
-			Command componentCommands `json:"command,omitempty"`
-			Result  interface{}       `json:"result"`
-		} `json:"payload"`
-	}
-
-	if err := json.Unmarshal(jsonStr, &tmp); err != nil {
-		return err
-	}
-
-	p.Id = tmp.Id
-	p.entrance = tmp.Entrance
-	p.graph = tmp.Graph
-	p.chain = tmp.Chain
-	p.Payload = &Payload{
-		Code:    tmp.Payload.Code,
-		Message: tmp.Payload.Message,
-		context: tmp.Payload.Context,
-		command: tmp.Payload.Command,
-		result:  tmp.Payload.Result}
-
-	return nil
+	return new(jsonCodec).Unmarshal(jsonStr, p)
 }
 
 func (p *Payload) UnmarshalResult(v interface{}) (err error) {
+	if err = p.loadResult(); err != nil {
+		return
+	}
+
 	if p.result == nil {
 		return nil
 	}
@@ -164,12 +132,18 @@ func (p *Payload) UnmarshalResult(v interface{}) (err error) {
 	return
 }
 
+// the result offloaded to the blob store is fetched at the first call, it
+// is nil if the fetching failed
 func (p *Payload) GetResult() interface{} {
+	if err := p.loadResult(); err != nil {
+		logs.Error(err)
+	}
 	return p.result
 }
 
 func (p *Payload) SetResult(result interface{}) {
 	p.result = result
+	p.resultRef = ""
 }
 
 func (p *Payload) SetContext(key string, val interface{}) {
@@ -187,6 +161,15 @@ func (p *Payload) GetContext(key string) (val interface{}, exist bool) {
 	return
 }
 
+// the copy of all the context
+func (p *Payload) GetContexts() map[string]interface{} {
+	contexts := make(map[string]interface{}, len(p.context))
+	for key, val := range p.context {
+		contexts[key] = val
+	}
+	return contexts
+}
+
 func (p *Payload) GetContextString(key string) (val string, err error) {
 	if p.context == nil {
 		return "", fmt.Errorf("the context container is nil")
@@ -238,65 +221,147 @@ func (p *Payload) GetContextStringArray(key string) (vals []string, err error) {
 	return
 }
 
+// the numbers are json.Number after a json hop, so the numeric getters
+// convert across the numeric types, and fail if the value overflows
+
 func (p *Payload) GetContextInt(key string) (val int, err error) {
-	if p.context == nil {
-		return 0, fmt.Errorf("the context container is nil")
+	var v int64
+	if v, err = p.GetContextInt64(key); err != nil {
+		return
+	}
+
+	if v < math.MinInt || v > math.MaxInt {
+		err = fmt.Errorf("the value of context key %s overflows int", key)
+		return
+	}
+	return int(v), nil
+}
+
+func (p *Payload) GetContextInt32(key string) (val int32, err error) {
+	var v int64
+	if v, err = p.GetContextInt64(key); err != nil {
+		return
 	}
 
+	if v < math.MinInt32 || v > math.MaxInt32 {
+		err = fmt.Errorf("the value of context key %s overflows int32", key)
+		return
+	}
+	return int32(v), nil
+}
+
+func (p *Payload) GetContextInt64(key string) (val int64, err error) {
 	var v interface{}
-	exist := false
-	if v, exist = p.context[key]; !exist {
-		err = fmt.Errorf("the context key of %s is not exist", key)
+	if v, err = p.contextValue(key); err != nil {
 		return
 	}
 
-	if intVal, ok := v.(int); ok {
-		val = intVal
+	if val, err = contextInt64(v); err != nil {
+		err = fmt.Errorf("the type of context key %s is not int64, %v", key, err)
+	}
+	return
+}
+
+func (p *Payload) GetContextUint64(key string) (val uint64, err error) {
+	var v interface{}
+	if v, err = p.contextValue(key); err != nil {
 		return
-	} else {
-		err = fmt.Errorf("the type of context key %s is not int", key)
+	}
+
+	if val, err = contextUint64(v); err != nil {
+		err = fmt.Errorf("the type of context key %s is not uint64, %v", key, err)
 	}
 	return
 }
 
-func (p *Payload) GetContextInt32(key string) (val int32, err error) {
-	if p.context == nil {
-		return 0, fmt.Errorf("the context container is nil")
+func (p *Payload) GetContextFloat64(key string) (val float64, err error) {
+	var v interface{}
+	if v, err = p.contextValue(key); err != nil {
+		return
+	}
+
+	if val, err = contextFloat64(v); err != nil {
+		err = fmt.Errorf("the type of context key %s is not float64, %v", key, err)
 	}
+	return
+}
 
+// bool or the string of strconv.ParseBool
+func (p *Payload) GetContextBool(key string) (val bool, err error) {
 	var v interface{}
-	exist := false
-	if v, exist = p.context[key]; !exist {
-		err = fmt.Errorf("the context key of %s is not exist", key)
+	if v, err = p.contextValue(key); err != nil {
 		return
 	}
 
-	if intVal, ok := v.(int32); ok {
-		val = intVal
+	switch b := v.(type) {
+	case bool:
+		return b, nil
+	case string:
+		if val, err = strconv.ParseBool(b); err == nil {
+			return
+		}
+	}
+
+	err = fmt.Errorf("the type of context key %s is not bool", key)
+	return
+}
+
+// time.Time, the string of RFC3339 (json of time.Time), or the unix seconds
+func (p *Payload) GetContextTime(key string) (val time.Time, err error) {
+	var v interface{}
+	if v, err = p.contextValue(key); err != nil {
 		return
+	}
+
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		if val, err = time.Parse(time.RFC3339Nano, t); err == nil {
+			return
+		}
+	default:
+		var sec int64
+		if sec, err = contextInt64(v); err == nil {
+			return time.Unix(sec, 0), nil
+		}
+	}
+
+	err = fmt.Errorf("the type of context key %s is not time", key)
+	return
+}
+
+// time.Duration, the nanoseconds (json of time.Duration), or the string of
+// time.ParseDuration
+func (p *Payload) GetContextDuration(key string) (val time.Duration, err error) {
+	var v interface{}
+	if v, err = p.contextValue(key); err != nil {
+		return
+	}
+
+	if str, ok := v.(string); ok {
+		if val, err = time.ParseDuration(str); err == nil {
+			return
+		}
 	} else {
-		err = fmt.Errorf("the type of context key %s is not int32", key)
+		var ns int64
+		if ns, err = contextInt64(v); err == nil {
+			return time.Duration(ns), nil
+		}
 	}
+
+	err = fmt.Errorf("the type of context key %s is not duration", key)
 	return
 }
 
-func (p *Payload) GetContextInt64(key string) (val int64, err error) {
+func (p *Payload) contextValue(key string) (v interface{}, err error) {
 	if p.context == nil {
-		return 0, fmt.Errorf("the context container is nil")
+		return nil, fmt.Errorf("the context container is nil")
 	}
 
-	var v interface{}
 	exist := false
 	if v, exist = p.context[key]; !exist {
 		err = fmt.Errorf("the context key of %s is not exist", key)
-		return
-	}
-
-	if intVal, ok := v.(int64); ok {
-		val = intVal
-		return
-	} else {
-		err = fmt.Errorf("the type of context key %s is not int64", key)
 	}
 	return
 }
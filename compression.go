@@ -0,0 +1,243 @@
+package casper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strings"
+
+	"github.com/gogap/errors"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+// the id is in the zmq frame header next to the codec id
+const (
+	COMPRESSION_NONE   byte = 0x00
+	COMPRESSION_GZIP   byte = 0x01
+	COMPRESSION_ZSTD   byte = 0x02
+	COMPRESSION_SNAPPY byte = 0x03
+)
+
+const (
+	DefaultCompressThreshold = 64 * 1024
+)
+
+var (
+	compressors     map[string]Compressor = make(map[string]Compressor)
+	compressorsById map[byte]Compressor   = make(map[byte]Compressor)
+)
+
+// the message compressions
+//
+// like the codec, the compression of a component is the one it wants to
+// receive, the message is compressed only if the encoded message is larger
+// than the threshold, receivers decompress by the id in the packet
+//
+// Decompress fails with ERR_MESSAGE_TOO_LARGE if the data is larger than
+// max bytes, so a small packet could not expand without bound
+type Compressor interface {
+	Id() byte
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte, max int) ([]byte, error)
+}
+
+func init() {
+	RegisterCompressor(new(gzipCompressor))
+	RegisterCompressor(newZstdCompressor())
+	RegisterCompressor(new(snappyCompressor))
+}
+
+func RegisterCompressor(compressor Compressor) {
+	if compressor == nil {
+		panic("Register Compressor nil")
+	}
+	if compressor.Id() == COMPRESSION_NONE {
+		panic("Register Compressor with the id of none for " + compressor.Name())
+	}
+	if _, dup := compressors[compressor.Name()]; dup {
+		panic("Register Compressor duplicate for " + compressor.Name())
+	}
+	if _, dup := compressorsById[compressor.Id()]; dup {
+		panic(fmt.Sprintf("Register Compressor duplicate id %d for %s", compressor.Id(), compressor.Name()))
+	}
+	compressors[compressor.Name()] = compressor
+	compressorsById[compressor.Id()] = compressor
+}
+
+// the empty name is no compression, the compressor is nil
+func GetCompressor(name string) (compressor Compressor, err error) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "none" {
+		return nil, nil
+	}
+
+	if c, exist := compressors[name]; exist {
+		return c, nil
+	}
+
+	err = errorcode.ERR_COMPRESSION_NOT_EXIST.New(errors.Params{"compression": name})
+	return
+}
+
+func GetCompressorById(id byte) (compressor Compressor, err error) {
+	if c, exist := compressorsById[id]; exist {
+		return c, nil
+	}
+
+	err = errorcode.ERR_COMPRESSION_NOT_EXIST.New(errors.Params{"compression": id})
+	return
+}
+
+// Compress compresses the message of the packet if it is larger than the
+// threshold, threshold <= 0 is DefaultCompressThreshold
+func (p *Packet) Compress(compression string, threshold int) (err error) {
+	if p.Compression != COMPRESSION_NONE {
+		return
+	}
+
+	var compressor Compressor
+	if compressor, err = GetCompressor(compression); err != nil || compressor == nil {
+		return
+	}
+
+	if threshold <= 0 {
+		threshold = DefaultCompressThreshold
+	}
+
+	if len(p.Message) <= threshold {
+		return
+	}
+
+	var data []byte
+	if data, err = compressor.Compress(p.Message); err != nil {
+		return
+	}
+
+	p.Message = data
+	p.Compression = compressor.Id()
+	return
+}
+
+// Decompress decompresses the message up to max bytes, max <= 0 is
+// DefaultMaxMessageSize
+func (p *Packet) Decompress(max int) (err error) {
+	if p.Compression == COMPRESSION_NONE {
+		return
+	}
+
+	max = limitOrDefault(max, DefaultMaxMessageSize)
+
+	var compressor Compressor
+	if compressor, err = GetCompressorById(p.Compression); err != nil {
+		return
+	}
+
+	var data []byte
+	if data, err = compressor.Decompress(p.Message, max); err != nil {
+		return
+	}
+
+	p.Message = data
+	p.Compression = COMPRESSION_NONE
+	return
+}
+
+type gzipCompressor struct{}
+
+func (p *gzipCompressor) Id() byte {
+	return COMPRESSION_GZIP
+}
+
+func (p *gzipCompressor) Name() string {
+	return "gzip"
+}
+
+func (p *gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (p *gzipCompressor) Decompress(data []byte, max int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return readLimited(r, max)
+}
+
+// the encoder is safe for concurrent EncodeAll, the decoding is streamed to
+// stop at the max, so there is a decoder for each message
+type zstdCompressor struct {
+	encoder *zstd.Encoder
+}
+
+func newZstdCompressor() *zstdCompressor {
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	return &zstdCompressor{encoder: encoder}
+}
+
+func (p *zstdCompressor) Id() byte {
+	return COMPRESSION_ZSTD
+}
+
+func (p *zstdCompressor) Name() string {
+	return "zstd"
+}
+
+func (p *zstdCompressor) Compress(data []byte) ([]byte, error) {
+	return p.encoder.EncodeAll(data, nil), nil
+}
+
+func (p *zstdCompressor) Decompress(data []byte, max int) ([]byte, error) {
+	decoder, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+
+	return readLimited(decoder, max)
+}
+
+type snappyCompressor struct{}
+
+func (p *snappyCompressor) Id() byte {
+	return COMPRESSION_SNAPPY
+}
+
+func (p *snappyCompressor) Name() string {
+	return "snappy"
+}
+
+func (p *snappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+func (p *snappyCompressor) Decompress(data []byte, max int) ([]byte, error) {
+	size, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if size > max {
+		return nil, errorcode.ERR_MESSAGE_TOO_LARGE.New(errors.Params{"max": max, "at": "decompress"})
+	}
+
+	return snappy.Decode(nil, data)
+}
@@ -0,0 +1,63 @@
+package casper
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPacketCompression(t *testing.T) {
+	message := bytes.Repeat([]byte(`{"hello": "compression"}`), 64)
+
+	tests := []struct {
+		compression string
+		threshold   int
+		id          byte // COMPRESSION_NONE if it is not compressed
+	}{
+		{"", 1, COMPRESSION_NONE},
+		{"none", 1, COMPRESSION_NONE},
+		{"gzip", 0, COMPRESSION_NONE}, // DefaultCompressThreshold
+		{"gzip", len(message), COMPRESSION_NONE},
+		{"gzip", len(message) - 1, COMPRESSION_GZIP},
+		{"zstd", 1, COMPRESSION_ZSTD},
+		{"snappy", 1, COMPRESSION_SNAPPY},
+	}
+
+	for _, test := range tests {
+		packet := &Packet{Codec: CODEC_MSGPACK, Message: append([]byte{}, message...)}
+		if err := packet.Compress(test.compression, test.threshold); err != nil {
+			t.Fatalf("%s: %v", test.compression, err)
+		}
+
+		if packet.Compression != test.id {
+			t.Errorf("%s %d: compressed by %d, not %d", test.compression, test.threshold, packet.Compression, test.id)
+			continue
+		} else if test.id != COMPRESSION_NONE && len(packet.Message) >= len(message) {
+			t.Errorf("%s: the message is not smaller", test.compression)
+		}
+
+		// the compression is in the header of the frames
+		frames := NewZMQPacket(packet)
+		if header := frames[0]; (test.id == COMPRESSION_NONE && len(header) != 2) || (test.id != COMPRESSION_NONE && (len(header) != 3 || header[2] != test.id)) {
+			t.Errorf("%s: unexpected header %v", test.compression, header)
+		}
+
+		received, ok := ParseZMQPacket(frames)
+		if !ok || received.Codec != CODEC_MSGPACK || received.Compression != test.id {
+			t.Errorf("%s: parsed as %+v", test.compression, received)
+			continue
+		}
+
+		if err := received.Decompress(0); err != nil {
+			t.Errorf("%s: %v", test.compression, err)
+		} else if received.Compression != COMPRESSION_NONE || !bytes.Equal(received.Message, message) {
+			t.Errorf("%s: the message is not decompressed", test.compression)
+		}
+	}
+
+	if err := (&Packet{Message: message}).Compress("unknown", 1); err == nil {
+		t.Error("compressed by an unknown compression")
+	}
+	if err := (&Packet{Compression: 0x7f, Message: message}).Decompress(0); err == nil {
+		t.Error("decompressed by an unknown compression")
+	}
+}
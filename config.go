@@ -0,0 +1,533 @@
+package casper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/gogap/errors"
+	"github.com/gogap/logs"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+// ConfigError is a mistake of a config file, the line and the column are
+// 1-based, they are 0 if the position is unknown
+type ConfigError struct {
+	File   string
+	Line   int
+	Column int
+	Err    error
+}
+
+func (p *ConfigError) Error() string {
+	position := configPosition{file: p.File, line: p.Line, column: p.Column}.String()
+	if position == "" {
+		return p.Err.Error()
+	}
+	return fmt.Sprintf("%s: %v", position, p.Err)
+}
+
+// ConfigErrors are all the mistakes found while loading the configs, one
+// for a line
+type ConfigErrors []*ConfigError
+
+func (p ConfigErrors) Error() string {
+	msgs := make([]string, 0, len(p))
+	for _, e := range p {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// the errors as error, nil if there is none
+func (p ConfigErrors) errOrNil() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return p
+}
+
+// appends err, the errors of err are flattened if it is ConfigErrors
+func (p ConfigErrors) append(file string, err error) ConfigErrors {
+	switch e := err.(type) {
+	case nil:
+		return p
+	case ConfigErrors:
+		return append(p, e...)
+	case *ConfigError:
+		return append(p, e)
+	}
+	return append(p, &ConfigError{File: file, Err: err})
+}
+
+// the line and the column are 0 if they are unknown
+type configPosition struct {
+	file   string
+	line   int
+	column int
+}
+
+// file:line:column, the unknown parts are omitted
+func (p configPosition) String() string {
+	position := p.file
+	if p.line > 0 {
+		position = fmt.Sprintf("%s:%d", position, p.line)
+		if p.column > 0 {
+			position = fmt.Sprintf("%s:%d", position, p.column)
+		}
+		position = strings.TrimPrefix(position, ":")
+	}
+	return position
+}
+
+func (p configPosition) errorf(err error) *ConfigError {
+	return &ConfigError{File: p.file, Line: p.line, Column: p.column, Err: err}
+}
+
+// offsetPosition is the position of the byte offset of data
+func offsetPosition(file string, data []byte, offset int64) (pos configPosition) {
+	pos = configPosition{file: file, line: 1, column: 1}
+	for i := int64(0); i < offset && i < int64(len(data)); i++ {
+		if data[i] == '\n' {
+			pos.line++
+			pos.column = 1
+		} else {
+			pos.column++
+		}
+	}
+	return
+}
+
+// jsonError annotates the error of encoding/json with its position, base
+// is the offset of the decoded value in data
+func jsonError(file string, data []byte, base int64, err error) *ConfigError {
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		// the offset is after the invalid character
+		return offsetPosition(file, data, base+e.Offset-1).errorf(err)
+	case *json.UnmarshalTypeError:
+		return offsetPosition(file, data, base+e.Offset).errorf(err)
+	}
+	return &ConfigError{File: file, Err: err}
+}
+
+// the offset of the next value, after the spaces and the separators
+func skipJsonSeparators(data []byte, offset int64) int64 {
+	for offset < int64(len(data)) && strings.IndexByte(" \t\r\n:,", data[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+// the sections are the top level arrays of a config file, the entries are
+// the elements of them, as json, whatever the format of the file is, so
+// they are decoded by the json tags
+type configSections map[string][]configEntry
+
+type configEntry struct {
+	pos  configPosition
+	data json.RawMessage
+
+	// the json config and the offset of data in it, the errors of the json
+	// configs are at the exact position, not the entry
+	source []byte
+	offset int64
+}
+
+func (p *configEntry) decode(v interface{}) *ConfigError {
+	if err := json.Unmarshal(p.data, v); err != nil {
+		if p.source != nil {
+			return jsonError(p.pos.file, p.source, p.offset, err)
+		}
+		return p.pos.errorf(err)
+	}
+	return nil
+}
+
+type configScanner func(file string, data []byte) (configSections, *ConfigError)
+
+// the formats by the extension of the file, the others are json
+var configFormats map[string]configScanner = make(map[string]configScanner)
+
+func scanConfigSections(file string, data []byte) (sections configSections, err *ConfigError) {
+	if scan, exist := configFormats[strings.ToLower(filepath.Ext(file))]; exist {
+		return scan(file, data)
+	}
+	return scanJsonSections(file, data)
+}
+
+// the config values of the other formats as json
+func configValueToJson(v interface{}) (json.RawMessage, error) {
+	return json.Marshal(normalizeConfigValue(v))
+}
+
+// a copy of v, the keys of the maps are strings, as json could marshal it
+func normalizeConfigValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			m[fmt.Sprint(k)] = normalizeConfigValue(item)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			m[k] = normalizeConfigValue(item)
+		}
+		return m
+	case EntranceConfig:
+		return normalizeConfigValue(map[string]interface{}(val))
+	case []interface{}:
+		s := make([]interface{}, len(val))
+		for i, item := range val {
+			s[i] = normalizeConfigValue(item)
+		}
+		return s
+	}
+	return v
+}
+
+// the config sections should be arrays
+func configSectionError(pos configPosition, name string) *ConfigError {
+	return pos.errorf(errorcode.ERR_CONFIG_SECTION_INVALID.New(errors.Params{"section": name}))
+}
+
+func isConfigSection(name string) bool {
+	return name == "apps" || name == "components" || name == "handlers"
+}
+
+func scanJsonSections(file string, data []byte) (sections configSections, err *ConfigError) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	if tok, e := dec.Token(); e != nil {
+		return nil, jsonError(file, data, 0, e)
+	} else if tok != json.Delim('{') {
+		return nil, offsetPosition(file, data, 0).errorf(errorcode.ERR_CONFIG_INVALID.New(errors.Params{"err": "config should be an object"}))
+	}
+
+	sections = make(configSections)
+	for dec.More() {
+		tok, e := dec.Token()
+		if e != nil {
+			return nil, jsonError(file, data, 0, e)
+		}
+		name, _ := tok.(string)
+
+		base := skipJsonSeparators(data, dec.InputOffset())
+		var raw json.RawMessage
+		if e = dec.Decode(&raw); e != nil {
+			return nil, jsonError(file, data, 0, e)
+		}
+
+		if bytes.Equal(raw, []byte("null")) {
+			continue
+		} else if raw[0] != '[' {
+			if isConfigSection(name) {
+				return nil, configSectionError(offsetPosition(file, data, base), name)
+			}
+			continue
+		}
+
+		// the elements of the array
+		arr := json.NewDecoder(bytes.NewReader(raw))
+		arr.Token()
+		for arr.More() {
+			offset := base + skipJsonSeparators(raw, arr.InputOffset())
+			entry := configEntry{pos: offsetPosition(file, data, offset), source: data, offset: offset}
+			if e = arr.Decode(&entry.data); e != nil {
+				return nil, jsonError(file, data, base, e)
+			}
+			sections[name] = append(sections[name], entry)
+		}
+	}
+
+	if _, e := dec.Token(); e != nil {
+		return nil, jsonError(file, data, 0, e)
+	}
+
+	// nothing but the spaces after the config
+	if offset := skipJsonSeparators(data, dec.InputOffset()); offset < int64(len(data)) {
+		return nil, offsetPosition(file, data, offset).errorf(errorcode.ERR_CONFIG_INVALID.New(errors.Params{"err": "invalid data after the config"}))
+	}
+	return
+}
+
+// LoadConfig reads the apps and the components of the config file, all the
+// mistakes are reported, with the line and the column of each
+//
+// the format is by the extension, .yaml, .yml and .toml, or json, the keys
+// are the json tags in all the formats, ${NAME:-default} is the environment
+// variable, see config_env.go, the configs are checked by Validate
+func LoadConfig(filePath string) (conf *CasperConfigs, err error) {
+	return LoadConfigs(filePath)
+}
+
+// LoadConfigs loads the base config and then the overlays over it, e.g. the
+// config of the environment, the apps and the components of the same name
+// are merged, see mergeConfigSections
+func LoadConfigs(filePaths ...string) (conf *CasperConfigs, err error) {
+	var errs ConfigErrors
+	var sections configSections
+	for _, filePath := range filePaths {
+		s, e := readConfigSections(filePath)
+		if e != nil {
+			errs = append(errs, e...)
+			continue
+		}
+		sections = mergeConfigSections(sections, s)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return decodeConfigSections(sections)
+}
+
+// ParseConfig parses the config of data, file is the name in the errors and
+// the extension of it is the format
+func ParseConfig(file string, data []byte) (conf *CasperConfigs, err error) {
+	sections, errs := parseConfigSections(file, data)
+	if errs != nil {
+		return nil, errs
+	}
+	return decodeConfigSections(sections)
+}
+
+func readConfigSections(filePath string) (sections configSections, errs ConfigErrors) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		errs = ConfigErrors{{File: filePath, Err: errorcode.ERR_OPENFILE_ERROR.New(errors.Params{"fileName": filePath, "err": err})}}
+		return
+	}
+	return parseConfigSections(filePath, data)
+}
+
+func parseConfigSections(file string, data []byte) (sections configSections, errs ConfigErrors) {
+	if data, errs = expandConfigNumbers(file, data); errs != nil {
+		return
+	}
+
+	sections, err := scanConfigSections(file, data)
+	if err != nil {
+		return nil, ConfigErrors{err}
+	}
+
+	if errs = expandConfigSections(sections); errs != nil {
+		return nil, errs
+	}
+	return
+}
+
+func decodeConfigSections(sections configSections) (conf *CasperConfigs, err error) {
+	conf = &CasperConfigs{}
+
+	var errs ConfigErrors
+	for _, entry := range sections["components"] {
+		compConf := ComponentConfig{}
+		if e := entry.decode(&compConf); e != nil {
+			errs = append(errs, e)
+			continue
+		}
+		conf.Components = append(conf.Components, compConf)
+		conf.compPositions = append(conf.compPositions, entry.pos)
+	}
+
+	for _, entry := range sections["apps"] {
+		appConf := AppConfig{}
+		if e := entry.decode(&appConf); e != nil {
+			errs = append(errs, e)
+			continue
+		}
+		conf.Apps = append(conf.Apps, appConf)
+		conf.appPositions = append(conf.appPositions, entry.pos)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	if err = conf.Validate(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// the name of the entry, the entries of the same name are merged
+func (p *configEntry) key() string {
+	var entry struct {
+		Name          string `json:"name"`
+		ComponentName string `json:"component_name"`
+	}
+	json.Unmarshal(p.data, &entry)
+
+	if entry.Name != "" {
+		return entry.Name
+	}
+	return entry.ComponentName
+}
+
+// mergeConfigSections merges the entries of overlay into base, the entry of
+// a new name is appended, the entry of the same name is merged over the one
+// of base, the objects key by key, the other values are replaced, so the
+// overlay only has what is different, null removes the value of base
+func mergeConfigSections(base, overlay configSections) configSections {
+	if base == nil {
+		return overlay
+	}
+
+	for name, entries := range overlay {
+		for _, entry := range entries {
+			key, merged := entry.key(), false
+			for i, baseEntry := range base[name] {
+				if key != "" && baseEntry.key() == key {
+					base[name][i] = baseEntry.merge(entry)
+					merged = true
+					break
+				}
+			}
+
+			if !merged {
+				base[name] = append(base[name], entry)
+			}
+		}
+	}
+	return base
+}
+
+// the position is of the overlay, the mistakes are most likely in it
+func (p configEntry) merge(overlay configEntry) configEntry {
+	var base, over interface{}
+	if decodeJsonValue(p.data, &base) != nil || decodeJsonValue(overlay.data, &over) != nil {
+		return overlay
+	}
+
+	data, err := json.Marshal(mergeConfigValue(base, over))
+	if err != nil {
+		return overlay
+	}
+	return configEntry{pos: overlay.pos, data: data}
+}
+
+func mergeConfigValue(base, overlay interface{}) interface{} {
+	baseMap, ok := base.(map[string]interface{})
+	if !ok {
+		return overlay
+	}
+	overlayMap, ok := overlay.(map[string]interface{})
+	if !ok {
+		return overlay
+	}
+
+	for k, v := range overlayMap {
+		baseMap[k] = mergeConfigValue(baseMap[k], v)
+	}
+	return baseMap
+}
+
+// the numbers are json.Number, so the large integers are kept
+func decodeJsonValue(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func (p *CasperConfigs) componentError(i int, err error) *ConfigError {
+	return p.componentPosition(i).errorf(err)
+}
+
+func (p *CasperConfigs) appError(i int, err error) *ConfigError {
+	return p.appPosition(i).errorf(err)
+}
+
+// Build creates the components, and then the apps of the configs, the ones
+// which could not be created are reported together
+func (p *CasperConfigs) Build() (err error) {
+	errs := ConfigErrors{}.append("", p.buildComponents())
+
+	for i, appConf := range p.Apps {
+		if _, e := NewApp(appConf); e != nil {
+			errs = append(errs, p.appError(i, e))
+		}
+	}
+	return errs.errOrNil()
+}
+
+func (p *CasperConfigs) buildComponents() (err error) {
+	var errs ConfigErrors
+	for i, compConf := range p.Components {
+		if _, e := NewComponent(compConf); e != nil {
+			errs = append(errs, p.componentError(i, e))
+		}
+	}
+	return errs.errOrNil()
+}
+
+// LoadApp creates the components and the apps of the config file
+func LoadApp(filePath string) (err error) {
+	return LoadApps([]string{filePath})
+}
+
+// LoadApps creates the components and the apps of the files, the later
+// files are the overlays of the former ones, see LoadConfigs, the files are
+// reloaded while running only if they are watched, see WatchConfig
+func LoadApps(filePaths []string) (err error) {
+	var conf *CasperConfigs
+	if conf, err = LoadConfigs(filePaths...); err != nil {
+		return
+	}
+	return conf.Build()
+}
+
+// LoadComponents creates the components of the config files, the apps are
+// ignored
+func LoadComponents(fileNames ...string) (err error) {
+	logs.Info("load components config file:", fileNames)
+
+	var conf *CasperConfigs
+	if conf, err = LoadConfigs(fileNames...); err != nil {
+		return
+	}
+	return conf.buildComponents()
+}
+
+// LoadHandlerRotatorConfig reads the default handlers of the components for
+// NewHandlerRotator
+func LoadHandlerRotatorConfig(configPaths ...string) (err error) {
+	var errs ConfigErrors
+	var sections configSections
+	for _, configPath := range configPaths {
+		s, e := readConfigSections(configPath)
+		if e != nil {
+			errs = append(errs, e...)
+			continue
+		}
+		sections = mergeConfigSections(sections, s)
+	}
+
+	handlers := map[string]string{}
+	for _, entry := range sections["handlers"] {
+		var conf struct {
+			Name    string `json:"component_name"`
+			Handler string `json:"handler"`
+		}
+		if e := entry.decode(&conf); e != nil {
+			errs = append(errs, e)
+			continue
+		}
+		handlers[conf.Name] = conf.Handler
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	for name, handler := range handlers {
+		rotatorConfig[name] = handler
+	}
+	return
+}
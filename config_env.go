@@ -0,0 +1,209 @@
+package casper
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gogap/errors"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+var configEnvName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var configEnvNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// ${NAME} is the environment variable, ${NAME:-default} is the default if
+// it is unset or empty, $${ is a literal ${, the variables without value
+// and default are errors
+//
+// the placeholders are expanded in the string values after the config is
+// parsed, so the values could have quotes, backslashes or newlines, and the
+// keys are never expanded, see expandConfigSections
+//
+// the only placeholders expanded in the text are the unquoted whole values
+// of numbers, e.g. "port": ${PORT:-8080}, see expandConfigNumbers
+
+// envPlaceholder expands the placeholder at the start of s, n is the bytes
+// of it
+func envPlaceholder(s string) (value string, n int, err error) {
+	end := strings.IndexAny(s, "}\n")
+	if end < 0 || s[end] != '}' {
+		return "", 2, errorcode.ERR_CONFIG_INVALID.New(errors.Params{"err": "${ is not closed"})
+	}
+
+	expr := s[2:end]
+	n = end + 1
+
+	name, def, hasDefault := expr, "", false
+	if sep := strings.Index(expr, ":-"); sep >= 0 {
+		name, def, hasDefault = expr[:sep], expr[sep+2:], true
+	}
+
+	if !configEnvName.MatchString(name) {
+		err = errorcode.ERR_CONFIG_INVALID.New(errors.Params{"err": "invalid environment variable ${" + expr + "}"})
+		return
+	}
+
+	value, exist := os.LookupEnv(name)
+	switch {
+	case value != "":
+	case hasDefault:
+		value = def
+	case !exist:
+		err = errorcode.ERR_CONFIG_ENV_NOT_SET.New(errors.Params{"name": name})
+	}
+	return
+}
+
+// expandEnvString expands all the placeholders of s
+func expandEnvString(s string) (expanded string, errs []error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var buf strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "$${"):
+			buf.WriteString("${")
+			i += 3
+		case strings.HasPrefix(s[i:], "${"):
+			value, n, err := envPlaceholder(s[i:])
+			if err != nil {
+				errs = append(errs, err)
+			}
+			buf.WriteString(value)
+			i += n
+		default:
+			buf.WriteByte(s[i])
+			i++
+		}
+	}
+	return buf.String(), errs
+}
+
+// expandConfigNumbers expands the placeholders which are whole values and
+// not quoted, if they are numbers, the others are left to the strings of
+// expandConfigSections, e.g. a plain string of yaml
+func expandConfigNumbers(file string, data []byte) (expanded []byte, errs ConfigErrors) {
+	if !bytes.Contains(data, []byte("${")) {
+		return data, nil
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)))
+	for i := 0; i < len(data); {
+		if bytes.HasPrefix(data[i:], []byte("$${")) {
+			buf.Write(data[i : i+3])
+			i += 3
+			continue
+		} else if !bytes.HasPrefix(data[i:], []byte("${")) {
+			buf.WriteByte(data[i])
+			i++
+			continue
+		}
+
+		end := bytes.IndexAny(data[i:], "}\n")
+		if end < 0 || data[i+end] != '}' || !isWholeConfigValue(data, i, i+end+1) {
+			buf.WriteString("${")
+			i += 2
+			continue
+		}
+
+		value, n, err := envPlaceholder(string(data[i : i+end+1]))
+		if err != nil {
+			errs = append(errs, offsetPosition(file, data, int64(i)).errorf(err))
+		}
+
+		if err == nil && configEnvNumber.MatchString(value) {
+			buf.WriteString(value)
+		} else {
+			buf.Write(data[i : i+n])
+		}
+		i += n
+	}
+
+	return buf.Bytes(), errs
+}
+
+// the value of data[start:end] is not in a string, it is after the key or
+// in an array, and nothing but a comment is after it
+func isWholeConfigValue(data []byte, start, end int) bool {
+	before := start - 1
+	for before >= 0 && (data[before] == ' ' || data[before] == '\t') {
+		before--
+	}
+	if before < 0 || strings.IndexByte(":=[,-", data[before]) < 0 {
+		return false
+	}
+
+	for end < len(data) && (data[end] == ' ' || data[end] == '\t') {
+		end++
+	}
+	return end == len(data) || strings.IndexByte(",]}\r\n#", data[end]) >= 0
+}
+
+// expandConfigSections expands the placeholders of the string values of the
+// entries, the values are decoded, so they are json escaped as they are
+// encoded again
+func expandConfigSections(sections configSections) (errs ConfigErrors) {
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		entries := sections[name]
+		for i := range entries {
+			entry := &entries[i]
+			if !bytes.Contains(entry.data, []byte("${")) {
+				continue
+			}
+
+			var value interface{}
+			if err := decodeJsonValue(entry.data, &value); err != nil {
+				errs = append(errs, entry.pos.errorf(err))
+				continue
+			}
+
+			var entryErrs []error
+			value = expandConfigValue(value, &entryErrs)
+			for _, err := range entryErrs {
+				errs = append(errs, entry.pos.errorf(err))
+			}
+
+			data, err := json.Marshal(value)
+			if err != nil {
+				errs = append(errs, entry.pos.errorf(err))
+				continue
+			}
+
+			// the offsets of the source are not of the new data
+			entry.data, entry.source, entry.offset = data, nil, 0
+		}
+	}
+	return
+}
+
+func expandConfigValue(v interface{}, errs *[]error) interface{} {
+	switch val := v.(type) {
+	case string:
+		expanded, e := expandEnvString(val)
+		*errs = append(*errs, e...)
+		return expanded
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = expandConfigValue(item, errs)
+		}
+	case []interface{}:
+		for i, item := range val {
+			val[i] = expandConfigValue(item, errs)
+		}
+	}
+	return v
+}
@@ -0,0 +1,177 @@
+package casper
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gogap/errors"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+// the first entry of the section, decoded with the numbers as json.Number
+func firstConfigEntry(t *testing.T, sections configSections, section string) map[string]interface{} {
+	if len(sections[section]) == 0 {
+		t.Fatalf("no entry in %s", section)
+	}
+
+	entry := map[string]interface{}{}
+	if err := decodeJsonValue(sections[section][0].data, &entry); err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+func TestConfigEnvInterpolation(t *testing.T) {
+	t.Setenv("CASPER_TEST_HOST", "10.0.0.1")
+	t.Setenv("CASPER_TEST_QUOTED", `say "hi" \ bye`)
+	t.Setenv("CASPER_TEST_EMPTY", "")
+
+	configs := map[string]string{
+		"casper.json": `{"components": [{
+			"name": "${CASPER_TEST_NAME:-comp}",
+			"in": "tcp://${CASPER_TEST_HOST}:5001",
+			"port": ${CASPER_TEST_PORT:-8080},
+			"ports": [${CASPER_TEST_PORT:-8081}, 8082],
+			"description": "${CASPER_TEST_QUOTED}",
+			"literal": "$${CASPER_TEST_HOST}",
+			"empty": "${CASPER_TEST_EMPTY:-default}",
+			"inline": "port: ${CASPER_TEST_PORT:-8080}"
+		}]}`,
+		"casper.yaml": `components:
+  - name: ${CASPER_TEST_NAME:-comp}
+    in: "tcp://${CASPER_TEST_HOST}:5001"
+    port: ${CASPER_TEST_PORT:-8080}
+    ports: [${CASPER_TEST_PORT:-8081}, 8082]
+    description: ${CASPER_TEST_QUOTED}
+    literal: "$${CASPER_TEST_HOST}"
+    empty: ${CASPER_TEST_EMPTY:-default}
+    inline: "port: ${CASPER_TEST_PORT:-8080}"
+`,
+		"casper.toml": `[[components]]
+name = "${CASPER_TEST_NAME:-comp}"
+in = "tcp://${CASPER_TEST_HOST}:5001"
+port = ${CASPER_TEST_PORT:-8080}
+ports = [${CASPER_TEST_PORT:-8081}, 8082]
+description = "${CASPER_TEST_QUOTED}"
+literal = "$${CASPER_TEST_HOST}"
+empty = "${CASPER_TEST_EMPTY:-default}"
+inline = "port: ${CASPER_TEST_PORT:-8080}"
+`,
+	}
+
+	for file, config := range configs {
+		sections, errs := parseConfigSections(file, []byte(config))
+		if errs != nil {
+			t.Fatalf("%s: %v", file, errs)
+		}
+
+		entry := firstConfigEntry(t, sections, "components")
+		expected := map[string]string{
+			"name":        "comp",
+			"in":          "tcp://10.0.0.1:5001",
+			"description": `say "hi" \ bye`,
+			"literal":     "${CASPER_TEST_HOST}",
+			"empty":       "default",
+			"inline":      "port: 8080",
+		}
+		for key, value := range expected {
+			if entry[key] != value {
+				t.Errorf("%s: %s is %#v, not %q", file, key, entry[key], value)
+			}
+		}
+
+		if port, ok := entry["port"].(json.Number); !ok || port.String() != "8080" {
+			t.Errorf("%s: port is %#v, not the number 8080", file, entry["port"])
+		}
+		if ports, ok := entry["ports"].([]interface{}); !ok || len(ports) != 2 || ports[0] != json.Number("8081") {
+			t.Errorf("%s: ports is %#v", file, entry["ports"])
+		}
+	}
+}
+
+func TestConfigEnvErrors(t *testing.T) {
+	configs := map[string]uint64{
+		`{"components": [{"name": "${CASPER_TEST_UNSET}"}]}`: errorcode.ERR_CONFIG_ENV_NOT_SET.New().Code(),
+		`{"components": [{"port": ${CASPER_TEST_UNSET}}]}`:   errorcode.ERR_CONFIG_ENV_NOT_SET.New().Code(),
+		`{"components": [{"name": "${CASPER-TEST}"}]}`:       errorcode.ERR_CONFIG_INVALID.New().Code(),
+		`{"components": [{"name": "${CASPER_TEST_UNSET"}]}`:  errorcode.ERR_CONFIG_INVALID.New().Code(),
+	}
+
+	for config, code := range configs {
+		_, errs := parseConfigSections("casper.json", []byte(config))
+		if len(errs) != 1 {
+			t.Errorf("%s: expected an error, got %v", config, errs)
+			continue
+		}
+
+		if err, ok := errs[0].Err.(errors.ErrCode); !ok || err.Code() != code {
+			t.Errorf("%s: expected the error %d, got %v", config, code, errs[0])
+		}
+	}
+
+	// the placeholders of the keys are kept
+	sections, errs := parseConfigSections("casper.json", []byte(`{"components": [{"${CASPER_TEST_UNSET}": 1}]}`))
+	if errs != nil {
+		t.Fatal(errs)
+	} else if _, exist := firstConfigEntry(t, sections, "components")["${CASPER_TEST_UNSET}"]; !exist {
+		t.Error("the key is expanded")
+	}
+}
+
+func TestConfigOverlayMerge(t *testing.T) {
+	t.Setenv("CASPER_TEST_HOST", "10.0.0.2")
+
+	base, errs := parseConfigSections("casper.json", []byte(`{
+		"components": [
+			{"name": "a", "description": "base a", "in": "tcp://127.0.0.1:5001", "max_message_size": 1024},
+			{"name": "b", "description": "base b", "in": "tcp://127.0.0.1:5002"}
+		]
+	}`))
+	if errs != nil {
+		t.Fatal(errs)
+	}
+
+	overlay, errs := parseConfigSections("prod.yaml", []byte(`components:
+  - name: a
+    in: tcp://${CASPER_TEST_HOST}:5001
+    max_message_size: null
+  - name: c
+    in: tcp://${CASPER_TEST_HOST}:5003
+`))
+	if errs != nil {
+		t.Fatal(errs)
+	}
+
+	merged := mergeConfigSections(base, overlay)["components"]
+	if len(merged) != 3 {
+		t.Fatalf("expected a, b and c, got %d components", len(merged))
+	}
+
+	names := []string{}
+	for _, entry := range merged {
+		names = append(names, entry.key())
+	}
+	if strings.Join(names, ",") != "a,b,c" {
+		t.Fatalf("expected a, b and c, got %v", names)
+	}
+
+	a := map[string]interface{}{}
+	if err := decodeJsonValue(merged[0].data, &a); err != nil {
+		t.Fatal(err)
+	}
+
+	if a["in"] != "tcp://10.0.0.2:5001" {
+		t.Errorf("in of a is %v, it should be of the overlay", a["in"])
+	}
+	if a["description"] != "base a" {
+		t.Errorf("description of a is %v, it should be kept from the base", a["description"])
+	}
+	if a["max_message_size"] != nil {
+		t.Errorf("max_message_size of a should be removed by null, it is %v", a["max_message_size"])
+	}
+	if merged[0].pos.file != "prod.yaml" {
+		t.Errorf("the position of a is %v, it should be of the overlay", merged[0].pos)
+	}
+}
@@ -0,0 +1,43 @@
+package casper
+
+import (
+	"testing"
+)
+
+func TestConfigErrorPositions(t *testing.T) {
+	// the column of a type error is where the decoder stopped in the value,
+	// it is not checked if it is 0
+	type position struct {
+		line, column int
+	}
+
+	tests := []struct {
+		name      string
+		config    string
+		positions []position
+	}{
+		{"syntax", "{\n  \"components\": [\n    {\"name\": \"a\",}\n  ]\n}", []position{{3, 18}}},
+		{"not an object", "[]", []position{{1, 1}}},
+		{"section", "{\n  \"apps\": {}\n}", []position{{2, 11}}},
+		{"type", "{\"components\": [\n  {\"name\": \"a\"},\n  {\"name\": 1}\n]}", []position{{3, 0}}},
+		{"types of the entries", "{\"components\": [\n  {\"name\": 1},\n  {\"name\": \"b\", \"mq_type\": 2}\n],\n\"apps\": [{\"graphs\": []}]}",
+			[]position{{2, 0}, {3, 0}, {5, 0}}},
+		{"after the config", "{}\n}", []position{{2, 1}}},
+	}
+
+	for _, test := range tests {
+		_, err := ParseConfig("casper.json", []byte(test.config))
+
+		errs, ok := err.(ConfigErrors)
+		if !ok || len(errs) != len(test.positions) {
+			t.Errorf("%s: expected %d errors, got %v", test.name, len(test.positions), err)
+			continue
+		}
+
+		for i, e := range errs {
+			if e.File != "casper.json" || e.Line != test.positions[i].line || (test.positions[i].column != 0 && e.Column != test.positions[i].column) {
+				t.Errorf("%s: expected the error at %v, got %v", test.name, test.positions[i], e)
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package casper
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/gogap/errors"
+	"github.com/pelletier/go-toml"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+// the position of the toml errors, (line, column): message
+var tomlErrorPosition = regexp.MustCompile(`^\((\d+), (\d+)\): (.*)$`)
+
+func init() {
+	configFormats[".toml"] = scanTomlSections
+}
+
+func tomlPosition(file string, pos toml.Position) configPosition {
+	return configPosition{file: file, line: pos.Line, column: pos.Col}
+}
+
+func tomlError(file string, err error) *ConfigError {
+	if m := tomlErrorPosition.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		column, _ := strconv.Atoi(m[2])
+		return configPosition{file: file, line: line, column: column}.errorf(errorcode.ERR_CONFIG_INVALID.New(errors.Params{"err": m[3]}))
+	}
+	return &ConfigError{File: file, Err: errorcode.ERR_CONFIG_INVALID.New(errors.Params{"err": err})}
+}
+
+// the sections are the arrays of tables, [[apps]] and [[components]], or
+// the arrays of the inline tables
+func scanTomlSections(file string, data []byte) (sections configSections, err *ConfigError) {
+	tree, e := toml.LoadBytes(data)
+	if e != nil {
+		return nil, tomlError(file, e)
+	}
+
+	sections = make(configSections)
+	for _, name := range tree.Keys() {
+		if !isConfigSection(name) {
+			continue
+		}
+
+		pos := tomlPosition(file, tree.GetPosition(name))
+
+		var items []interface{}
+		switch value := tree.Get(name).(type) {
+		case []*toml.Tree:
+			for _, item := range value {
+				items = append(items, item)
+			}
+		case []interface{}:
+			items = value
+		default:
+			return nil, configSectionError(pos, name)
+		}
+
+		for _, item := range items {
+			entry := configEntry{pos: pos}
+
+			v := item
+			if t, ok := item.(*toml.Tree); ok {
+				// the inline tables have no position
+				if !t.Position().Invalid() {
+					entry.pos = tomlPosition(file, t.Position())
+				}
+				v = t.ToMap()
+			}
+
+			if entry.data, e = configValueToJson(v); e != nil {
+				return nil, entry.pos.errorf(errorcode.ERR_CONFIG_INVALID.New(errors.Params{"err": e}))
+			}
+			sections[name] = append(sections[name], entry)
+		}
+	}
+	return
+}
@@ -0,0 +1,68 @@
+package casper
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTomlConfig(t *testing.T) {
+	expected, err := ParseConfig("casper.json", []byte(formatTestJsonConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file         string
+		config       string
+		line, column int // of the error, 0 if it is loaded
+	}{
+		{"casper.toml", `[[components]]
+name = "f.a"
+mq_type = "zmq"
+in = "tcp://127.0.0.1:5001"
+codec = "msgpack"
+compress_threshold = 65536
+
+[[apps]]
+name = "f.app"
+mq_type = "zmq"
+in = "tcp://127.0.0.1:5002"
+
+[apps.entrance]
+type = "martini"
+options = {host = "127.0.0.1", port = 8080, cors = ["*"]}
+
+[apps.graphs]
+g = ["self", "f.a"]
+`, 0, 0},
+		{"inline.toml", `components = [
+  {name = "f.a", mq_type = "zmq", in = "tcp://127.0.0.1:5001", codec = "msgpack", compress_threshold = 65536},
+]
+apps = [
+  {name = "f.app", mq_type = "zmq", in = "tcp://127.0.0.1:5002", entrance = {type = "martini", options = {host = "127.0.0.1", port = 8080, cors = ["*"]}}, graphs = {g = ["self", "f.a"]}},
+]
+`, 0, 0},
+		{"syntax.toml", "[[components]]\nname = \"f.a\"\nin = = 1\nmq_type = \"zmq\"\n", 3, 6},
+		{"section.toml", "[components]\nname = \"f.a\"\n", 1, 1},
+		{"type.toml", "[[components]]\nname = \"f.a\"\n\n[[components]]\nname = [\"f.b\"]\n", 4, 1},
+	}
+
+	for _, test := range tests {
+		conf, err := loadFormatTestConfig(t, test.file, test.config)
+		if test.line == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", test.file, err)
+			} else if !reflect.DeepEqual(conf.Components, expected.Components) || !reflect.DeepEqual(conf.Apps, expected.Apps) {
+				t.Errorf("%s: loaded %+v, not %+v", test.file, conf, expected)
+			}
+			continue
+		}
+
+		if errs, ok := err.(ConfigErrors); !ok || len(errs) != 1 {
+			t.Errorf("%s: expected an error, got %v", test.file, err)
+		} else if errs[0].Line != test.line || errs[0].Column != test.column || filepath.Base(errs[0].File) != test.file {
+			t.Errorf("%s: expected the error at %d:%d, got %v", test.file, test.line, test.column, errs[0])
+		}
+	}
+}
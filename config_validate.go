@@ -0,0 +1,196 @@
+package casper
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gogap/errors"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+// the entrance factories which could tell the registered entrance types
+type entranceChecker interface {
+	EntranceExist(typ string) bool
+}
+
+// the registry checks are warnings, see AllowUnknownTypes
+var allowUnknownTypes bool
+
+// AllowUnknownTypes makes the unknown entrances, mq types, codecs,
+// compressions and taps the warnings of Validate instead of the errors, for
+// the tools which do not have the custom ones registered, e.g. the cli
+func AllowUnknownTypes(allow bool) {
+	allowUnknownTypes = allow
+}
+
+// Warnings are the mistakes which are allowed by AllowUnknownTypes
+func (p *CasperConfigs) Warnings() ConfigErrors {
+	return p.warnings
+}
+
+// Validate checks the configs before anything is created, all the mistakes
+// are reported together:
+//
+//   - the names and the in addresses of the components and the apps are unique
+//   - the mq types are registered, and the urls are valid for them
+//   - the codecs, the compressions and the entrance types are registered
+//   - the taps are registered, or the zmq urls of them are valid
+//   - the components of the graphs exist, in the configs or already created
+//   - the blob stores are the same one, the thresholds are not negative
+func (p *CasperConfigs) Validate() (err error) {
+	var errs ConfigErrors
+
+	p.warnings = nil
+	unknown := func(e *ConfigError) {
+		if allowUnknownTypes {
+			p.warnings = append(p.warnings, e)
+		} else {
+			errs = append(errs, e)
+		}
+	}
+
+	names := map[string]configPosition{}
+	ins := map[string]string{}
+	inPositions := map[string]configPosition{}
+
+	// the blob store is shared by the process, see SetBlobStore
+	blobStore, blobName := "", ""
+
+	check := func(conf ComponentConfig, errorf func(error) *ConfigError, pos configPosition) {
+		if first, exist := names[conf.Name]; exist {
+			errs = append(errs, errorf(errorcode.ERR_CONFIG_DUPLICATE_NAME.New(errors.Params{"name": conf.Name, "at": first.String()})))
+		} else {
+			names[conf.Name] = pos
+		}
+
+		mistakes, unknowns := validateComponentConfig(conf)
+		for _, e := range mistakes {
+			errs = append(errs, errorf(e))
+		}
+		for _, e := range unknowns {
+			unknown(errorf(e))
+		}
+
+		if conf.BlobStore != "" {
+			if blobStore == "" {
+				blobStore, blobName = conf.BlobStore, conf.Name
+			} else if conf.BlobStore != blobStore {
+				errs = append(errs, errorf(errorcode.ERR_CONFIG_INVALID.New(errors.Params{"err": fmt.Sprintf("blob_store %s of %s differs from %s of %s", conf.BlobStore, conf.Name, blobStore, blobName)})))
+			}
+		}
+
+		if conf.In == "" {
+			return
+		}
+		if other, exist := ins[conf.In]; exist {
+			errs = append(errs, errorf(errorcode.ERR_CONFIG_DUPLICATE_IN.New(errors.Params{"in": conf.In, "name": conf.Name, "other": other, "at": inPositions[conf.In].String()})))
+		} else {
+			ins[conf.In], inPositions[conf.In] = conf.Name, pos
+		}
+	}
+
+	for i, compConf := range p.Components {
+		i := i
+		check(compConf, func(e error) *ConfigError { return p.componentError(i, e) }, p.componentPosition(i))
+	}
+
+	for i, appConf := range p.Apps {
+		i := i
+		errorf := func(e error) *ConfigError { return p.appError(i, e) }
+		check(appConf.ComponentConfig(), errorf, p.appPosition(i))
+
+		if checker, ok := entrancefactory.(entranceChecker); ok && !checker.EntranceExist(appConf.Entrance.Type) {
+			unknown(errorf(errorcode.ERR_ENTRANCE_NOT_EXIST.New(errors.Params{"type": appConf.Entrance.Type})))
+		}
+
+		// sorted, so are the errors
+		graphNames := make([]string, 0, len(appConf.Graphs))
+		for graphName := range appConf.Graphs {
+			graphNames = append(graphNames, graphName)
+		}
+		sort.Strings(graphNames)
+
+		for _, graphName := range graphNames {
+			graph := appConf.Graphs[graphName]
+			if len(graph) == 0 {
+				errs = append(errs, errorf(errorcode.ERR_GRAPH_IS_EMPTY.New(errors.Params{"name": graphName})))
+			}
+
+			for j, compName := range graph {
+				if j == 0 && compName == "self" {
+					continue
+				} else if _, exist := names[compName]; exist || p.hasComponent(compName) || GetComponentByName(compName) != nil {
+					continue
+				}
+				errs = append(errs, errorf(errorcode.ERR_GRAPH_COMPONENT_NOT_EXIST.New(errors.Params{"component": compName, "graph": graphName})))
+			}
+		}
+	}
+
+	return errs.errOrNil()
+}
+
+// the checks of a single component, the ones of the others are in Validate,
+// unknowns are the types which are not registered, the taps might be the
+// ones registered by RegisterTap
+func validateComponentConfig(conf ComponentConfig) (errs, unknowns []error) {
+	if conf.MQType == "" {
+		errs = append(errs, errorcode.ERR_COMPONENT_MQTYPE_IS_EMPTY.New(errors.Params{"name": conf.Name}))
+	} else if _, exist := mqs[conf.MQType]; !exist {
+		unknowns = append(unknowns, errorcode.ERR_MQ_TYPE_NOT_EXIST.New(errors.Params{"name": conf.Name, "mqType": conf.MQType}))
+	} else if conf.In != "" {
+		if e := checkMqUrl(conf.MQType, conf.In); e != nil {
+			errs = append(errs, e)
+		}
+	}
+
+	if conf.In == "" {
+		errs = append(errs, errorcode.ERR_COMPONENT_IN_IS_EMPTY.New(errors.Params{"name": conf.Name}))
+	}
+
+	if _, e := GetCodec(conf.Codec); e != nil {
+		unknowns = append(unknowns, e)
+	}
+
+	if _, e := GetCompressor(conf.Compression); e != nil {
+		unknowns = append(unknowns, e)
+	}
+
+	if conf.Tap != "" {
+		if e := checkTapUrl(conf.Tap); e != nil {
+			unknowns = append(unknowns, e)
+		}
+	}
+
+	if conf.BlobThreshold < 0 {
+		errs = append(errs, errorcode.ERR_CONFIG_INVALID.New(errors.Params{"err": fmt.Sprintf("blob_threshold of %s is negative: %d", conf.Name, conf.BlobThreshold)}))
+	} else if conf.BlobThreshold > 0 && conf.BlobStore == "" {
+		errs = append(errs, errorcode.ERR_CONFIG_INVALID.New(errors.Params{"err": fmt.Sprintf("blob_threshold of %s is set without blob_store", conf.Name)}))
+	}
+	return
+}
+
+// the apps are the components of the graphs as well
+func (p *CasperConfigs) hasComponent(name string) bool {
+	for _, appConf := range p.Apps {
+		if appConf.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *CasperConfigs) componentPosition(i int) configPosition {
+	if i < len(p.compPositions) {
+		return p.compPositions[i]
+	}
+	return configPosition{}
+}
+
+func (p *CasperConfigs) appPosition(i int) configPosition {
+	if i < len(p.appPositions) {
+		return p.appPositions[i]
+	}
+	return configPosition{}
+}
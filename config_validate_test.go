@@ -0,0 +1,93 @@
+package casper
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gogap/errors"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		codes  []uint64
+	}{
+		{"valid", `{
+			"components": [{"name": "v.a", "mq_type": "zmq", "in": "tcp://127.0.0.1:5001", "blob_store": "/tmp/blobs", "blob_threshold": 1024}],
+			"apps": [{"name": "v.app", "mq_type": "zmq", "in": "tcp://127.0.0.1:5002", "blob_store": "/tmp/blobs",
+				"entrance": {"type": "martini"}, "graphs": {"g": ["self", "v.a", "v.app"]}}]}`, nil},
+		{"duplicate name", `{"components": [
+			{"name": "v.a", "mq_type": "zmq", "in": "tcp://127.0.0.1:5001"},
+			{"name": "v.a", "mq_type": "zmq", "in": "tcp://127.0.0.1:5002"}]}`, []uint64{1050}},
+		{"duplicate in", `{"components": [
+			{"name": "v.a", "mq_type": "zmq", "in": "tcp://127.0.0.1:5001"},
+			{"name": "v.b", "mq_type": "zmq", "in": "tcp://127.0.0.1:5001"}]}`, []uint64{1051}},
+		{"empty mq type and in", `{"components": [{"name": "v.a"}]}`, []uint64{1009, 1010}},
+		{"unknown mq type", `{"components": [{"name": "v.a", "mq_type": "v.mq", "in": "v://a"}]}`, []uint64{1054}},
+		{"invalid zmq url", `{"components": [{"name": "v.a", "mq_type": "zmq", "in": "127.0.0.1:5001"}]}`, []uint64{1055}},
+		{"graphs", `{"apps": [{"name": "v.app", "mq_type": "zmq", "in": "tcp://127.0.0.1:5002",
+			"entrance": {"type": "martini"}, "graphs": {"b": [], "a": ["v.missing"], "c": ["v.a", "self"]}}]}`, []uint64{1052, 1053, 1052, 1052}},
+		{"negative blob threshold", `{"components": [{"name": "v.a", "mq_type": "zmq", "in": "tcp://127.0.0.1:5001", "blob_store": "/tmp/blobs", "blob_threshold": -1}]}`, []uint64{1048}},
+		{"blob threshold without store", `{"components": [{"name": "v.a", "mq_type": "zmq", "in": "tcp://127.0.0.1:5001", "blob_threshold": 1024}]}`, []uint64{1048}},
+		{"different blob stores", `{
+			"components": [{"name": "v.a", "mq_type": "zmq", "in": "tcp://127.0.0.1:5001", "blob_store": "/tmp/blobs"}],
+			"apps": [{"name": "v.app", "mq_type": "zmq", "in": "tcp://127.0.0.1:5002", "blob_store": "/tmp/other",
+				"entrance": {"type": "martini"}, "graphs": {"g": ["v.a"]}}]}`, []uint64{1048}},
+		{"all together", `{"components": [
+			{"name": "v.a", "mq_type": "zmq", "in": "tcp://127.0.0.1:5001", "blob_threshold": -1},
+			{"name": "v.a", "mq_type": "zmq", "in": "tcp://127.0.0.1:5001"}]}`, []uint64{1048, 1050, 1051}},
+	}
+
+	for _, test := range tests {
+		_, err := ParseConfig("casper.json", []byte(test.config))
+
+		var codes []uint64
+		if errs, ok := err.(ConfigErrors); ok {
+			for _, e := range errs {
+				if errCode, ok := e.Err.(errors.ErrCode); ok {
+					codes = append(codes, errCode.Code())
+				} else {
+					t.Errorf("%s: %v is not an error code", test.name, e.Err)
+				}
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v is not the config errors", test.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(codes, test.codes) {
+			t.Errorf("%s: expected the errors %v, got %v", test.name, test.codes, err)
+		}
+	}
+}
+
+func TestAllowUnknownTypes(t *testing.T) {
+	config := []byte(`{
+		"components": [{"name": "unknown.a", "mq_type": "custom", "in": "custom://a", "codec": "custom", "tap": "custom"}],
+		"apps": [{"name": "unknown.app", "mq_type": "zmq", "in": "tcp://127.0.0.1:5001",
+			"entrance": {"type": "custom"}, "graphs": {"g": ["unknown.a"]}}]
+	}`)
+
+	if _, err := ParseConfig("casper.json", config); err == nil {
+		t.Fatal("the unknown types are allowed by default")
+	} else if errs, ok := err.(ConfigErrors); !ok || len(errs) != 4 {
+		t.Fatalf("expected the mq type, the codec, the tap and the entrance, got %v", err)
+	}
+
+	AllowUnknownTypes(true)
+	defer AllowUnknownTypes(false)
+
+	conf, err := ParseConfig("casper.json", config)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(conf.Warnings()) != 4 {
+		t.Fatalf("expected 4 warnings, got %v", conf.Warnings())
+	}
+
+	// the other mistakes are still errors
+	if _, err = ParseConfig("casper.json", []byte(`{"apps": [{"name": "unknown.app", "mq_type": "custom", "in": "custom://app",
+		"entrance": {"type": "custom"}, "graphs": {"g": ["unknown.missing"]}}]}`)); err == nil {
+		t.Fatal("the graph of a missing component is allowed")
+	}
+}
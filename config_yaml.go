@@ -0,0 +1,79 @@
+package casper
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/gogap/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+// the line of the yaml errors, they have no column
+var yamlErrorLine = regexp.MustCompile(`line (\d+)`)
+
+func init() {
+	configFormats[".yaml"] = scanYamlSections
+	configFormats[".yml"] = scanYamlSections
+}
+
+func yamlPosition(file string, node *yaml.Node) configPosition {
+	return configPosition{file: file, line: node.Line, column: node.Column}
+}
+
+func yamlError(file string, err error) *ConfigError {
+	configErr := &ConfigError{File: file, Err: errorcode.ERR_CONFIG_INVALID.New(errors.Params{"err": err})}
+	if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+		configErr.Line, _ = strconv.Atoi(m[1])
+	}
+	return configErr
+}
+
+func scanYamlSections(file string, data []byte) (sections configSections, err *ConfigError) {
+	doc := yaml.Node{}
+	if e := yaml.Unmarshal(data, &doc); e != nil {
+		return nil, yamlError(file, e)
+	}
+
+	sections = make(configSections)
+
+	// empty
+	if len(doc.Content) == 0 {
+		return
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, yamlPosition(file, root).errorf(errorcode.ERR_CONFIG_INVALID.New(errors.Params{"err": "config should be a mapping"}))
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		name, value := root.Content[i].Value, root.Content[i+1]
+		if value.Kind == yaml.AliasNode {
+			value = value.Alias
+		}
+
+		if !isConfigSection(name) || value.Tag == "!!null" {
+			continue
+		} else if value.Kind != yaml.SequenceNode {
+			return nil, configSectionError(yamlPosition(file, value), name)
+		}
+
+		for _, item := range value.Content {
+			entry := configEntry{pos: yamlPosition(file, item)}
+
+			var v interface{}
+			if e := item.Decode(&v); e != nil {
+				return nil, entry.pos.errorf(errorcode.ERR_CONFIG_INVALID.New(errors.Params{"err": e}))
+			}
+
+			var e error
+			if entry.data, e = configValueToJson(v); e != nil {
+				return nil, entry.pos.errorf(errorcode.ERR_CONFIG_INVALID.New(errors.Params{"err": e}))
+			}
+			sections[name] = append(sections[name], entry)
+		}
+	}
+	return
+}
@@ -0,0 +1,82 @@
+package casper
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// the same config in all the formats
+const formatTestJsonConfig = `{
+	"components": [{"name": "f.a", "mq_type": "zmq", "in": "tcp://127.0.0.1:5001", "codec": "msgpack", "compress_threshold": 65536}],
+	"apps": [{"name": "f.app", "mq_type": "zmq", "in": "tcp://127.0.0.1:5002",
+		"entrance": {"type": "martini", "options": {"host": "127.0.0.1", "port": 8080, "cors": ["*"]}},
+		"graphs": {"g": ["self", "f.a"]}}]
+}`
+
+// loads the config of the file name, the format is by the extension
+func loadFormatTestConfig(t *testing.T, name, config string) (*CasperConfigs, error) {
+	file := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(file, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return LoadConfig(file)
+}
+
+func TestYamlConfig(t *testing.T) {
+	expected, err := ParseConfig("casper.json", []byte(formatTestJsonConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	yamlConfig := `components:
+  - name: f.a
+    mq_type: zmq
+    in: tcp://127.0.0.1:5001
+    codec: msgpack
+    compress_threshold: 65536
+apps:
+  - name: f.app
+    mq_type: zmq
+    in: tcp://127.0.0.1:5002
+    entrance:
+      type: martini
+      options: {host: 127.0.0.1, port: 8080, cors: ["*"]}
+    graphs:
+      g: [self, f.a]
+handlers: ~
+`
+
+	tests := []struct {
+		file   string
+		config string
+		line   int // of the error, 0 if it is loaded
+	}{
+		{"casper.yaml", yamlConfig, 0},
+		{"casper.yml", yamlConfig, 0},
+		{"casper.YAML", yamlConfig, 0},
+		{"syntax.yaml", "components:\n  - name: f.a\n  - name: f.b\n    in: x: y\n", 4},
+		{"not a mapping.yaml", "- name: f.a\n", 1},
+		{"section.yaml", "components:\n  name: f.a\n", 2},
+		{"type.yaml", "components:\n  - name: f.a\n  - name: [f.b]\n", 3},
+	}
+
+	for _, test := range tests {
+		conf, err := loadFormatTestConfig(t, test.file, test.config)
+		if test.line == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", test.file, err)
+			} else if !reflect.DeepEqual(conf.Components, expected.Components) || !reflect.DeepEqual(conf.Apps, expected.Apps) {
+				t.Errorf("%s: loaded %+v, not %+v", test.file, conf, expected)
+			}
+			continue
+		}
+
+		if errs, ok := err.(ConfigErrors); !ok || len(errs) != 1 {
+			t.Errorf("%s: expected an error, got %v", test.file, err)
+		} else if errs[0].Line != test.line || filepath.Base(errs[0].File) != test.file {
+			t.Errorf("%s: expected the error at line %d, got %v", test.file, test.line, errs[0])
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package casper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// the numbers of the context are kept as json.Number, so an int64 is still
+// an int64 on the next component, not a float64
+func (p *componentContext) UnmarshalJSON(data []byte) (err error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var ctx map[string]interface{}
+	if err = decoder.Decode(&ctx); err != nil {
+		return
+	}
+
+	*p = ctx
+	return
+}
+
+// msgpack has no json.Number, it would be a string on the next component,
+// so the numbers are converted before the codecs other than json encode the
+// context, the nested ones as well
+func (p componentContext) withNativeNumbers() componentContext {
+	if p == nil {
+		return nil
+	}
+
+	ctx := make(componentContext, len(p))
+	for key, value := range p {
+		ctx[key] = nativeNumbers(value)
+	}
+	return ctx
+}
+
+// the values of the commands, and the result, are json.Number after the
+// json codec as well
+func (p componentCommands) withNativeNumbers() componentCommands {
+	if p == nil {
+		return nil
+	}
+
+	commands := make(componentCommands, len(p))
+	for command, values := range p {
+		commands[command] = nativeNumbers(values).([]interface{})
+	}
+	return commands
+}
+
+func nativeNumbers(v interface{}) interface{} {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		} else if u, err := strconv.ParseUint(val.String(), 10, 64); err == nil {
+			return u
+		} else if f, err := val.Float64(); err == nil {
+			return f
+		}
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for key, value := range val {
+			m[key] = nativeNumbers(value)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(val))
+		for i, value := range val {
+			s[i] = nativeNumbers(value)
+		}
+		return s
+	}
+	return v
+}
+
+func contextInt64(v interface{}) (val int64, err error) {
+	if num, ok := v.(json.Number); ok {
+		if val, err = num.Int64(); err == nil {
+			return
+		}
+		var f float64
+		if f, err = num.Float64(); err != nil {
+			return
+		}
+		return floatToInt64(f)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() > math.MaxInt64 {
+			err = fmt.Errorf("value %v overflows int64", v)
+			return
+		}
+		return int64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return floatToInt64(rv.Float())
+	}
+
+	err = fmt.Errorf("value %v of type %T is not a number", v, v)
+	return
+}
+
+func contextUint64(v interface{}) (val uint64, err error) {
+	if num, ok := v.(json.Number); ok {
+		if val, err = strconv.ParseUint(num.String(), 10, 64); err == nil {
+			return
+		}
+		var f float64
+		if f, err = num.Float64(); err != nil {
+			return
+		}
+		return floatToUint64(f)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if rv.Int() < 0 {
+			err = fmt.Errorf("value %v overflows uint64", v)
+			return
+		}
+		return uint64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return floatToUint64(rv.Float())
+	}
+
+	err = fmt.Errorf("value %v of type %T is not a number", v, v)
+	return
+}
+
+func contextFloat64(v interface{}) (val float64, err error) {
+	if num, ok := v.(json.Number); ok {
+		return num.Float64()
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	}
+
+	err = fmt.Errorf("value %v of type %T is not a number", v, v)
+	return
+}
+
+func floatToInt64(f float64) (val int64, err error) {
+	if f != math.Trunc(f) {
+		err = fmt.Errorf("value %v is not an integer", f)
+		return
+	}
+
+	// float64(math.MaxInt64) is 2^63, which overflows
+	if f < math.MinInt64 || f >= math.MaxInt64 {
+		err = fmt.Errorf("value %v overflows int64", f)
+		return
+	}
+	return int64(f), nil
+}
+
+func floatToUint64(f float64) (val uint64, err error) {
+	if f != math.Trunc(f) {
+		err = fmt.Errorf("value %v is not an integer", f)
+		return
+	}
+
+	if f < 0 || f >= math.MaxUint64 {
+		err = fmt.Errorf("value %v overflows uint64", f)
+		return
+	}
+	return uint64(f), nil
+}
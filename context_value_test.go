@@ -0,0 +1,121 @@
+package casper
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// the message is encoded and decoded by the codecs in turn, as it goes
+// through the components of them
+func hopThrough(t *testing.T, comMsg *ComponentMessage, codecNames ...string) *ComponentMessage {
+	for _, codecName := range codecNames {
+		packet, err := EncodePacket(codecName, comMsg)
+		if err != nil {
+			t.Fatalf("encode by %s: %v", codecName, err)
+		}
+
+		comMsg = new(ComponentMessage)
+		if err = DecodePacket(packet, comMsg); err != nil {
+			t.Fatalf("decode by %s: %v", codecName, err)
+		}
+	}
+	return comMsg
+}
+
+func TestContextNumbersAcrossCodecs(t *testing.T) {
+	routes := [][]string{
+		{"json", "msgpack"},
+		{"json", "msgpack", "json"},
+		{"json", "protobuf", "msgpack"},
+		{"msgpack", "json", "msgpack"},
+	}
+
+	for _, route := range routes {
+		t.Run(strings.Join(route, "-"), func(t *testing.T) {
+			comMsg, err := NewComponentMessage(nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			comMsg.Payload.SetContext("int", 7)
+			comMsg.Payload.SetContext("int64", int64(1<<62+1))
+			comMsg.Payload.SetContext("uint64", uint64(math.MaxUint64))
+			comMsg.Payload.SetContext("float", 1.5)
+			comMsg.Payload.SetContext("object", map[string]interface{}{"id": int64(1<<60 + 3), "ids": []interface{}{int64(1<<61 + 5)}})
+
+			payload := hopThrough(t, comMsg, route...).Payload
+
+			if v, err := payload.GetContextInt("int"); err != nil || v != 7 {
+				t.Errorf("int: %v, %v", v, err)
+			}
+			if v, err := payload.GetContextInt64("int64"); err != nil || v != 1<<62+1 {
+				t.Errorf("int64: %v, %v", v, err)
+			}
+			if v, err := payload.GetContextUint64("uint64"); err != nil || v != math.MaxUint64 {
+				t.Errorf("uint64: %v, %v", v, err)
+			}
+			if v, err := payload.GetContextFloat64("float"); err != nil || v != 1.5 {
+				t.Errorf("float: %v, %v", v, err)
+			}
+
+			var object struct {
+				Id  int64   `json:"id"`
+				Ids []int64 `json:"ids"`
+			}
+			if err := payload.GetContextObject("object", &object); err != nil {
+				t.Errorf("object: %v", err)
+			} else if object.Id != 1<<60+3 || len(object.Ids) != 1 || object.Ids[0] != 1<<61+5 {
+				t.Errorf("object: %+v", object)
+			}
+		})
+	}
+}
+
+func TestResultNumbersAcrossCodecs(t *testing.T) {
+	type result struct {
+		Id   int64   `json:"id"`
+		Ids  []int64 `json:"ids"`
+		Max  uint64  `json:"max"`
+		Rate float64 `json:"rate"`
+	}
+
+	routes := [][]string{
+		{"json"},
+		{"msgpack"},
+		{"protobuf"},
+		{"json", "msgpack", "json"},
+		{"json", "protobuf", "msgpack"},
+		{"msgpack", "json", "protobuf", "json"},
+	}
+
+	for _, route := range routes {
+		t.Run(strings.Join(route, "-"), func(t *testing.T) {
+			comMsg, err := NewComponentMessage(nil, map[string]interface{}{
+				"id":   int64(1<<62 + 1),
+				"ids":  []interface{}{int64(1<<53 + 1), int64(-(1<<60 + 3))},
+				"max":  uint64(math.MaxUint64),
+				"rate": 0.25})
+			if err != nil {
+				t.Fatal(err)
+			}
+			comMsg.Payload.AppendCommand("SET_ID", int64(1<<55+7))
+
+			payload := hopThrough(t, comMsg, route...).Payload
+
+			var r result
+			if err = payload.UnmarshalResult(&r); err != nil {
+				t.Fatal(err)
+			}
+			if r.Id != 1<<62+1 || len(r.Ids) != 2 || r.Ids[0] != 1<<53+1 || r.Ids[1] != -(1<<60+3) || r.Max != math.MaxUint64 || r.Rate != 0.25 {
+				t.Errorf("result: %+v", r)
+			}
+
+			ids := make([]interface{}, 1)
+			ids[0] = new(int64)
+			if err = payload.GetCommandObjectArray("SET_ID", ids); err != nil || *ids[0].(*int64) != 1<<55+7 {
+				t.Errorf("command: %v, %v", *ids[0].(*int64), err)
+			}
+		})
+	}
+}
@@ -2,12 +2,20 @@ package casper
 
 import (
 	"encoding/json"
+	"net/http"
 	"time"
+
+	"github.com/gogap/errors"
+
+	"github.com/gogap/casper/errorcode"
 )
 
 const (
 	REQ_TIMEOUT = time.Duration(15) * time.Second
-	REQ_X_API   = "X-API"
+
+	// Deprecated: the api is the Api of the message headers, the entrances
+	// still fill it for now
+	REQ_X_API = "X-API"
 )
 
 type Entrance interface {
@@ -16,6 +24,11 @@ type Entrance interface {
 	Run() error
 }
 
+// the entrances which could be stopped, see App.Stop
+type EntranceStopper interface {
+	Stop() error
+}
+
 type EntranceConfig map[string]interface{}
 
 type EntranceOptions struct {
@@ -32,8 +45,10 @@ func (p EntranceConfig) GetConfigString(sectionName string) (value string, ok bo
 	return
 }
 
+// the config is filled by the json tags of v, whatever the format of the
+// config file is
 func (p EntranceConfig) FillToObject(v interface{}) (err error) {
-	if data, e := json.Marshal(p); e != nil {
+	if data, e := configValueToJson(p); e != nil {
 		err = e
 		return
 	} else {
@@ -41,3 +56,51 @@ func (p EntranceConfig) FillToObject(v interface{}) (err error) {
 	}
 	return
 }
+
+// the headers which the components want to write back by CMD_HTTP_HEADERS_SET
+func GetCommandHeaders(payload *Payload) (headers []*NameValue, err error) {
+	size := payload.GetCommandValueSize(CMD_HTTP_HEADERS_SET)
+	values := make([]interface{}, size)
+	for i := 0; i < size; i++ {
+		values[i] = new(NameValue)
+	}
+
+	if e := payload.GetCommandObjectArray(CMD_HTTP_HEADERS_SET, values); e != nil {
+		err = errorcode.ERR_PARSE_COMMAND_TO_OBJECT_FAILED.New(errors.Params{"cmd": CMD_HTTP_HEADERS_SET, "err": e})
+		return
+	}
+
+	for _, value := range values {
+		if nv, ok := value.(*NameValue); ok {
+			headers = append(headers, nv)
+		} else {
+			err = errorcode.ERR_PARSE_COMMAND_TO_OBJECT_FAILED.New(errors.Params{"cmd": CMD_HTTP_HEADERS_SET, "err": "object could not parser to headers"})
+			return
+		}
+	}
+	return
+}
+
+// the cookies which the components want to write back by CMD_HTTP_COOKIES_SET
+func GetCommandCookies(payload *Payload) (cookies []*http.Cookie, err error) {
+	size := payload.GetCommandValueSize(CMD_HTTP_COOKIES_SET)
+	values := make([]interface{}, size)
+	for i := 0; i < size; i++ {
+		values[i] = new(http.Cookie)
+	}
+
+	if e := payload.GetCommandObjectArray(CMD_HTTP_COOKIES_SET, values); e != nil {
+		err = errorcode.ERR_PARSE_COMMAND_TO_OBJECT_FAILED.New(errors.Params{"cmd": CMD_HTTP_COOKIES_SET, "err": e})
+		return
+	}
+
+	for _, value := range values {
+		if c, ok := value.(*http.Cookie); ok {
+			cookies = append(cookies, c)
+		} else {
+			err = errorcode.ERR_PARSE_COMMAND_TO_OBJECT_FAILED.New(errors.Params{"cmd": CMD_HTTP_COOKIES_SET, "err": "object could not parser to cookies"})
+			return
+		}
+	}
+	return
+}
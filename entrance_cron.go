@@ -0,0 +1,267 @@
+package casper
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gogap/errors"
+	"github.com/gogap/logs"
+	"github.com/robfig/cron/v3"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+const (
+	CTX_CRON_JOB = "CTX_CRON_JOB"
+)
+
+// what to do if the previous run of a job is still running
+const (
+	CRON_OVERLAP_SKIP  = "skip"
+	CRON_OVERLAP_QUEUE = "queue"
+	CRON_OVERLAP_ALLOW = "allow"
+)
+
+var cronParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+type CronJobConf struct {
+	Name     string      `json:"name"`      // default is the graph name
+	Spec     string      `json:"spec"`      // with seconds, e.g. "0 30 2 * * *" or "@every 1m"
+	TimeZone string      `json:"time_zone"` // default is the local time zone
+	Graph    string      `json:"graph"`
+	Body     interface{} `json:"body"`
+	Overlap  string      `json:"overlap"` // skip, queue or allow, default is skip
+}
+
+type EntranceCronConf struct {
+	Jobs    []CronJobConf `json:"jobs"`
+	Timeout int64         `json:"timeout"` // millisecond, default is REQ_TIMEOUT
+
+	timeout time.Duration `json:"-"`
+}
+
+type CronJobStatus struct {
+	Name        string    `json:"name"`
+	Graph       string    `json:"graph"`
+	Spec        string    `json:"spec"`
+	Running     int       `json:"running"`
+	Queued      int       `json:"queued"`
+	Runs        int64     `json:"runs"`
+	Skipped     int64     `json:"skipped"`
+	Next        time.Time `json:"next"`
+	LastId      string    `json:"last_id"`
+	LastStart   time.Time `json:"last_start"`
+	LastEnd     time.Time `json:"last_end"`
+	LastCode    uint64    `json:"last_code"`
+	LastMessage string    `json:"last_message"`
+}
+
+type cronJob struct {
+	conf     CronJobConf
+	entrance *EntranceCron
+	entryId  cron.EntryID
+
+	queue  sync.Mutex
+	locker sync.Mutex
+	status CronJobStatus
+}
+
+type EntranceCron struct {
+	config    EntranceCronConf
+	cron      *cron.Cron
+	jobs      []*cronJob
+	messenger Messenger
+}
+
+func init() {
+	entrancefactory.RegisterEntrance(new(EntranceCron))
+}
+
+func (p *EntranceCron) Type() string {
+	return "cron"
+}
+
+func (p *EntranceCron) Init(messenger Messenger, configs EntranceConfig) (err error) {
+	if e := configs.FillToObject(&p.config); e != nil {
+		err = errorcode.ERR_CONFIG_TO_OBJECT_FAILED.New(errors.Params{"err": e})
+		return
+	}
+
+	if p.config.Timeout > 0 {
+		p.config.timeout = time.Duration(p.config.Timeout) * time.Millisecond
+	} else {
+		p.config.timeout = REQ_TIMEOUT
+	}
+
+	p.cron = cron.New(cron.WithParser(cronParser))
+	p.jobs = nil
+
+	for _, jobConf := range p.config.Jobs {
+		if jobConf.Name == "" {
+			jobConf.Name = jobConf.Graph
+		}
+
+		switch jobConf.Overlap {
+		case "":
+			jobConf.Overlap = CRON_OVERLAP_SKIP
+		case CRON_OVERLAP_SKIP, CRON_OVERLAP_QUEUE, CRON_OVERLAP_ALLOW:
+		default:
+			err = errorcode.ERR_CRON_OVERLAP_INVALID.New(errors.Params{"name": jobConf.Name, "overlap": jobConf.Overlap})
+			return
+		}
+
+		spec := jobConf.Spec
+		if jobConf.TimeZone != "" {
+			if _, e := time.LoadLocation(jobConf.TimeZone); e != nil {
+				err = errorcode.ERR_CRON_SPEC_INVALID.New(errors.Params{"name": jobConf.Name, "spec": jobConf.TimeZone, "err": e})
+				return
+			}
+			spec = "CRON_TZ=" + jobConf.TimeZone + " " + spec
+		}
+
+		job := &cronJob{conf: jobConf, entrance: p}
+		job.status.Name = jobConf.Name
+		job.status.Graph = jobConf.Graph
+		job.status.Spec = spec
+
+		if job.entryId, err = p.cron.AddJob(spec, job); err != nil {
+			err = errorcode.ERR_CRON_SPEC_INVALID.New(errors.Params{"name": jobConf.Name, "spec": spec, "err": err})
+			return
+		}
+
+		p.jobs = append(p.jobs, job)
+	}
+
+	if messenger == nil {
+		err = errorcode.ERR_MESSENGER_IS_NIL.New(errors.Params{"type": p.Type()})
+		return
+	} else {
+		p.messenger = messenger
+	}
+	return
+}
+
+func (p *EntranceCron) Run() error {
+	logs.Info("entrance", p.Type(), "start, jobs:", len(p.jobs))
+
+	p.cron.Run()
+
+	return nil
+}
+
+// Stop stops scheduling the jobs, and waits for the runs already started
+func (p *EntranceCron) Stop() error {
+	<-p.cron.Stop().Done()
+
+	logs.Info("entrance", p.Type(), "stopped")
+	return nil
+}
+
+// the status and the outcome of the last run of every job
+func (p *EntranceCron) JobsStatus() (status []CronJobStatus) {
+	for _, job := range p.jobs {
+		status = append(status, job.Status())
+	}
+	return
+}
+
+func (p *EntranceCron) JobStatus(name string) (status CronJobStatus, exist bool) {
+	for _, job := range p.jobs {
+		if job.conf.Name == name {
+			return job.Status(), true
+		}
+	}
+	return
+}
+
+func (p *cronJob) Status() (status CronJobStatus) {
+	p.locker.Lock()
+	status = p.status
+	p.locker.Unlock()
+
+	status.Next = p.entrance.cron.Entry(p.entryId).Next
+	return
+}
+
+func (p *cronJob) Run() {
+	p.locker.Lock()
+	if p.conf.Overlap == CRON_OVERLAP_SKIP && p.status.Running > 0 {
+		p.status.Skipped++
+		p.locker.Unlock()
+		logs.Warn("cron job", p.conf.Name, "skipped, the previous run is still running")
+		return
+	}
+
+	if p.conf.Overlap == CRON_OVERLAP_QUEUE {
+		p.status.Queued++
+		p.locker.Unlock()
+
+		p.queue.Lock()
+		defer p.queue.Unlock()
+
+		p.locker.Lock()
+		p.status.Queued--
+	}
+
+	p.status.Running++
+	p.status.Runs++
+	p.status.LastStart = time.Now()
+	p.locker.Unlock()
+
+	msgId, payload, err := p.entrance.call(p.conf)
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.status.Running--
+	p.status.LastEnd = time.Now()
+	p.status.LastId = msgId
+
+	if err != nil {
+		p.status.LastCode = 500
+		p.status.LastMessage = err.Error()
+		if errors.IsErrCode(err) {
+			p.status.LastCode = err.(errors.ErrCode).Code()
+		}
+	} else {
+		p.status.LastCode = payload.Code
+		p.status.LastMessage = payload.Message
+	}
+
+	if p.status.LastCode != 0 {
+		logs.Error("cron job", p.conf.Name, "failed:", msgId, p.status.LastCode, p.status.LastMessage)
+	} else {
+		logs.Info("cron job", p.conf.Name, "finished:", msgId, p.status.LastEnd.Sub(p.status.LastStart))
+	}
+}
+
+func (p *EntranceCron) call(jobConf CronJobConf) (msgId string, payload *Payload, err error) {
+	body := jobConf.Body
+	if body == nil {
+		body = map[string]interface{}{}
+	}
+
+	var comMsg *ComponentMessage
+	if comMsg, err = p.messenger.NewMessage(body); err != nil {
+		err = errorcode.ERR_COULD_NOT_NEW_COMPONENT_MSG.New(errors.Params{"err": err})
+		return
+	}
+
+	comMsg.Headers().fillRequest(comMsg.Id, p.Type(), jobConf.Graph, p.config.timeout)
+	comMsg.Payload.fillDeprecatedContext(REQ_X_API)
+	comMsg.Payload.SetContext(CTX_CRON_JOB, jobConf.Name)
+
+	var ch chan *Payload
+	if msgId, ch, err = p.messenger.SendMessage(jobConf.Graph, comMsg); err != nil {
+		err = errorcode.ERR_SEND_COMPONENT_MSG_ERROR.New(errors.Params{"id": comMsg.Id, "err": err})
+		return
+	}
+	defer p.messenger.OnMessageEvent(msgId, MSG_EVENT_PROCESSED)
+
+	select {
+	case payload = <-ch:
+	case <-time.After(p.config.timeout):
+		err = errorcode.ERR_REQUEST_TIMEOUT.New(errors.Params{"id": msgId})
+	}
+	return
+}
@@ -0,0 +1,129 @@
+package casper
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// waits for the status of the job, it fails after a second
+func waitCronJobStatus(t *testing.T, job *cronJob, check func(CronJobStatus) bool) CronJobStatus {
+	deadline := time.Now().Add(time.Second)
+	for {
+		status := job.Status()
+		if check(status) {
+			return status
+		} else if time.Now().After(deadline) {
+			t.Fatalf("%s: unexpected status %+v", job.conf.Overlap, status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCronJobOverlap(t *testing.T) {
+	tests := []struct {
+		overlap string
+		// while the first run is still running
+		running, queued int
+		skipped         int64
+		// after all of the runs finished
+		runs int64
+	}{
+		{CRON_OVERLAP_SKIP, 1, 0, 2, 1},
+		{CRON_OVERLAP_QUEUE, 1, 2, 0, 3},
+		{CRON_OVERLAP_ALLOW, 3, 0, 0, 3},
+	}
+
+	for _, test := range tests {
+		release := make(chan bool)
+		messenger := newTestMessenger(func(graphName string, comMsg *ComponentMessage) *Payload {
+			<-release
+			return echoReply(graphName, comMsg)
+		})
+
+		entrance := new(EntranceCron)
+		if err := entrance.Init(messenger, EntranceConfig{"jobs": []interface{}{
+			map[string]interface{}{"spec": "@every 1h", "graph": "g", "overlap": test.overlap},
+		}}); err != nil {
+			t.Fatal(err)
+		}
+		job := entrance.jobs[0]
+
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				job.Run()
+			}()
+		}
+
+		waitCronJobStatus(t, job, func(status CronJobStatus) bool {
+			return status.Running == test.running && status.Queued == test.queued && status.Skipped == test.skipped
+		})
+
+		close(release)
+		wg.Wait()
+
+		status := job.Status()
+		if status.Runs != test.runs || status.Running != 0 || status.Queued != 0 {
+			t.Errorf("%s: unexpected status after the runs %+v", test.overlap, status)
+		}
+		if status.LastCode != 0 || status.LastId == "" {
+			t.Errorf("%s: the last run failed %+v", test.overlap, status)
+		}
+	}
+}
+
+func TestCronEntranceStop(t *testing.T) {
+	release := make(chan bool)
+	messenger := newTestMessenger(func(graphName string, comMsg *ComponentMessage) *Payload {
+		<-release
+		return echoReply(graphName, comMsg)
+	})
+
+	entrance := new(EntranceCron)
+	if err := entrance.Init(messenger, EntranceConfig{"jobs": []interface{}{
+		map[string]interface{}{"name": "every", "spec": "@every 1s", "graph": "g"},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	ran := make(chan bool)
+	go func() {
+		entrance.Run()
+		close(ran)
+	}()
+
+	job := entrance.jobs[0]
+	waitCronJobStatus(t, job, func(status CronJobStatus) bool { return status.Running == 1 })
+
+	// the app stops its entrance
+	app := &App{Entrance: entrance}
+
+	stopped := make(chan bool)
+	go func() {
+		app.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("stopped before the running job finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	for _, ch := range []chan bool{stopped, ran} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatal("the entrance is not stopped")
+		}
+	}
+
+	if status, ok := app.JobsStatus(); !ok || len(status) != 1 || status[0].Runs != 1 || status[0].Running != 0 {
+		t.Errorf("unexpected status after stopped %+v", status)
+	}
+}
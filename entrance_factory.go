@@ -3,6 +3,10 @@ package casper
 import (
 	"fmt"
 	"reflect"
+
+	"github.com/gogap/errors"
+
+	"github.com/gogap/casper/errorcode"
 )
 
 type EntranceFactory interface {
@@ -10,6 +14,12 @@ type EntranceFactory interface {
 	NewEntrance(messengerr Messenger, typ string, configs EntranceConfig) Entrance
 }
 
+// the factories which return the errors instead of panics, they are used by
+// NewApp if the factory implements it
+type EntranceFactoryE interface {
+	NewEntranceE(messengerr Messenger, typ string, configs EntranceConfig) (Entrance, error)
+}
+
 type DefaultEntranceFactory struct {
 	entrances map[string]reflect.Type
 }
@@ -38,19 +48,39 @@ func (p *DefaultEntranceFactory) RegisterEntrance(entrance Entrance) {
 	return
 }
 
+// EntranceExist is true if the entrance of typ is registered, the factories
+// implementing it have the entrance types checked by CasperConfigs.Validate
+func (p *DefaultEntranceFactory) EntranceExist(typ string) bool {
+	_, exist := p.entrances[typ]
+	return exist
+}
+
+// NewEntrance is NewEntranceE, but panics on the errors
 func (p *DefaultEntranceFactory) NewEntrance(messengerr Messenger, typ string, configs EntranceConfig) Entrance {
-	if entranceType, exist := p.entrances[typ]; !exist {
-		panic(fmt.Errorf("entrance of [%s] not exist", typ))
-	} else {
-		if vOfEntrance := reflect.New(entranceType); vOfEntrance.CanInterface() {
-			iEntrance := vOfEntrance.Interface()
-			if entrance, ok := iEntrance.(Entrance); ok {
-				entrance.Init(messengerr, configs)
-				return entrance
-			} else {
-				panic(fmt.Errorf("convert value to interface{} of Entrance failed, entrance type is: %s", typ))
-			}
-		}
-		panic(fmt.Errorf("create entrance of %s failed", typ))
+	entrance, err := p.NewEntranceE(messengerr, typ, configs)
+	if err != nil {
+		panic(err)
+	}
+	return entrance
+}
+
+// the error of Init is returned as well
+func (p *DefaultEntranceFactory) NewEntranceE(messengerr Messenger, typ string, configs EntranceConfig) (entrance Entrance, err error) {
+	entranceType, exist := p.entrances[typ]
+	if !exist {
+		err = errorcode.ERR_ENTRANCE_NOT_EXIST.New(errors.Params{"type": typ})
+		return
+	}
+
+	ok := false
+	if entrance, ok = reflect.New(entranceType).Interface().(Entrance); !ok {
+		err = errorcode.ERR_NEW_ENTRANCE_FAILED.New(errors.Params{"type": typ, "err": "it is not an Entrance"})
+		return
 	}
+
+	if err = entrance.Init(messengerr, configs); err != nil {
+		err = errorcode.ERR_NEW_ENTRANCE_FAILED.New(errors.Params{"type": typ, "err": err})
+		return nil, err
+	}
+	return
 }
@@ -0,0 +1,346 @@
+package casper
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogap/errors"
+	"github.com/gogap/logs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+type EntranceGRPCConf struct {
+	Address     string                `json:"address"`
+	CertFile    string                `json:"cert_file"`
+	KeyFile     string                `json:"key_file"`
+	Timeout     int64                 `json:"timeout"`       // millisecond, default is REQ_TIMEOUT
+	MaxBodySize int64                 `json:"max_body_size"` // bytes of a request, default is DefaultMaxBodySize
+	ToContext   EntranceToContextConf `json:"to_context"`
+
+	timeout time.Duration `json:"-"`
+}
+
+type EntranceGRPC struct {
+	config    EntranceGRPCConf
+	server    *grpc.Server
+	messenger Messenger
+}
+
+// the handler type must be an interface, the server checks the entrance
+// implements it while registering
+type grpcCasperServer interface {
+	Invoke(ctx context.Context, req *GRPCInvokeRequest) (*GRPCInvokeReply, error)
+	InvokeStream(req *GRPCInvokeRequest, stream grpc.ServerStream) error
+}
+
+var grpcCasperServiceDesc = grpc.ServiceDesc{
+	ServiceName: "casper.Casper",
+	HandlerType: (*grpcCasperServer)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Invoke",
+		Handler:    grpcInvokeHandler,
+	}},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "InvokeStream",
+		Handler:       grpcInvokeStreamHandler,
+		ServerStreams: true,
+	}},
+	Metadata: "proto/casper.proto",
+}
+
+func init() {
+	entrancefactory.RegisterEntrance(new(EntranceGRPC))
+}
+
+func (p *EntranceGRPC) Type() string {
+	return "grpc"
+}
+
+func (p *EntranceGRPC) Init(messenger Messenger, configs EntranceConfig) (err error) {
+	if e := configs.FillToObject(&p.config); e != nil {
+		err = errorcode.ERR_CONFIG_TO_OBJECT_FAILED.New(errors.Params{"err": e})
+		return
+	}
+
+	if p.config.Timeout > 0 {
+		p.config.timeout = time.Duration(p.config.Timeout) * time.Millisecond
+	} else {
+		p.config.timeout = REQ_TIMEOUT
+	}
+
+	if messenger == nil {
+		err = errorcode.ERR_MESSENGER_IS_NIL.New(errors.Params{"type": p.Type()})
+		return
+	} else {
+		p.messenger = messenger
+	}
+	return
+}
+
+func (p *EntranceGRPC) Run() (err error) {
+	if p.config.MaxBodySize <= 0 {
+		p.config.MaxBodySize = DefaultMaxBodySize
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.ForceServerCodec(grpcCodec{}),
+		grpc.MaxRecvMsgSize(int(p.config.MaxBodySize))}
+
+	if p.config.CertFile != "" || p.config.KeyFile != "" {
+		var creds credentials.TransportCredentials
+		if creds, err = credentials.NewServerTLSFromFile(p.config.CertFile, p.config.KeyFile); err != nil {
+			err = errorcode.ERR_GRPC_LOAD_TLS_FAILED.New(errors.Params{"certFile": p.config.CertFile, "keyFile": p.config.KeyFile, "err": err})
+			return
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+
+	var listener net.Listener
+	if listener, err = net.Listen("tcp", p.config.Address); err != nil {
+		return
+	}
+
+	p.server = grpc.NewServer(opts...)
+	p.server.RegisterService(&grpcCasperServiceDesc, p)
+
+	logs.Info("entrance", p.Type(), "start:", p.config.Address)
+
+	return p.server.Serve(listener)
+}
+
+func (p *EntranceGRPC) Invoke(ctx context.Context, req *GRPCInvokeRequest) (reply *GRPCInvokeReply, err error) {
+	var body map[string]interface{}
+	if body, err = p.parseBody(req.JsonBody); err != nil {
+		return
+	}
+
+	return p.invoke(ctx, req.Api, body, p.requestHeaders(ctx, req))
+}
+
+func (p *EntranceGRPC) InvokeStream(req *GRPCInvokeRequest, stream grpc.ServerStream) (err error) {
+	bodies := []json.RawMessage{}
+	if e := json.Unmarshal([]byte(req.JsonBody), &bodies); e != nil {
+		bodies = []json.RawMessage{json.RawMessage(req.JsonBody)}
+	}
+
+	ctx := stream.Context()
+	reqHeaders := p.requestHeaders(ctx, req)
+
+	var locker sync.Mutex
+	var wg sync.WaitGroup
+	var sendErr error
+
+	for i, rawBody := range bodies {
+		wg.Add(1)
+		go func(index int, rawBody string) {
+			defer wg.Done()
+
+			var reply *GRPCInvokeReply
+			body, e := p.parseBody(rawBody)
+			if e == nil {
+				reply, e = p.invoke(ctx, req.Api, body, reqHeaders)
+			}
+
+			if e != nil {
+				reply = grpcErrorReply(e)
+			}
+			reply.Index = int32(index)
+
+			locker.Lock()
+			defer locker.Unlock()
+			if sendErr == nil {
+				sendErr = stream.SendMsg(reply)
+			}
+		}(i, string(rawBody))
+	}
+
+	wg.Wait()
+
+	return sendErr
+}
+
+// the grpc status codes of the errors of invoke, they are not casper codes,
+// so they are mapped, the others are ERR_GRPC_INVOKE_FAILED
+var grpcErrorCodes = map[codes.Code]uint64{
+	codes.InvalidArgument:  errorcode.ERR_REQUEST_SHOULD_BE_JSON.New().Code(),
+	codes.NotFound:         errorcode.ERR_API_NOT_FOUND.New().Code(),
+	codes.DeadlineExceeded: errorcode.ERR_REQUEST_TIMEOUT.New().Code(),
+	codes.Canceled:         errorcode.ERR_REQUEST_TIMEOUT.New().Code(),
+}
+
+// the reply of a failed body of the stream, the grpc status is kept in the
+// message
+func grpcErrorReply(err error) *GRPCInvokeReply {
+	st := status.Convert(err)
+
+	code, exist := grpcErrorCodes[st.Code()]
+	if !exist {
+		code = errorcode.ERR_GRPC_INVOKE_FAILED.New().Code()
+	}
+	return &GRPCInvokeReply{Code: code, Message: st.Code().String() + ": " + st.Message()}
+}
+
+func (p *EntranceGRPC) parseBody(jsonBody string) (body map[string]interface{}, err error) {
+	if strings.TrimSpace(jsonBody) == "" {
+		jsonBody = "{}"
+	}
+
+	if e := json.Unmarshal([]byte(jsonBody), &body); e != nil {
+		logs.Error(errorcode.ERR_REQUEST_SHOULD_BE_JSON.New())
+		err = status.Error(codes.InvalidArgument, respNotAJson.Message)
+		return
+	}
+	return
+}
+
+// grpc metadata and the metadata field of the request are mapped to the
+// HTTPHeaders of the message headers by to_context.headers, the same as the
+// http headers of the martini entrance, the metadata field wins
+func (p *EntranceGRPC) requestHeaders(ctx context.Context, req *GRPCInvokeRequest) (reqHeaders Headers) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(name string) (value string) {
+		if values := md.Get(name); len(values) > 0 {
+			value = values[0]
+		}
+
+		for key, v := range req.Metadata {
+			if strings.EqualFold(key, name) {
+				value = v
+			}
+		}
+		return
+	}
+
+	reqHeaders.HTTPHeaders = map[string]string{}
+	for _, headerName := range p.config.ToContext.Headers {
+		reqHeaders.HTTPHeaders[headerName] = get(headerName)
+	}
+
+	reqHeaders.fillTrace(get)
+	return
+}
+
+func (p *EntranceGRPC) invoke(ctx context.Context, apiName string, body map[string]interface{}, reqHeaders Headers) (reply *GRPCInvokeReply, err error) {
+	if apiName == "" {
+		logs.Error(errorcode.ERR_API_NOT_FOUND.New(errors.Params{"apiName": apiName}))
+		err = status.Error(codes.NotFound, respNotFound.Message)
+		return
+	}
+
+	logs.Info("handle", apiName)
+
+	var comMsg *ComponentMessage
+	if comMsg, err = p.messenger.NewMessage(body); err != nil {
+		logs.Error(errorcode.ERR_COULD_NOT_NEW_COMPONENT_MSG.New(errors.Params{"err": err}))
+		err = status.Error(codes.Internal, respInternalError.Message)
+		return
+	}
+
+	// the deadline of the caller wins if it is earlier than the timeout
+	timeout := p.config.timeout
+	if deadline, ok := ctx.Deadline(); ok && deadline.Sub(time.Now()) < timeout {
+		timeout = deadline.Sub(time.Now())
+	}
+
+	*comMsg.Headers() = reqHeaders
+	comMsg.Headers().fillRequest(comMsg.Id, p.Type(), apiName, timeout)
+	comMsg.Payload.fillDeprecatedContext(REQ_X_API)
+
+	msgId := ""
+	var ch chan *Payload
+	if msgId, ch, err = p.messenger.SendMessage(apiName, comMsg); err != nil {
+		logs.Error(errorcode.ERR_SEND_COMPONENT_MSG_ERROR.New(errors.Params{"id": comMsg.Id, "err": err}))
+		err = status.Error(codes.Internal, respInternalError.Message)
+		return
+	}
+
+	defer close(ch)
+	defer p.messenger.OnMessageEvent(msgId, MSG_EVENT_PROCESSED)
+
+	var payload *Payload
+	select {
+	case payload = <-ch:
+		break
+	case <-ctx.Done():
+		err = status.FromContextError(ctx.Err()).Err()
+		return
+	case <-time.After(timeout):
+		err = status.Error(codes.DeadlineExceeded, respRequestTimeout.Message)
+		return
+	}
+
+	reply = &GRPCInvokeReply{
+		Code:    payload.Code,
+		Message: payload.Message,
+		Id:      msgId,
+		Headers: map[string]string{}}
+
+	if err = payload.resolveResult(); err != nil {
+		logs.Error(err)
+		err = status.Error(codes.Internal, respInternalError.Message)
+		return
+	}
+
+	if payload.result != nil {
+		if bResult, e := json.Marshal(payload.result); e != nil {
+			logs.Error(errorcode.ERR_JSON_MARSHAL_ERROR.New(errors.Params{"err": e}))
+			err = status.Error(codes.Internal, respInternalError.Message)
+			return
+		} else {
+			reply.Result = string(bResult)
+		}
+	}
+
+	var cmdHeaders []*NameValue
+	if cmdHeaders, err = GetCommandHeaders(payload); err != nil {
+		logs.Error(err)
+		err = status.Error(codes.Internal, respInternalError.Message)
+		return
+	}
+
+	for _, nv := range cmdHeaders {
+		reply.Headers[nv.Name] = nv.Value
+	}
+
+	return
+}
+
+func grpcInvokeHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := new(GRPCInvokeRequest)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+
+	if interceptor == nil {
+		return srv.(grpcCasperServer).Invoke(ctx, req)
+	}
+
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/casper.Casper/Invoke",
+	}
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(grpcCasperServer).Invoke(ctx, req.(*GRPCInvokeRequest))
+	}
+
+	return interceptor(ctx, req, info, handler)
+}
+
+func grpcInvokeStreamHandler(srv interface{}, stream grpc.ServerStream) error {
+	req := new(GRPCInvokeRequest)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	return srv.(grpcCasperServer).InvokeStream(req, stream)
+}
@@ -0,0 +1,202 @@
+package casper
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// the wire format of proto/casper.proto, it was written by hand so that
+// the entrance does not depend on generated code, any client generated
+// from proto/casper.proto could talk to it.
+
+type GRPCInvokeRequest struct {
+	Api      string
+	JsonBody string
+	Metadata map[string]string
+}
+
+type GRPCInvokeReply struct {
+	Code    uint64
+	Message string
+	Result  string
+	Headers map[string]string
+	Id      string
+	Index   int32
+}
+
+type grpcWireMessage interface {
+	marshal() []byte
+	unmarshal(data []byte) error
+}
+
+// grpcCodec works on the hand written messages above, the name is "proto"
+// so the content type is the same as the one of the generated clients
+type grpcCodec struct{}
+
+func (grpcCodec) Marshal(v interface{}) ([]byte, error) {
+	if msg, ok := v.(grpcWireMessage); ok {
+		return msg.marshal(), nil
+	}
+	return nil, fmt.Errorf("grpc codec could not marshal type of %T", v)
+}
+
+func (grpcCodec) Unmarshal(data []byte, v interface{}) error {
+	if msg, ok := v.(grpcWireMessage); ok {
+		return msg.unmarshal(data)
+	}
+	return fmt.Errorf("grpc codec could not unmarshal type of %T", v)
+}
+
+func (grpcCodec) Name() string {
+	return "proto"
+}
+
+func (p *GRPCInvokeRequest) marshal() (data []byte) {
+	data = appendWireString(data, 1, p.Api)
+	data = appendWireString(data, 2, p.JsonBody)
+	data = appendWireMap(data, 3, p.Metadata)
+	return
+}
+
+func (p *GRPCInvokeRequest) unmarshal(data []byte) error {
+	return consumeWireFields(data, func(num protowire.Number, typ protowire.Type, data []byte) (n int, err error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return consumeWireString(data, &p.Api)
+		case num == 2 && typ == protowire.BytesType:
+			return consumeWireString(data, &p.JsonBody)
+		case num == 3 && typ == protowire.BytesType:
+			if p.Metadata == nil {
+				p.Metadata = make(map[string]string)
+			}
+			return consumeWireMapEntry(data, p.Metadata)
+		}
+		return protowire.ConsumeFieldValue(num, typ, data), nil
+	})
+}
+
+func (p *GRPCInvokeReply) marshal() (data []byte) {
+	if p.Code != 0 {
+		data = protowire.AppendTag(data, 1, protowire.VarintType)
+		data = protowire.AppendVarint(data, p.Code)
+	}
+	data = appendWireString(data, 2, p.Message)
+	data = appendWireString(data, 3, p.Result)
+	data = appendWireMap(data, 4, p.Headers)
+	data = appendWireString(data, 5, p.Id)
+	if p.Index != 0 {
+		data = protowire.AppendTag(data, 6, protowire.VarintType)
+		data = protowire.AppendVarint(data, uint64(int64(p.Index)))
+	}
+	return
+}
+
+func (p *GRPCInvokeReply) unmarshal(data []byte) error {
+	return consumeWireFields(data, func(num protowire.Number, typ protowire.Type, data []byte) (n int, err error) {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			var v uint64
+			if v, n = protowire.ConsumeVarint(data); n >= 0 {
+				p.Code = v
+			}
+			return
+		case num == 2 && typ == protowire.BytesType:
+			return consumeWireString(data, &p.Message)
+		case num == 3 && typ == protowire.BytesType:
+			return consumeWireString(data, &p.Result)
+		case num == 4 && typ == protowire.BytesType:
+			if p.Headers == nil {
+				p.Headers = make(map[string]string)
+			}
+			return consumeWireMapEntry(data, p.Headers)
+		case num == 5 && typ == protowire.BytesType:
+			return consumeWireString(data, &p.Id)
+		case num == 6 && typ == protowire.VarintType:
+			var v uint64
+			if v, n = protowire.ConsumeVarint(data); n >= 0 {
+				p.Index = int32(v)
+			}
+			return
+		}
+		return protowire.ConsumeFieldValue(num, typ, data), nil
+	})
+}
+
+func appendWireString(data []byte, num protowire.Number, value string) []byte {
+	if value == "" {
+		return data
+	}
+	data = protowire.AppendTag(data, num, protowire.BytesType)
+	return protowire.AppendString(data, value)
+}
+
+// the keys are sorted, so the output is stable
+func appendWireMap(data []byte, num protowire.Number, values map[string]string) []byte {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := values[key]
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, key)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendString(entry, value)
+
+		data = protowire.AppendTag(data, num, protowire.BytesType)
+		data = protowire.AppendBytes(data, entry)
+	}
+	return data
+}
+
+func consumeWireFields(data []byte, field func(protowire.Number, protowire.Type, []byte) (int, error)) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if n, err := field(num, typ, data); err != nil {
+			return err
+		} else if n < 0 {
+			return protowire.ParseError(n)
+		} else {
+			data = data[n:]
+		}
+	}
+	return nil
+}
+
+func consumeWireString(data []byte, value *string) (n int, err error) {
+	var v string
+	if v, n = protowire.ConsumeString(data); n >= 0 {
+		*value = v
+	}
+	return
+}
+
+func consumeWireMapEntry(data []byte, values map[string]string) (n int, err error) {
+	var entry []byte
+	if entry, n = protowire.ConsumeBytes(data); n < 0 {
+		return
+	}
+
+	key, value := "", ""
+	err = consumeWireFields(entry, func(num protowire.Number, typ protowire.Type, data []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return consumeWireString(data, &key)
+		case num == 2 && typ == protowire.BytesType:
+			return consumeWireString(data, &value)
+		}
+		return protowire.ConsumeFieldValue(num, typ, data), nil
+	})
+	values[key] = value
+	return
+}
@@ -0,0 +1,104 @@
+package casper
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestGRPCCodecRoundTrip(t *testing.T) {
+	messages := []struct {
+		name string
+		msg  grpcWireMessage
+		new  func() grpcWireMessage
+	}{
+		{"empty request", &GRPCInvokeRequest{}, func() grpcWireMessage { return new(GRPCInvokeRequest) }},
+		{"request", &GRPCInvokeRequest{
+			Api:      "example.hello",
+			JsonBody: `{"hello": "世界"}`,
+			Metadata: map[string]string{"b": "2", "a": "1", "empty": ""}},
+			func() grpcWireMessage { return new(GRPCInvokeRequest) }},
+		{"empty reply", &GRPCInvokeReply{}, func() grpcWireMessage { return new(GRPCInvokeReply) }},
+		{"reply", &GRPCInvokeReply{
+			Code:    1 << 40,
+			Message: "failed",
+			Result:  `{"n": 1}`,
+			Headers: map[string]string{"X-A": "a"},
+			Id:      "7f1f4f6e",
+			Index:   7},
+			func() grpcWireMessage { return new(GRPCInvokeReply) }},
+		{"negative index", &GRPCInvokeReply{Index: -1}, func() grpcWireMessage { return new(GRPCInvokeReply) }},
+	}
+
+	codec := grpcCodec{}
+	for _, m := range messages {
+		data, err := codec.Marshal(m.msg)
+		if err != nil {
+			t.Fatalf("%s: %v", m.name, err)
+		}
+
+		decoded := m.new()
+		if err = codec.Unmarshal(data, decoded); err != nil {
+			t.Fatalf("%s: %v", m.name, err)
+		}
+		if !reflect.DeepEqual(decoded, m.msg) {
+			t.Errorf("%s: decoded %+v, not %+v", m.name, decoded, m.msg)
+		}
+
+		// the maps are sorted, so the output is stable
+		if again, _ := codec.Marshal(decoded); string(again) != string(data) {
+			t.Errorf("%s: the output is not stable", m.name)
+		}
+	}
+}
+
+func TestGRPCCodecUnmarshal(t *testing.T) {
+	// the fields written by another client, with the fields unknown to
+	// the entrance, e.g. of a newer proto
+	var data []byte
+	data = protowire.AppendTag(data, 9, protowire.VarintType)
+	data = protowire.AppendVarint(data, 1)
+	data = protowire.AppendTag(data, 1, protowire.BytesType)
+	data = protowire.AppendString(data, "example.hello")
+	data = protowire.AppendTag(data, 10, protowire.BytesType)
+	data = protowire.AppendString(data, "unknown")
+	data = protowire.AppendTag(data, 3, protowire.BytesType)
+	data = protowire.AppendBytes(data, protowire.AppendString(protowire.AppendTag(nil, 1, protowire.BytesType), "key"))
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected *GRPCInvokeRequest
+		fail     bool
+	}{
+		{"unknown fields", data, &GRPCInvokeRequest{Api: "example.hello", Metadata: map[string]string{"key": ""}}, false},
+		{"truncated", data[:len(data)-2], nil, true},
+		{"bad tag", []byte{0xff}, nil, true},
+		{"wrong type", protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 1), &GRPCInvokeRequest{}, false},
+	}
+
+	for _, test := range tests {
+		req := new(GRPCInvokeRequest)
+		err := grpcCodec{}.Unmarshal(test.data, req)
+		if test.fail {
+			if err == nil {
+				t.Errorf("%s: no error", test.name)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if !reflect.DeepEqual(req, test.expected) {
+			t.Errorf("%s: decoded %+v, not %+v", test.name, req, test.expected)
+		}
+	}
+
+	if _, err := (grpcCodec{}).Marshal("not a message"); err == nil {
+		t.Error("marshaled a string")
+	}
+	if err := (grpcCodec{}).Unmarshal(nil, new(string)); err == nil {
+		t.Error("unmarshaled to a string")
+	}
+}
@@ -0,0 +1,370 @@
+package casper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-martini/martini"
+	"github.com/gogap/errors"
+	"github.com/gogap/logs"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+const (
+	JSONRPC_VERSION = "2.0"
+
+	JSONRPC_PARSE_ERROR      = -32700
+	JSONRPC_INVALID_REQUEST  = -32600
+	JSONRPC_METHOD_NOT_FOUND = -32601
+	JSONRPC_INVALID_PARAMS   = -32602
+	JSONRPC_INTERNAL_ERROR   = -32603
+	JSONRPC_REQUEST_TIMEOUT  = -32000
+)
+
+// casper error codes which have a json-rpc meaning, the others are
+// reported as JSONRPC_INTERNAL_ERROR with the casper code in data
+var jsonrpcErrorCodes = map[uint64]int{
+	errorcode.ERR_REQUEST_SHOULD_BE_JSON.New().Code():   JSONRPC_PARSE_ERROR,
+	errorcode.ERR_BAD_REQUEST.New().Code():              JSONRPC_INVALID_REQUEST,
+	errorcode.ERR_JSONRPC_INVALID_REQUEST.New().Code():  JSONRPC_INVALID_REQUEST,
+	errorcode.ERR_REQUEST_BODY_TOO_LARGE.New().Code():   JSONRPC_INVALID_REQUEST,
+	errorcode.ERR_MESSAGE_TOO_LARGE.New().Code():        JSONRPC_INVALID_REQUEST,
+	errorcode.ERR_TOO_MANY_CONTEXT_ENTRIES.New().Code(): JSONRPC_INVALID_REQUEST,
+	errorcode.ERR_TOO_MANY_COMMAND_ENTRIES.New().Code(): JSONRPC_INVALID_REQUEST,
+	errorcode.ERR_API_NOT_FOUND.New().Code():            JSONRPC_METHOD_NOT_FOUND,
+	errorcode.ERR_GRAPH_NOT_EXIST.New().Code():          JSONRPC_METHOD_NOT_FOUND,
+	errorcode.ERR_JSONRPC_INVALID_PARAMS.New().Code():   JSONRPC_INVALID_PARAMS,
+	errorcode.ERR_REQUEST_TIMEOUT.New().Code():          JSONRPC_REQUEST_TIMEOUT,
+}
+
+type EntranceJSONRPCConf struct {
+	Host      string                `json:"host"`
+	Port      int32                 `json:"port"`
+	Domain    string                `json:"domain"`
+	Path      string                `json:"path"`
+	Timeout   int64                 `json:"timeout"` // millisecond, default is REQ_TIMEOUT
+	ToContext EntranceToContextConf `json:"to_context"`
+
+	MaxBodySize int64 `json:"max_body_size"` // bytes, default is DefaultMaxBodySize
+
+	timeout time.Duration `json:"-"`
+}
+
+func (p *EntranceJSONRPCConf) GetListenAddress() string {
+	return fmt.Sprintf("%s:%d", p.Host, p.Port)
+}
+
+type EntranceJSONRPC struct {
+	config    EntranceJSONRPCConf
+	martini   *martini.ClassicMartini
+	messenger Messenger
+}
+
+type jsonrpcRequest struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  interface{}     `json:"params"`
+	Id      json.RawMessage `json:"id"`
+}
+
+type jsonrpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+type jsonrpcResponse struct {
+	Version string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *jsonrpcError   `json:"error,omitempty"`
+	Id      json.RawMessage `json:"id"`
+
+	payload *Payload `json:"-"`
+}
+
+func init() {
+	entrancefactory.RegisterEntrance(new(EntranceJSONRPC))
+}
+
+func (p *EntranceJSONRPC) Type() string {
+	return "jsonrpc"
+}
+
+func (p *EntranceJSONRPC) Init(messenger Messenger, configs EntranceConfig) (err error) {
+	if e := configs.FillToObject(&p.config); e != nil {
+		err = errorcode.ERR_CONFIG_TO_OBJECT_FAILED.New(errors.Params{"err": e})
+		return
+	}
+
+	if p.config.Timeout > 0 {
+		p.config.timeout = time.Duration(p.config.Timeout) * time.Millisecond
+	} else {
+		p.config.timeout = REQ_TIMEOUT
+	}
+
+	if messenger == nil {
+		err = errorcode.ERR_MESSENGER_IS_NIL.New(errors.Params{"type": p.Type()})
+		return
+	} else {
+		p.messenger = messenger
+	}
+	return
+}
+
+func (p *EntranceJSONRPC) Run() error {
+	p.martini = martini.Classic()
+	p.martini.Post(p.config.Path, p.postHandler())
+
+	listenAddr := p.config.GetListenAddress()
+
+	logs.Info("entrance", p.Type(), "start:", listenAddr)
+
+	p.martini.RunOnAddr(listenAddr)
+
+	return nil
+}
+
+func (p *EntranceJSONRPC) postHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		reqBody, err := readBody(r, p.config.Path, p.config.MaxBodySize)
+		if err != nil {
+			logs.Error(err)
+			writeJson(newJSONRPCErrorResponse(nil, err), w)
+			return
+		}
+
+		logs.Debug("json-rpc request:", p.config.Path, string(reqBody))
+
+		reqHeaders := p.requestHeaders(r)
+
+		reqBody = bytes.TrimSpace(reqBody)
+		if !json.Valid(reqBody) {
+			err = errorcode.ERR_REQUEST_SHOULD_BE_JSON.New()
+			logs.Error(err)
+			writeJson(newJSONRPCErrorResponse(nil, err), w)
+			return
+		}
+
+		if reqBody[0] != '[' {
+			if resp := p.handle(reqBody, reqHeaders); resp != nil {
+				p.writeCommands(resp.payload, w)
+				writeJson(resp, w)
+			} else {
+				w.WriteHeader(http.StatusNoContent)
+			}
+			return
+		}
+
+		// batch
+		var rawRequests []json.RawMessage
+		if json.Unmarshal(reqBody, &rawRequests); len(rawRequests) == 0 {
+			err = errorcode.ERR_JSONRPC_INVALID_REQUEST.New(errors.Params{"err": "empty batch"})
+			logs.Error(err)
+			writeJson(newJSONRPCErrorResponse(nil, err), w)
+			return
+		}
+
+		responses := make([]*jsonrpcResponse, len(rawRequests))
+
+		var wg sync.WaitGroup
+		for i, rawRequest := range rawRequests {
+			wg.Add(1)
+			go func(index int, rawRequest []byte) {
+				defer wg.Done()
+				responses[index] = p.handle(rawRequest, reqHeaders)
+			}(i, rawRequest)
+		}
+		wg.Wait()
+
+		replies := []*jsonrpcResponse{}
+		for _, resp := range responses {
+			if resp != nil {
+				p.writeCommands(resp.payload, w)
+				replies = append(replies, resp)
+			}
+		}
+
+		if len(replies) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		writeJson(replies, w)
+	}
+}
+
+// the message headers shared by the requests of a batch
+func (p *EntranceJSONRPC) requestHeaders(r *http.Request) (reqHeaders Headers) {
+	cookies := map[string]string{}
+	if p.config.ToContext.Cookies != nil {
+		for _, cookieName := range p.config.ToContext.Cookies {
+			if cookie, e := r.Cookie(cookieName); e == nil {
+				cookies[cookieName] = cookie.Value
+			}
+		}
+	}
+
+	headers := map[string]string{}
+	if p.config.ToContext.Headers != nil {
+		for _, headerName := range p.config.ToContext.Headers {
+			headers[headerName] = r.Header.Get(headerName)
+		}
+	}
+
+	reqHeaders.Cookies = cookies
+	reqHeaders.HTTPHeaders = headers
+	reqHeaders.fillTrace(r.Header.Get)
+	return
+}
+
+// handle one request of a batch or a single call, the response is nil
+// if the request is a notification
+func (p *EntranceJSONRPC) handle(rawRequest []byte, reqHeaders Headers) (resp *jsonrpcResponse) {
+	var fields map[string]json.RawMessage
+	if e := json.Unmarshal(rawRequest, &fields); e != nil {
+		err := errorcode.ERR_JSONRPC_INVALID_REQUEST.New(errors.Params{"err": e})
+		logs.Error(err)
+		return newJSONRPCErrorResponse(nil, err)
+	}
+
+	req := jsonrpcRequest{}
+	if e := json.Unmarshal(rawRequest, &req); e != nil {
+		err := errorcode.ERR_JSONRPC_INVALID_REQUEST.New(errors.Params{"err": e})
+		logs.Error(err)
+		return newJSONRPCErrorResponse(fields["id"], err)
+	}
+
+	_, isCall := fields["id"]
+
+	if req.Version != JSONRPC_VERSION || req.Method == "" {
+		err := errorcode.ERR_JSONRPC_INVALID_REQUEST.New(errors.Params{"err": "jsonrpc should be 2.0 and method should not be empty"})
+		logs.Error(err)
+		return newJSONRPCErrorResponse(req.Id, err)
+	}
+
+	switch req.Params.(type) {
+	case nil:
+		req.Params = map[string]interface{}{}
+	case map[string]interface{}, []interface{}:
+	default:
+		err := errorcode.ERR_JSONRPC_INVALID_PARAMS.New(errors.Params{"method": req.Method})
+		logs.Error(err)
+		return newJSONRPCErrorResponse(req.Id, err)
+	}
+
+	logs.Info("handle", req.Method)
+
+	comMsg, err := p.messenger.NewMessage(req.Params)
+	if err != nil {
+		err = errorcode.ERR_COULD_NOT_NEW_COMPONENT_MSG.New(errors.Params{"err": err})
+		logs.Error(err)
+		return newJSONRPCErrorResponse(req.Id, err)
+	}
+
+	*comMsg.Headers() = reqHeaders
+	comMsg.Headers().fillRequest(comMsg.Id, p.Type(), req.Method, p.config.timeout)
+	comMsg.Payload.fillDeprecatedContext(REQ_X_API)
+
+	msgId, ch, err := p.messenger.SendMessage(req.Method, comMsg)
+	if err != nil {
+		logs.Error(errorcode.ERR_SEND_COMPONENT_MSG_ERROR.New(errors.Params{"id": comMsg.Id, "err": err}))
+		if !isCall {
+			return nil
+		}
+		return newJSONRPCErrorResponse(req.Id, err)
+	}
+
+	if !isCall {
+		// nobody waits for a notification, but the request should be
+		// released after the graph finished
+		go p.wait(msgId, ch)
+		return nil
+	}
+
+	payload, err := p.wait(msgId, ch)
+	if err != nil {
+		logs.Error(err)
+		return newJSONRPCErrorResponse(req.Id, err)
+	}
+
+	if payload.Code != 0 {
+		resp = &jsonrpcResponse{Version: JSONRPC_VERSION, Error: newJSONRPCError(payload.Code, payload.Message, payload.result), Id: req.Id}
+	} else if payload.result == nil {
+		resp = &jsonrpcResponse{Version: JSONRPC_VERSION, Result: json.RawMessage("null"), Id: req.Id}
+	} else {
+		resp = &jsonrpcResponse{Version: JSONRPC_VERSION, Result: payload.result, Id: req.Id}
+	}
+	resp.payload = payload
+
+	return
+}
+
+func (p *EntranceJSONRPC) wait(msgId string, ch chan *Payload) (payload *Payload, err error) {
+	defer close(ch)
+	defer p.messenger.OnMessageEvent(msgId, MSG_EVENT_PROCESSED)
+
+	select {
+	case payload = <-ch:
+		// the blobs are deleted once the message is processed
+		err = payload.resolveResult()
+	case <-time.After(p.config.timeout):
+		err = errorcode.ERR_REQUEST_TIMEOUT.New(errors.Params{"id": msgId})
+	}
+	return
+}
+
+func (p *EntranceJSONRPC) writeCommands(payload *Payload, w http.ResponseWriter) {
+	if payload == nil {
+		return
+	}
+
+	if cmdCookies, err := GetCommandCookies(payload); err != nil {
+		logs.Error(err)
+	} else {
+		for _, c := range cmdCookies {
+			c.Domain = p.config.Domain
+			c.Path = "/"
+			http.SetCookie(w, c)
+		}
+	}
+
+	if cmdHeaders, err := GetCommandHeaders(payload); err != nil {
+		logs.Error(err)
+	} else {
+		for _, nv := range cmdHeaders {
+			w.Header().Add(nv.Name, nv.Value)
+		}
+	}
+}
+
+func newJSONRPCErrorResponse(id json.RawMessage, err error) *jsonrpcResponse {
+	rpcErr := &jsonrpcError{Code: JSONRPC_INTERNAL_ERROR, Message: err.Error()}
+
+	if errors.IsErrCode(err) {
+		rpcErr = newJSONRPCError(err.(errors.ErrCode).Code(), err.Error(), nil)
+	}
+
+	return &jsonrpcResponse{Version: JSONRPC_VERSION, Error: rpcErr, Id: id}
+}
+
+// the casper code is mapped by jsonrpcErrorCodes, it is in data with the
+// result of the failed graph, if any
+func newJSONRPCError(casperCode uint64, message string, result interface{}) *jsonrpcError {
+	code, exist := jsonrpcErrorCodes[casperCode]
+	if !exist {
+		code = JSONRPC_INTERNAL_ERROR
+	}
+
+	data := map[string]interface{}{"code": casperCode}
+	if result != nil {
+		data["result"] = result
+	}
+	return &jsonrpcError{Code: code, Message: message, Data: data}
+}
@@ -0,0 +1,112 @@
+package casper
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// the response without the error messages, which are for the humans
+func decodeJSONRPCResponse(t *testing.T, body string) interface{} {
+	var resp interface{}
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("%v: %s", err, body)
+	}
+
+	responses, isBatch := resp.([]interface{})
+	if !isBatch {
+		responses = []interface{}{resp}
+	}
+	for _, r := range responses {
+		if rpcErr, ok := r.(map[string]interface{})["error"].(map[string]interface{}); ok {
+			delete(rpcErr, "message")
+		}
+	}
+	return resp
+}
+
+func TestJSONRPCEntrance(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		status   int
+		expected string // without the error messages
+		sent     int
+	}{
+		{"call", `{"jsonrpc": "2.0", "method": "echo", "params": {"a": 1}, "id": 1}`,
+			200, `{"jsonrpc": "2.0", "result": {"a": 1}, "id": 1}`, 1},
+		{"positional params", `{"jsonrpc": "2.0", "method": "echo", "params": [1, 2], "id": "a"}`,
+			200, `{"jsonrpc": "2.0", "result": [1, 2], "id": "a"}`, 1},
+		{"null id is a call", `{"jsonrpc": "2.0", "method": "echo", "id": null}`,
+			200, `{"jsonrpc": "2.0", "result": {}, "id": null}`, 1},
+		{"notification", `{"jsonrpc": "2.0", "method": "echo", "params": {"a": 1}}`,
+			204, ``, 1},
+		{"failed notification", `{"jsonrpc": "2.0", "method": "missing"}`,
+			204, ``, 0},
+		{"method not found", `{"jsonrpc": "2.0", "method": "missing", "id": 1}`,
+			200, `{"jsonrpc": "2.0", "error": {"code": -32601, "data": {"code": 1022}}, "id": 1}`, 0},
+		{"graph failed", `{"jsonrpc": "2.0", "method": "fail", "id": 1}`,
+			200, `{"jsonrpc": "2.0", "error": {"code": -32603, "data": {"code": 9999, "result": {"reason": "failed"}}}, "id": 1}`, 1},
+		{"parse error", `{"jsonrpc": "2.0", `,
+			200, `{"jsonrpc": "2.0", "error": {"code": -32700, "data": {"code": 1001}}, "id": null}`, 0},
+		{"wrong version", `{"jsonrpc": "1.0", "method": "echo", "id": 1}`,
+			200, `{"jsonrpc": "2.0", "error": {"code": -32600, "data": {"code": 1027}}, "id": 1}`, 0},
+		{"invalid params", `{"jsonrpc": "2.0", "method": "echo", "params": "a", "id": 1}`,
+			200, `{"jsonrpc": "2.0", "error": {"code": -32602, "data": {"code": 1028}}, "id": 1}`, 0},
+		{"empty batch", `[]`,
+			200, `{"jsonrpc": "2.0", "error": {"code": -32600, "data": {"code": 1027}}, "id": null}`, 0},
+		{"batch", `[
+			{"jsonrpc": "2.0", "method": "echo", "params": {"n": 1}, "id": 1},
+			{"jsonrpc": "2.0", "method": "echo", "params": {"n": 2}},
+			1,
+			{"jsonrpc": "2.0", "method": "missing", "id": 3},
+			{"jsonrpc": "2.0", "method": "echo", "params": {"n": 4}, "id": 4}
+		]`, 200, `[
+			{"jsonrpc": "2.0", "result": {"n": 1}, "id": 1},
+			{"jsonrpc": "2.0", "error": {"code": -32600, "data": {"code": 1027}}, "id": null},
+			{"jsonrpc": "2.0", "error": {"code": -32601, "data": {"code": 1022}}, "id": 3},
+			{"jsonrpc": "2.0", "result": {"n": 4}, "id": 4}
+		]`, 3},
+		{"batch of notifications", `[
+			{"jsonrpc": "2.0", "method": "echo", "params": {"n": 1}},
+			{"jsonrpc": "2.0", "method": "echo", "params": {"n": 2}}
+		]`, 204, ``, 2},
+	}
+
+	for _, test := range tests {
+		messenger := newTestMessenger(func(graphName string, comMsg *ComponentMessage) *Payload {
+			if graphName == "fail" {
+				return testPayload(9999, "failed", map[string]interface{}{"reason": "failed"})
+			}
+			return echoReply(graphName, comMsg)
+		})
+
+		entrance := new(EntranceJSONRPC)
+		if err := entrance.Init(messenger, EntranceConfig{"path": "/rpc"}); err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		entrance.postHandler()(w, httptest.NewRequest("POST", "/rpc", strings.NewReader(test.body)))
+
+		if w.Code != test.status {
+			t.Errorf("%s: the status is %d, not %d", test.name, w.Code, test.status)
+			continue
+		}
+
+		if test.status == http.StatusNoContent {
+			if w.Body.Len() != 0 {
+				t.Errorf("%s: replied to the notifications: %s", test.name, w.Body)
+			}
+		} else if resp, expected := decodeJSONRPCResponse(t, w.Body.String()), decodeJSONRPCResponse(t, test.expected); !reflect.DeepEqual(resp, expected) {
+			t.Errorf("%s: the response is %s", test.name, w.Body)
+		}
+
+		if sent := len(messenger.sentMessages()); sent != test.sent {
+			t.Errorf("%s: %d messages are sent, not %d", test.name, sent, test.sent)
+		}
+	}
+}
@@ -1,9 +1,9 @@
 package casper
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
@@ -20,15 +20,22 @@ var (
 	respInternalError  = httpRespStruct{Code: http.StatusInternalServerError, Message: "internal server error"}
 	respRequestTimeout = httpRespStruct{Code: http.StatusRequestTimeout, Message: "request timeout"}
 
+	respRequestTooLarge = httpRespStruct{Code: http.StatusRequestEntityTooLarge, Message: "request entity too large"}
+
 	respNotFound   = httpRespStruct{Code: http.StatusNotFound, Message: "api not found"}
 	respBadRequest = httpRespStruct{Code: http.StatusBadRequest, Message: "bad request"}
 	respNotAJson   = httpRespStruct{Code: http.StatusBadRequest, Message: "request data should be json struct"}
 )
 
+// Deprecated: the cookies and the headers of to_context are in the
+// Cookies and HTTPHeaders of the message headers, the entrances still fill
+// them for now
 const (
 	CTX_HTTP_COOKIES = "CTX_HTTP_COOKIES"
 	CTX_HTTP_HEADERS = "CTX_HTTP_HEADERS"
+)
 
+const (
 	CMD_HTTP_HEADERS_SET = "CMD_HTTP_HEADERS_SET"
 	CMD_HTTP_COOKIES_SET = "CMD_HTTP_COOKIES_SET"
 )
@@ -37,6 +44,40 @@ const (
 	DefaultAPIHeader = "X-API"
 )
 
+type EntranceAsyncConf struct {
+	Enabled             bool   `json:"enabled"`
+	Header              string `json:"header"`                // default is X-Async, the request is async if the value is true
+	CallbackURLHeader   string `json:"callback_url_header"`   // default is X-Callback-Url
+	CallbackGraphHeader string `json:"callback_graph_header"` // default is X-Callback-Graph
+	Timeout             int64  `json:"timeout"`               // millisecond, default is REQ_TIMEOUT
+	ResultTTL           int64  `json:"result_ttl"`            // second, default is DefaultAsyncResultTTL
+
+	// the urls of the callback url header must be in it, the ones end with *
+	// are prefixes, e.g. https://hooks.example.com/casper/*, the callback
+	// url header is rejected if it is empty
+	AllowedCallbackURLs []string `json:"allowed_callback_urls"`
+}
+
+// the callers choose the webhook, so the server only posts the results to
+// the urls of the config, not to the internal addresses they like
+func (p *EntranceAsyncConf) callbackAllowed(webhook string) bool {
+	u, err := url.Parse(webhook)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return false
+	}
+
+	for _, allowed := range p.AllowedCallbackURLs {
+		if strings.HasSuffix(allowed, "*") {
+			if strings.HasPrefix(webhook, strings.TrimSuffix(allowed, "*")) {
+				return true
+			}
+		} else if webhook == allowed {
+			return true
+		}
+	}
+	return false
+}
+
 type EntranceToContextConf struct {
 	Cookies []string `json:"cookies"`
 	Headers []string `json:"headers"`
@@ -53,6 +94,10 @@ type EntranceMartiniConf struct {
 	P3P          string                `json:"p3p"`
 	Server       string                `json:"server"`
 	ToContext    EntranceToContextConf `json:"to_context"`
+	Async        EntranceAsyncConf     `json:"async"`
+	HopsHeader   string                `json:"hops_header"`   // the hops are returned in it if the request has it, e.g. X-Casper-Hops
+	MaxBodySize  int64                 `json:"max_body_size"` // bytes, default is DefaultMaxBodySize
+	Record       EntranceRecordConf    `json:"record"`        // the requests and the replies are recorded if the file is set, see casper replay
 	apiHeader    string                `json:"api_header"`
 
 	allowHeaders    string            `json:"-"`
@@ -68,6 +113,9 @@ type EntranceMartini struct {
 	config    EntranceMartiniConf
 	martini   *martini.ClassicMartini
 	messenger Messenger
+	async     *AsyncInvoker
+	recorder  *Recorder
+	server    *http.Server
 }
 
 type httpRespStruct struct {
@@ -114,12 +162,36 @@ func (p *EntranceMartini) Init(messenger Messenger, configs EntranceConfig) (err
 		p.config.apiHeader = DefaultAPIHeader
 	}
 
+	if p.config.Async.Header == "" {
+		p.config.Async.Header = "X-Async"
+	}
+
+	if p.config.Async.CallbackURLHeader == "" {
+		p.config.Async.CallbackURLHeader = "X-Callback-Url"
+	}
+
+	if p.config.Async.CallbackGraphHeader == "" {
+		p.config.Async.CallbackGraphHeader = "X-Callback-Graph"
+	}
+
 	if messenger == nil {
 		err = errorcode.ERR_MESSENGER_IS_NIL.New(errors.Params{"type": p.Type()})
 		return
 	} else {
 		p.messenger = messenger
 	}
+
+	if p.config.Async.Enabled {
+		p.async = NewAsyncInvoker(messenger,
+			time.Duration(p.config.Async.Timeout)*time.Millisecond,
+			time.Duration(p.config.Async.ResultTTL)*time.Second)
+	}
+
+	if p.config.Record.File != "" {
+		if p.recorder, err = NewRecorder(p.config.Record); err != nil {
+			return
+		}
+	}
 	return
 }
 
@@ -128,15 +200,38 @@ func (p *EntranceMartini) Run() error {
 	p.martini.Post(p.config.Path, p.postHandler())
 	p.martini.Options(p.config.Path, p.optionsHandle())
 
+	if p.async != nil {
+		p.martini.Get(p.config.Path+"/async/:id", p.asyncResultHandler())
+	}
+
 	listenAddr := p.config.GetListenAddress()
 
 	logs.Info("entrance", p.Type(), "start:", listenAddr)
 
-	p.martini.RunOnAddr(listenAddr)
-
+	p.server = &http.Server{Addr: listenAddr, Handler: p.martini}
+	if err := p.server.ListenAndServe(); err != http.ErrServerClosed {
+		p.closeRecorder()
+		return err
+	}
 	return nil
 }
 
+// Stop waits for the requests being handled, the recorder is closed after
+// them
+func (p *EntranceMartini) Stop() (err error) {
+	if p.server != nil {
+		err = p.server.Shutdown(context.Background())
+	}
+	p.closeRecorder()
+	return
+}
+
+func (p *EntranceMartini) closeRecorder() {
+	if err := p.recorder.Close(); err != nil {
+		logs.Error(errorcode.ERR_RECORD_FAILED.New(errors.Params{"file": p.config.Record.File, "err": err}))
+	}
+}
+
 func (p *EntranceMartini) setBasicHeaders(w http.ResponseWriter, r *http.Request) {
 	refer := r.Referer()
 	if refer == "" {
@@ -156,7 +251,11 @@ func (p *EntranceMartini) setBasicHeaders(w http.ResponseWriter, r *http.Request
 		}
 	}
 
-	w.Header().Set("Access-Control-Allow-Methods", "POST")
+	if p.async != nil {
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET")
+	} else {
+		w.Header().Set("Access-Control-Allow-Methods", "POST")
+	}
 	w.Header().Set("Access-Control-Allow-Headers", p.config.allowHeaders)
 	w.Header().Set("Content-Type", "application/json")
 
@@ -189,18 +288,31 @@ func (p *EntranceMartini) postHandler() func(http.ResponseWriter, *http.Request)
 		var err error
 
 		apiName := r.Header.Get(p.config.apiHeader)
+
+		// all the replies are recorded, the request is kept once the
+		// message is made
+		recording := p.recorder.begin(p.Type(), apiName)
+		reply := func(resp httpRespStruct) {
+			p.recorder.finish(recording, resp.Code, resp.Message, resp.Result)
+			writeJson(resp, w)
+		}
+
 		if apiName == "" {
 			logs.Error(errorcode.ERR_API_NOT_FOUND.New(errors.Params{"apiName": apiName}))
-			writeJson(respNotFound, w)
+			reply(respNotFound)
 			return
 		}
 
 		logs.Info("handle", apiName)
 
 		var reqBody []byte
-		if reqBody, err = ioutil.ReadAll(r.Body); err != nil {
-			logs.Error(errorcode.ERR_BAD_REQUEST.New(errors.Params{"path": p.config.Path, "err": err}))
-			writeJson(respBadRequest, w)
+		if reqBody, err = readBody(r, p.config.Path, p.config.MaxBodySize); err != nil {
+			logs.Error(err)
+			if isLimitExceeded(err) {
+				reply(respRequestTooLarge)
+			} else {
+				reply(respBadRequest)
+			}
 			return
 		} else if strings.TrimSpace(string(reqBody)) == "" {
 			reqBody = []byte("{}")
@@ -212,7 +324,7 @@ func (p *EntranceMartini) postHandler() func(http.ResponseWriter, *http.Request)
 
 		if e := json.Unmarshal(reqBody, &mapResult); e != nil {
 			logs.Error(errorcode.ERR_REQUEST_SHOULD_BE_JSON.New())
-			writeJson(respNotAJson, w)
+			reply(respNotAJson)
 			return
 		}
 
@@ -220,7 +332,7 @@ func (p *EntranceMartini) postHandler() func(http.ResponseWriter, *http.Request)
 		var comMsg *ComponentMessage
 		if comMsg, err = p.messenger.NewMessage(mapResult); err != nil {
 			logs.Error(errorcode.ERR_COULD_NOT_NEW_COMPONENT_MSG.New(errors.Params{"err": err}))
-			writeJson(respInternalError, w)
+			reply(respInternalError)
 			return
 		}
 
@@ -240,20 +352,69 @@ func (p *EntranceMartini) postHandler() func(http.ResponseWriter, *http.Request)
 			}
 		}
 
-		comMsg.Payload.SetContext(CTX_HTTP_COOKIES, cookies)
-		comMsg.Payload.SetContext(CTX_HTTP_HEADERS, headers)
-		comMsg.Payload.SetContext(p.config.apiHeader, apiName)
+		reqHeaders := comMsg.Headers()
+		reqHeaders.Cookies = cookies
+		reqHeaders.HTTPHeaders = headers
+		reqHeaders.fillTrace(r.Header.Get)
+
+		// the async requests are waited for by the async invoker
+		isAsync := p.async != nil && r.Header.Get(p.config.Async.Header) == "true"
+
+		timeout := REQ_TIMEOUT
+		if isAsync {
+			timeout = p.async.timeout
+		}
+		reqHeaders.fillRequest(comMsg.Id, p.Type(), apiName, timeout)
+		comMsg.Payload.fillDeprecatedContext(p.config.apiHeader)
+
+		recording = p.recorder.request(recording, comMsg)
 
 		logs.Pretty("request_cookies:", cookies)
 		logs.Pretty("request_headers:", headers)
 
+		if isAsync {
+			if recording != nil {
+				recording.Async = true
+			}
+
+			callback := &AsyncCallback{
+				Webhook: r.Header.Get(p.config.Async.CallbackURLHeader),
+				Graph:   r.Header.Get(p.config.Async.CallbackGraphHeader)}
+
+			if callback.Webhook != "" && !p.config.Async.callbackAllowed(callback.Webhook) {
+				errCode := errorcode.ERR_ASYNC_CALLBACK_NOT_ALLOWED.New(errors.Params{"callback": callback.Webhook})
+				logs.Error(errCode)
+				reply(httpRespStruct{Code: errCode.Code(), Message: errCode.Error()})
+				return
+			}
+
+			msgId := ""
+			if msgId, err = p.async.Invoke(apiName, comMsg, callback); err != nil {
+				logs.Error(errorcode.ERR_SEND_COMPONENT_MSG_ERROR.New(errors.Params{"id": comMsg.Id, "err": err}))
+				if isLimitExceeded(err) {
+					reply(httpRespStruct{Code: http.StatusRequestEntityTooLarge, Message: err.Error()})
+				} else {
+					reply(respInternalError)
+				}
+				return
+			}
+
+			w.Header().Set("X-Response-Id", msgId)
+			reply(httpRespStruct{Code: 0, Message: ASYNC_STATUS_PENDING, Result: map[string]string{"id": msgId}})
+			return
+		}
+
 		// send msg to next
 		msgId := ""
 		var ch chan *Payload
 
 		if msgId, ch, err = p.messenger.SendMessage(apiName, comMsg); err != nil {
 			logs.Error(errorcode.ERR_SEND_COMPONENT_MSG_ERROR.New(errors.Params{"id": msgId, "err": err}))
-			writeJson(respInternalError, w)
+			if isLimitExceeded(err) {
+				reply(httpRespStruct{Code: http.StatusRequestEntityTooLarge, Message: err.Error()})
+			} else {
+				reply(respInternalError)
+			}
 			return
 		}
 
@@ -271,70 +432,76 @@ func (p *EntranceMartini) postHandler() func(http.ResponseWriter, *http.Request)
 		case payload = <-ch:
 			break
 		case <-time.Tick(REQ_TIMEOUT):
-			writeJson(respRequestTimeout, w)
+			reply(respRequestTimeout)
 			return
 		}
 
 		// Cookies
-		cmdCookiesSize := payload.GetCommandValueSize(CMD_HTTP_COOKIES_SET)
-		cmdCookies := make([]interface{}, cmdCookiesSize)
-		for i := 0; i < cmdCookiesSize; i++ {
-			cookie := new(http.Cookie)
-			cmdCookies[i] = cookie
-		}
-
-		if err = payload.GetCommandObjectArray(CMD_HTTP_COOKIES_SET, cmdCookies); err != nil {
-			err = errorcode.ERR_PARSE_COMMAND_TO_OBJECT_FAILED.New(errors.Params{"cmd": CMD_HTTP_COOKIES_SET, "err": err})
+		var cmdCookies []*http.Cookie
+		if cmdCookies, err = GetCommandCookies(payload); err != nil {
 			logs.Error(err)
-			writeJson(respInternalError, w)
+			reply(respInternalError)
 			return
 		}
 
-		for _, cookie := range cmdCookies {
-			if c, ok := cookie.(*http.Cookie); ok {
-				c.Domain = p.config.Domain
-				c.Path = "/"
-				logs.Pretty("write cookie:", c)
-				http.SetCookie(w, c)
-			} else {
-				err = errorcode.ERR_PARSE_COMMAND_TO_OBJECT_FAILED.New(errors.Params{"cmd": CMD_HTTP_COOKIES_SET, "err": "object could not parser to cookies"})
-				logs.Error(err)
-				writeJson(respInternalError, w)
-				return
-			}
-		}
-
-		cmdHeadersSize := payload.GetCommandValueSize(CMD_HTTP_HEADERS_SET)
-		cmdHeaders := make([]interface{}, cmdHeadersSize)
-		for i := 0; i < cmdHeadersSize; i++ {
-			header := new(NameValue)
-			cmdHeaders[i] = header
+		for _, c := range cmdCookies {
+			c.Domain = p.config.Domain
+			c.Path = "/"
+			logs.Pretty("write cookie:", c)
+			http.SetCookie(w, c)
 		}
 
-		if err = payload.GetCommandObjectArray(CMD_HTTP_HEADERS_SET, cmdHeaders); err != nil {
-			err = errorcode.ERR_PARSE_COMMAND_TO_OBJECT_FAILED.New(errors.Params{"cmd": CMD_HTTP_HEADERS_SET, "err": err})
+		var cmdHeaders []*NameValue
+		if cmdHeaders, err = GetCommandHeaders(payload); err != nil {
 			logs.Error(err)
-			writeJson(respInternalError, w)
+			reply(respInternalError)
 			return
 		}
 
-		for _, header := range cmdHeaders {
-			if nv, ok := header.(*NameValue); ok {
-				w.Header().Add(nv.Name, nv.Value)
-				logs.Pretty("write header:", nv)
+		for _, nv := range cmdHeaders {
+			w.Header().Add(nv.Name, nv.Value)
+			logs.Pretty("write header:", nv)
+		}
+
+		if p.config.HopsHeader != "" && r.Header.Get(p.config.HopsHeader) != "" {
+			if hops, e := json.Marshal(payload.Hops()); e != nil {
+				logs.Error(errorcode.ERR_JSON_MARSHAL_ERROR.New(errors.Params{"err": e}))
 			} else {
-				err = errorcode.ERR_PARSE_COMMAND_TO_OBJECT_FAILED.New(errors.Params{"cmd": CMD_HTTP_HEADERS_SET, "err": "object could not parser to headers"})
-				logs.Error(err)
-				writeJson(respInternalError, w)
-				return
+				w.Header().Set(p.config.HopsHeader, string(hops))
 			}
 		}
 
+		if err = payload.resolveResult(); err != nil {
+			logs.Error(err)
+			reply(respInternalError)
+			return
+		}
+
 		respObj := httpRespStruct{Code: payload.Code,
 			Message: payload.Message,
 			Result:  payload.result}
 
-		writeJson(respObj, w)
+		// a component of the graph rejected the message
+		if limitErrorCodes[payload.Code] {
+			respObj.Code = http.StatusRequestEntityTooLarge
+		}
+
+		reply(respObj)
+	}
+}
+
+func (p *EntranceMartini) asyncResultHandler() func(martini.Params, http.ResponseWriter, *http.Request) {
+	return func(params martini.Params, w http.ResponseWriter, r *http.Request) {
+		p.setBasicHeaders(w, r)
+
+		result, err := p.async.Result(params["id"])
+		if err != nil {
+			logs.Error(err)
+			writeJson(httpRespStruct{Code: http.StatusNotFound, Message: "async result not found"}, w)
+			return
+		}
+
+		writeJson(httpRespStruct{Code: 0, Message: result.Status, Result: result}, w)
 	}
 }
 
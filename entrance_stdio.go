@@ -0,0 +1,258 @@
+package casper
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogap/errors"
+	"github.com/gogap/logs"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+type EntranceStdioConf struct {
+	Input       string `json:"input"`         // default is stdin
+	Output      string `json:"output"`        // default is stdout
+	Parallelism int    `json:"parallelism"`   // default is 1
+	Timeout     int64  `json:"timeout"`       // millisecond, default is REQ_TIMEOUT
+	MaxLineSize int    `json:"max_line_size"` // bytes, default is DefaultMaxMessageSize
+
+	timeout time.Duration `json:"-"`
+}
+
+// one line of the input
+type StdioRequest struct {
+	Api     string                 `json:"api"`
+	Body    interface{}            `json:"body"`
+	Context map[string]interface{} `json:"context"`
+}
+
+// one line of the output, in the same order as the input
+type StdioResponse struct {
+	Line    int         `json:"line"`
+	Id      string      `json:"id,omitempty"`
+	Api     string      `json:"api"`
+	Code    uint64      `json:"code"`
+	Message string      `json:"message"`
+	Result  interface{} `json:"result"`
+}
+
+type stdioTask struct {
+	line  int
+	data  string
+	reply chan *StdioResponse
+}
+
+// reads newline-delimited json requests, sends them through the graphs,
+// and writes the replies as json lines, Run returns at the end of input
+type EntranceStdio struct {
+	config    EntranceStdioConf
+	messenger Messenger
+}
+
+func init() {
+	entrancefactory.RegisterEntrance(new(EntranceStdio))
+}
+
+func (p *EntranceStdio) Type() string {
+	return "stdio"
+}
+
+func (p *EntranceStdio) Init(messenger Messenger, configs EntranceConfig) (err error) {
+	if e := configs.FillToObject(&p.config); e != nil {
+		err = errorcode.ERR_CONFIG_TO_OBJECT_FAILED.New(errors.Params{"err": e})
+		return
+	}
+
+	if p.config.Parallelism <= 0 {
+		p.config.Parallelism = 1
+	}
+
+	p.config.MaxLineSize = limitOrDefault(p.config.MaxLineSize, DefaultMaxMessageSize)
+
+	if p.config.Timeout > 0 {
+		p.config.timeout = time.Duration(p.config.Timeout) * time.Millisecond
+	} else {
+		p.config.timeout = REQ_TIMEOUT
+	}
+
+	if messenger == nil {
+		err = errorcode.ERR_MESSENGER_IS_NIL.New(errors.Params{"type": p.Type()})
+		return
+	} else {
+		p.messenger = messenger
+	}
+	return
+}
+
+func (p *EntranceStdio) Run() (err error) {
+	var input io.Reader = os.Stdin
+	var output io.Writer = os.Stdout
+
+	if p.config.Input != "" && p.config.Input != "-" {
+		var f *os.File
+		if f, err = os.Open(p.config.Input); err != nil {
+			err = errorcode.ERR_OPENFILE_ERROR.New(errors.Params{"fileName": p.config.Input, "err": err})
+			return
+		}
+		defer f.Close()
+		input = f
+	}
+
+	if p.config.Output != "" && p.config.Output != "-" {
+		var f *os.File
+		if f, err = os.Create(p.config.Output); err != nil {
+			err = errorcode.ERR_OPENFILE_ERROR.New(errors.Params{"fileName": p.config.Output, "err": err})
+			return
+		}
+		defer f.Close()
+		output = f
+	}
+
+	logs.Info("entrance", p.Type(), "start, parallelism:", p.config.Parallelism)
+
+	return p.Serve(input, output)
+}
+
+func (p *EntranceStdio) Serve(input io.Reader, output io.Writer) (err error) {
+	tasks := make(chan *stdioTask)
+	ordered := make(chan *stdioTask, p.config.Parallelism*2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < p.config.Parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range tasks {
+				task.reply <- p.handle(task.line, task.data)
+			}
+		}()
+	}
+
+	writeDone := make(chan error, 1)
+	go func() {
+		writer := bufio.NewWriter(output)
+		var writeErr error
+		for task := range ordered {
+			resp := <-task.reply
+			if writeErr != nil {
+				continue
+			}
+
+			if bJson, e := json.Marshal(resp); e != nil {
+				logs.Error(errorcode.ERR_JSON_MARSHAL_ERROR.New(errors.Params{"err": e}))
+			} else if _, e = writer.Write(append(bJson, '\n')); e != nil {
+				writeErr = e
+			} else if e = writer.Flush(); e != nil {
+				writeErr = e
+			}
+		}
+		writeDone <- writeErr
+	}()
+
+	maxLineSize := limitOrDefault(p.config.MaxLineSize, DefaultMaxMessageSize)
+
+	// the scanner allows the lines as long as the buffer, whatever the max is
+	bufferSize := 64 * 1024
+	if bufferSize > maxLineSize {
+		bufferSize = maxLineSize
+	}
+
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, bufferSize), maxLineSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := strings.TrimSpace(scanner.Text())
+		if data == "" {
+			continue
+		}
+
+		task := &stdioTask{line: line, data: data, reply: make(chan *StdioResponse, 1)}
+		ordered <- task
+		tasks <- task
+	}
+
+	close(tasks)
+	wg.Wait()
+	close(ordered)
+
+	if err = <-writeDone; err != nil {
+		return
+	}
+
+	// the input could not be read on after a too long line
+	if err = scanner.Err(); err == bufio.ErrTooLong {
+		err = errorcode.ERR_MESSAGE_TOO_LARGE.New(errors.Params{"max": maxLineSize, "at": fmt.Sprintf("line %d", line+1)})
+	}
+	return
+}
+
+func (p *EntranceStdio) handle(line int, data string) (resp *StdioResponse) {
+	resp = &StdioResponse{Line: line}
+
+	req := StdioRequest{}
+	if e := json.Unmarshal([]byte(data), &req); e != nil {
+		return p.errorResponse(resp, errorcode.ERR_REQUEST_SHOULD_BE_JSON.New())
+	}
+
+	resp.Api = req.Api
+	if req.Api == "" {
+		return p.errorResponse(resp, errorcode.ERR_API_NOT_FOUND.New(errors.Params{"apiName": req.Api}))
+	}
+
+	if req.Body == nil {
+		req.Body = map[string]interface{}{}
+	}
+
+	comMsg, err := p.messenger.NewMessage(req.Body)
+	if err != nil {
+		return p.errorResponse(resp, errorcode.ERR_COULD_NOT_NEW_COMPONENT_MSG.New(errors.Params{"err": err}))
+	}
+
+	for key, value := range req.Context {
+		comMsg.Payload.SetContext(key, value)
+	}
+	comMsg.Headers().fillRequest(comMsg.Id, p.Type(), req.Api, p.config.timeout)
+	comMsg.Payload.fillDeprecatedContext(REQ_X_API)
+
+	msgId, ch, err := p.messenger.SendMessage(req.Api, comMsg)
+	if err != nil {
+		return p.errorResponse(resp, errorcode.ERR_SEND_COMPONENT_MSG_ERROR.New(errors.Params{"id": comMsg.Id, "err": err}))
+	}
+	defer p.messenger.OnMessageEvent(msgId, MSG_EVENT_PROCESSED)
+
+	resp.Id = msgId
+
+	select {
+	case payload := <-ch:
+		if err = payload.resolveResult(); err != nil {
+			return p.errorResponse(resp, err)
+		}
+		resp.Code = payload.Code
+		resp.Message = payload.Message
+		resp.Result = payload.result
+	case <-time.After(p.config.timeout):
+		return p.errorResponse(resp, errorcode.ERR_REQUEST_TIMEOUT.New(errors.Params{"id": msgId}))
+	}
+
+	return
+}
+
+func (p *EntranceStdio) errorResponse(resp *StdioResponse, err error) *StdioResponse {
+	logs.Error(err)
+
+	resp.Code = 500
+	resp.Message = err.Error()
+	if errors.IsErrCode(err) {
+		resp.Code = err.(errors.ErrCode).Code()
+	}
+	return resp
+}
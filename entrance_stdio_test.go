@@ -0,0 +1,107 @@
+package casper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogap/errors"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+// the later lines are replied earlier, the output should still be in the
+// order of the input
+func stdioTestMessenger() *testMessenger {
+	return newTestMessenger(func(graphName string, comMsg *ComponentMessage) *Payload {
+		var body struct {
+			Delay int `json:"delay"`
+		}
+		comMsg.Payload.UnmarshalResult(&body)
+		time.Sleep(time.Duration(body.Delay) * time.Millisecond)
+		return echoReply(graphName, comMsg)
+	})
+}
+
+func TestStdioEntranceOrder(t *testing.T) {
+	input := []string{}
+	expected := []uint64{}
+	for i := 0; i < 20; i++ {
+		switch i {
+		case 3:
+			input = append(input, "")
+			continue
+		case 5:
+			input = append(input, "not json")
+			expected = append(expected, 1001)
+		case 8:
+			input = append(input, `{"body": {}}`)
+			expected = append(expected, 404)
+		case 13:
+			input = append(input, fmt.Sprintf(`{"api": %q}`, testMissingGraph))
+			expected = append(expected, 1003)
+		default:
+			input = append(input, fmt.Sprintf(`{"api": "echo", "body": {"n": %d, "delay": %d}}`, i, 40-2*i))
+			expected = append(expected, 0)
+		}
+	}
+
+	for _, parallelism := range []int{1, 4, 16} {
+		entrance := new(EntranceStdio)
+		if err := entrance.Init(stdioTestMessenger(), EntranceConfig{"parallelism": parallelism}); err != nil {
+			t.Fatal(err)
+		}
+
+		output := new(bytes.Buffer)
+		if err := entrance.Serve(strings.NewReader(strings.Join(input, "\n")), output); err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+		if len(lines) != len(expected) {
+			t.Fatalf("parallelism %d: %d lines for %d requests", parallelism, len(lines), len(expected))
+		}
+
+		prev := 0
+		for i, line := range lines {
+			resp := StdioResponse{}
+			if err := json.Unmarshal([]byte(line), &resp); err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.Line <= prev {
+				t.Errorf("parallelism %d: line %d is written after line %d", parallelism, resp.Line, prev)
+			}
+			prev = resp.Line
+
+			if resp.Code != expected[i] {
+				t.Errorf("parallelism %d: the code of line %d is %d, not %d", parallelism, resp.Line, resp.Code, expected[i])
+			} else if resp.Code == 0 && resp.Result.(map[string]interface{})["n"] != float64(resp.Line-1) {
+				t.Errorf("parallelism %d: line %d is replied by %v", parallelism, resp.Line, resp.Result)
+			}
+		}
+	}
+}
+
+func TestStdioEntranceLineTooLong(t *testing.T) {
+	entrance := new(EntranceStdio)
+	if err := entrance.Init(stdioTestMessenger(), EntranceConfig{"parallelism": 2, "max_line_size": 64}); err != nil {
+		t.Fatal(err)
+	}
+
+	input := `{"api": "echo"}` + "\n" + `{"api": "echo", "body": {"text": "` + strings.Repeat("a", 64) + `"}}` + "\n" + `{"api": "echo"}`
+
+	output := new(bytes.Buffer)
+	err := entrance.Serve(strings.NewReader(input), output)
+	if err == nil || !errors.IsErrCode(err) || err.(errors.ErrCode).Code() != errorcode.ERR_MESSAGE_TOO_LARGE.New().Code() {
+		t.Fatalf("expected the message too large, got %v", err)
+	}
+
+	// the lines before are still replied
+	if lines := strings.Split(strings.TrimSpace(output.String()), "\n"); len(lines) != 1 {
+		t.Errorf("expected the reply of the first line, got %q", lines)
+	}
+}
@@ -4,16 +4,33 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/gogap/errors"
 	log "github.com/golang/glog"
 	zmq "github.com/pebbe/zmq4"
 
 	"github.com/gogap/logs"
+
+	"github.com/gogap/casper/errorcode"
 )
 
+type EntranceZMQConf struct {
+	Address        string `json:"address"`
+	Timeout        int64  `json:"timeout"`          // millisecond, default is REQ_TIMEOUT
+	MaxConcurrency int    `json:"max_concurrency"`  // 0 means no limit
+	MaxMessageSize int    `json:"max_message_size"` // bytes, default is DefaultMaxMessageSize
+
+	timeout time.Duration `json:"-"`
+}
+
+// the requests are handled concurrently, but a zmq socket could only be
+// used by one goroutine, so the replies go back to the router through
+// an inproc socket which is owned by the handler loop as well
 type EntranceZMQ struct {
-	address   string
-	app       *App
+	config    EntranceZMQConf
 	socket    *zmq.Socket
+	replyIn   *zmq.Socket
+	replies   chan [][]byte
+	tokens    chan bool
 	messenger Messenger
 }
 
@@ -26,12 +43,30 @@ func (p *EntranceZMQ) Type() string {
 }
 
 func (p *EntranceZMQ) Init(messenger Messenger, configs EntranceConfig) (err error) {
-	if addr, ok := configs.GetConfigString("address"); !ok {
+	if e := configs.FillToObject(&p.config); e != nil {
+		err = errorcode.ERR_CONFIG_TO_OBJECT_FAILED.New(errors.Params{"err": e})
+		return
+	}
+
+	if p.config.Address == "" {
 		err = fmt.Errorf("[entrance-%s] get config section of %s failed", p.Type(), "address")
+		return
+	}
+
+	if p.config.Timeout > 0 {
+		p.config.timeout = time.Duration(p.config.Timeout) * time.Millisecond
 	} else {
-		p.address = addr
+		p.config.timeout = REQ_TIMEOUT
 	}
 
+	if p.config.MaxConcurrency > 0 {
+		p.tokens = make(chan bool, p.config.MaxConcurrency)
+	}
+
+	p.config.MaxMessageSize = limitOrDefault(p.config.MaxMessageSize, DefaultMaxMessageSize)
+
+	p.replies = make(chan [][]byte, 1024)
+
 	if messenger == nil {
 		err = fmt.Errorf("[entrance-%s] Messenger is nil", p.Type())
 		logs.Info(err)
@@ -46,89 +81,255 @@ func (p *EntranceZMQ) Init(messenger Messenger, configs EntranceConfig) (err err
 func (p *EntranceZMQ) Run() error {
 	var err error
 
-	if p.socket, err = zmq.NewSocket(zmq.REP); err != nil {
+	if p.socket, err = zmq.NewSocket(zmq.ROUTER); err != nil {
+		return err
+	}
+
+	// zmq drops the larger frames and disconnects the peer before they are
+	// buffered, the check of recvRequest is kept for the replies of the
+	// smaller ones which are too large after decompression
+	if err = p.socket.SetMaxmsgsize(int64(p.config.MaxMessageSize)); err != nil {
+		return err
+	}
+
+	if err = p.socket.Bind(p.config.Address); err != nil {
+		return err
+	}
+
+	replyAddress := fmt.Sprintf("inproc://entrance-zmq-%p", p)
+
+	if p.replyIn, err = zmq.NewSocket(zmq.PULL); err != nil {
+		return err
+	}
+
+	if err = p.replyIn.Bind(replyAddress); err != nil {
+		return err
+	}
+
+	var replyOut *zmq.Socket
+	if replyOut, err = zmq.NewSocket(zmq.PUSH); err != nil {
 		return err
 	}
 
-	if err = p.socket.Bind(p.address); err != nil {
+	if err = replyOut.Connect(replyAddress); err != nil {
 		return err
 	}
 
-	logs.Info("entrance", p.Type(), "start:", p.address)
+	go p.replySender(replyOut)
+
+	logs.Info("entrance", p.Type(), "start:", p.config.Address)
 	p.EntranceZMQHandler()
 
 	return nil
 }
 
 func (p *EntranceZMQ) EntranceZMQHandler() {
+	poller := zmq.NewPoller()
+	poller.Add(p.socket, zmq.POLLIN)
+	poller.Add(p.replyIn, zmq.POLLIN)
+
 	for {
-		msg, err := p.socket.RecvMessageBytes(0)
+		polled, err := poller.Poll(-1)
 		if err != nil {
-			log.Errorln("recvMessage err:", err.Error())
-			p.socket.SendMessage(newPacket([]byte("ERR")))
+			logs.Error(errorcode.ERR_ZMQ_RECV_MSG_FAILED.New(errors.Params{"url": p.config.Address, "err": err}))
 			continue
 		}
 
-		if !isValidPacket(msg) {
-			log.Errorln("RecvMessage invalid message.")
-			p.socket.SendMessage(newPacket([]byte("ERR")))
-			continue
+		for _, item := range polled {
+			switch item.Socket {
+			case p.socket:
+				p.recvRequest()
+			case p.replyIn:
+				if reply, err := p.replyIn.RecvMessageBytes(0); err != nil {
+					logs.Error(errorcode.ERR_ZMQ_RECV_MSG_FAILED.New(errors.Params{"url": p.config.Address, "err": err}))
+				} else if _, err = p.socket.SendMessage(reply); err != nil {
+					logs.Error(err)
+				}
+			}
 		}
+	}
+}
 
-		log.Infoln("recvMessage:", string(msg[1]))
+func (p *EntranceZMQ) recvRequest() {
+	frames, err := p.socket.RecvMessageBytes(0)
+	if err != nil {
+		logs.Error(errorcode.ERR_ZMQ_RECV_MSG_FAILED.New(errors.Params{"url": p.config.Address, "err": err}))
+		return
+	}
 
-		comMsg, _ := NewComponentMessage(nil, nil)
-		err = comMsg.FromJson(msg[1])
-		if err != nil {
-			log.Errorln("RecvMessage message fmt error.")
-			p.socket.SendMessage(newPacket([]byte("ERR")))
-			continue
+	envelope, frames := splitZmqEnvelope(frames)
+	if envelope == nil {
+		logs.Error(errorcode.ERR_ZMQ_RECV_MSG_INVALID.New(errors.Params{"url": p.config.Address}))
+		return
+	}
+
+	packet, ok := ParseZMQPacket(frames)
+	if !ok {
+		p.replyError(envelope, Packet{}, nil, errorcode.ERR_ZMQ_RECV_MSG_INVALID.New(errors.Params{"url": p.config.Address}))
+		return
+	}
+
+	if len(packet.Message) > p.config.MaxMessageSize {
+		p.replyError(envelope, Packet{}, nil, errorcode.ERR_MESSAGE_TOO_LARGE.New(errors.Params{"max": p.config.MaxMessageSize, "at": p.config.Address}))
+		return
+	}
+
+	if p.tokens != nil {
+		select {
+		case p.tokens <- true:
+		default:
+			p.replyError(envelope, *packet, nil, errorcode.ERR_ENTRANCE_BUSY.New(errors.Params{"type": p.Type(), "max": p.config.MaxConcurrency}))
+			return
 		}
+	}
 
-		log.Infoln("recvComsg:", comMsg)
+	go p.handleRequest(envelope, packet)
+}
 
-		apiName, err := comMsg.Payload.GetContextString(REQ_X_API)
-		if err != nil {
-			log.Errorln("Get message's X-API error.", err.Error())
-			p.socket.SendMessage(newPacket([]byte("ERR")))
-			continue
+// the reply is encoded with the codec and the compression of the request
+func (p *EntranceZMQ) handleRequest(envelope [][]byte, packet *Packet) {
+	if p.tokens != nil {
+		defer func() { <-p.tokens }()
+	}
+
+	format := Packet{Codec: packet.Codec, Compression: packet.Compression}
+
+	comMsg, _ := NewComponentMessage(nil, nil)
+	if err := packet.Decompress(p.config.MaxMessageSize); err != nil {
+		p.replyError(envelope, Packet{}, nil, err)
+		return
+	} else if err := DecodePacket(packet, comMsg); err != nil {
+		p.replyError(envelope, Packet{}, nil, errorcode.ERR_COULD_NOT_PARSE_COMPONENT_MSG.New(
+			errors.Params{"in": p.config.Address,
+				"mqType": p.Type(),
+				"msg":    err}))
+		return
+	}
+
+	logs.Debug("entrance", p.Type(), "recv:", comMsg.Id)
+
+	if comMsg.Payload == nil {
+		comMsg.Payload = &Payload{}
+	}
+
+	// the clients before the message headers put the api into the context
+	apiName := comMsg.Headers().Api
+	if apiName == "" {
+		apiName, _ = comMsg.Payload.GetContextString(REQ_X_API)
+	}
+
+	if apiName == "" {
+		p.replyError(envelope, format, comMsg, errorcode.ERR_API_NOT_FOUND.New(errors.Params{"apiName": apiName}))
+		return
+	}
+
+	comMsg.Headers().fillRequest(comMsg.Id, p.Type(), apiName, p.config.timeout)
+	comMsg.Payload.fillDeprecatedContext(REQ_X_API)
+
+	// send msg to next
+	id, ch, err := p.messenger.SendMessage(apiName, comMsg)
+	if err != nil {
+		if !isLimitExceeded(err) {
+			err = errorcode.ERR_SEND_COMPONENT_MSG_ERROR.New(errors.Params{"id": comMsg.Id, "err": err})
 		}
-		if apiName == "" {
-			log.Errorln("Get message's X-API NULL.")
-			p.socket.SendMessage(newPacket([]byte("ERR")))
-			continue
+		p.replyError(envelope, format, comMsg, err)
+		return
+	}
+	defer p.messenger.OnMessageEvent(id, MSG_EVENT_PROCESSED)
+
+	// Wait for response from IN port
+	logs.Debug("Waiting for response: ", apiName, id)
+	select {
+	case payload := <-ch:
+		comMsg.Payload = payload
+		if err = payload.resolveResult(); err != nil {
+			p.replyError(envelope, format, comMsg, err)
+			return
 		}
+		p.reply(envelope, format, comMsg)
+	case <-time.After(p.config.timeout):
+		p.replyError(envelope, format, comMsg, errorcode.ERR_REQUEST_TIMEOUT.New(errors.Params{"id": id}))
+	}
+}
 
-		// send msg to next
-		id, ch, err := p.messenger.SendMessage(apiName, comMsg)
-		if err != nil {
-			log.Errorln("sendMsg err:", comMsg.Id, err.Error())
-			p.socket.SendMessage(newPacket([]byte("ERR")))
-			continue
+// the reply is a component message as well, the error is in the code and
+// message of the payload
+func (p *EntranceZMQ) replyError(envelope [][]byte, format Packet, comMsg *ComponentMessage, err error) {
+	logs.Error(err)
+
+	if comMsg == nil {
+		comMsg, _ = NewComponentMessage(nil, nil)
+	}
+
+	comMsg.Payload = &Payload{
+		Code:    500,
+		Message: err.Error(),
+		context: comMsg.Payload.context,
+		headers: comMsg.Payload.headers,
+		hops:    comMsg.Payload.hops}
+
+	if errors.IsErrCode(err) {
+		comMsg.Payload.Code = err.(errors.ErrCode).Code()
+	}
+
+	p.reply(envelope, format, comMsg)
+}
+
+// format is the codec and the compression of the reply
+func (p *EntranceZMQ) reply(envelope [][]byte, format Packet, comMsg *ComponentMessage) {
+	packet := &Packet{Codec: format.Codec}
+
+	c, err := GetCodecById(format.Codec)
+	if err == nil {
+		packet.Message, err = c.Marshal(comMsg)
+	}
+
+	if err == nil && format.Compression != COMPRESSION_NONE {
+		var compressor Compressor
+		if compressor, err = GetCompressorById(format.Compression); err == nil {
+			err = packet.Compress(compressor.Name(), 0)
 		}
-		if ch == nil {
-			log.Errorln("sendMsg return nil:", comMsg.Id)
-			p.socket.SendMessage(newPacket([]byte("ERR")))
-			continue
+	}
+
+	if err != nil {
+		err = errorcode.ERR_COMPONENT_MSG_SERIALIZE_FAILED.New(
+			errors.Params{
+				"in":     p.config.Address,
+				"mqType": p.Type(),
+				"err":    err})
+		logs.Error(err)
+		return
+	}
+
+	frames := make([][]byte, 0, len(envelope)+2)
+	frames = append(frames, envelope...)
+	frames = append(frames, NewZMQPacket(packet)...)
+
+	p.replies <- frames
+}
+
+func (p *EntranceZMQ) replySender(replyOut *zmq.Socket) {
+	for frames := range p.replies {
+		if _, err := replyOut.SendMessage(frames); err != nil {
+			logs.Error(err)
 		}
-		defer close(ch)
-		defer p.messenger.OnMessageEvent(id, MSG_EVENT_PROCESSED)
+	}
+}
 
-		// Wait for response from IN port
-		log.Infoln("Waiting for response: ", apiName, string(msg[1]))
-		var load *Payload
-		select {
-		case load = <-ch:
-			break
-		case <-time.Tick(REQ_TIMEOUT):
-			p.socket.SendMessage(newPacket([]byte("TIMEOUT")))
-			return
+// the envelope is the routing frames and the empty delimiter, REQ clients
+// always send the delimiter, DEALER clients might not
+func splitZmqEnvelope(frames [][]byte) (envelope [][]byte, packet [][]byte) {
+	for i, frame := range frames {
+		if len(frame) == 0 {
+			return frames[:i+1], frames[i+1:]
 		}
+	}
 
-		comMsg.Payload = load
-		rst, _ := comMsg.Serialize()
-		p.socket.SendMessage(newPacket(rst))
+	if len(frames) < 2 {
+		return nil, nil
 	}
+
+	return frames[:1], frames[1:]
 }
 
 func zmqSyncCall(endpoint string, request *ComponentMessage) (reply *ComponentMessage, err error) {
@@ -143,6 +344,8 @@ func zmqSyncCall(endpoint string, request *ComponentMessage) (reply *ComponentMe
 	if err != nil {
 		return nil, err
 	}
+	defer client.Close()
+
 	if err := client.Connect(endpoint); err != nil {
 		return nil, err
 	}
@@ -175,7 +378,9 @@ func zmqSyncCall(endpoint string, request *ComponentMessage) (reply *ComponentMe
 		}
 
 		rst := new(ComponentMessage)
-		rst.FromJson(ip[1])
+		if err := rst.FromJson(ip[1]); err != nil {
+			return nil, err
+		}
 		return rst, nil
 	}
 
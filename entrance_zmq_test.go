@@ -0,0 +1,153 @@
+package casper
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSplitZmqEnvelope(t *testing.T) {
+	tests := []struct {
+		name     string
+		frames   []string
+		envelope []string
+		packet   []string
+	}{
+		{"req", []string{"id", "", "h", "m"}, []string{"id", ""}, []string{"h", "m"}},
+		{"proxied", []string{"id1", "id2", "", "h", "m"}, []string{"id1", "id2", ""}, []string{"h", "m"}},
+		{"dealer", []string{"id", "h", "m"}, []string{"id"}, []string{"h", "m"}},
+		{"no packet", []string{"id"}, nil, nil},
+	}
+
+	frames := func(strs []string) (frames [][]byte) {
+		for _, s := range strs {
+			frames = append(frames, []byte(s))
+		}
+		return
+	}
+
+	for _, test := range tests {
+		envelope, packet := splitZmqEnvelope(frames(test.frames))
+		if !reflect.DeepEqual(envelope, frames(test.envelope)) || !reflect.DeepEqual(packet, frames(test.packet)) {
+			t.Errorf("%s: split into %q and %q", test.name, envelope, packet)
+		}
+	}
+}
+
+// sends the request of api to the entrance as a router does, without the
+// sockets
+func handleZMQTestRequest(t *testing.T, entrance *EntranceZMQ, identity string, api string) {
+	comMsg, _ := NewComponentMessage(nil, map[string]interface{}{"from": identity})
+	comMsg.Headers().Api = api
+
+	data, err := comMsg.Serialize()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	packet, _ := ParseZMQPacket(newPacket(data))
+	entrance.handleRequest([][]byte{[]byte(identity), nil}, packet)
+}
+
+// the replies sent back to the router, by the identity of the client
+func recvZMQTestReplies(t *testing.T, entrance *EntranceZMQ, n int) map[string]*ComponentMessage {
+	replies := map[string]*ComponentMessage{}
+	for i := 0; i < n; i++ {
+		select {
+		case frames := <-entrance.replies:
+			if len(frames) != 4 || len(frames[1]) != 0 {
+				t.Fatalf("the reply is not routed by the envelope: %q", frames)
+			}
+
+			packet, ok := ParseZMQPacket(frames[2:])
+			if !ok {
+				t.Fatalf("invalid reply packet: %q", frames)
+			}
+
+			comMsg := new(ComponentMessage)
+			if err := DecodePacket(packet, comMsg); err != nil {
+				t.Fatal(err)
+			}
+			replies[string(frames[0])] = comMsg
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%d replies are lost", n-i)
+		}
+	}
+	return replies
+}
+
+func TestZMQEntranceHandleRequests(t *testing.T) {
+	var locker sync.Mutex
+	inFlight, maxInFlight := 0, 0
+
+	messenger := newTestMessenger(func(graphName string, comMsg *ComponentMessage) *Payload {
+		if graphName == "slow" {
+			return nil
+		}
+
+		locker.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		locker.Unlock()
+
+		time.Sleep(50 * time.Millisecond)
+
+		locker.Lock()
+		inFlight--
+		locker.Unlock()
+
+		return echoReply(graphName, comMsg)
+	})
+
+	entrance := new(EntranceZMQ)
+	if err := entrance.Init(messenger, EntranceConfig{"address": "tcp://127.0.0.1:5999", "timeout": 200}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		identity string
+		api      string
+		code     uint64
+	}{
+		{"echo-1", "echo", 0},
+		{"echo-2", "echo", 0},
+		{"echo-3", "echo", 0},
+		{"echo-4", "echo", 0},
+		{"slow", "slow", 1029},
+		{"no-api", "", 404},
+		{"missing", testMissingGraph, 1003},
+	}
+
+	for _, test := range tests {
+		go handleZMQTestRequest(t, entrance, test.identity, test.api)
+	}
+
+	replies := recvZMQTestReplies(t, entrance, len(tests))
+	for _, test := range tests {
+		reply := replies[test.identity]
+		if reply == nil {
+			t.Errorf("%s: no reply", test.identity)
+		} else if reply.Payload.Code != test.code {
+			t.Errorf("%s: the code is %d, not %d: %s", test.identity, reply.Payload.Code, test.code, reply.Payload.Message)
+		} else if test.code == 0 {
+			var result map[string]interface{}
+			if err := reply.Payload.UnmarshalResult(&result); err != nil || result["from"] != test.identity {
+				t.Errorf("%s: the reply of another request: %v", test.identity, result)
+			}
+		}
+	}
+
+	if maxInFlight < 2 {
+		t.Error("the requests are not handled concurrently")
+	}
+
+	// the entrance still serves after a request timed out
+	go handleZMQTestRequest(t, entrance, "after", "echo")
+	if reply := recvZMQTestReplies(t, entrance, 1)["after"]; reply == nil || reply.Payload.Code != 0 {
+		t.Errorf("the request after the timeout failed: %+v", reply)
+	}
+}
@@ -39,4 +39,46 @@ var (
 	ERR_PARSE_COMMAND_TO_OBJECT_FAILED = errors.T(1023, "parse command {{.cmd}} error, raw error is: {{.err}}")
 	ERR_CONFIG_TO_OBJECT_FAILED        = errors.T(1024, "config to object failed, raw error is: {{.err}}")
 	ERR_MESSENGER_IS_NIL               = errors.T(1025, "messenger is nil, type: {{.type}}")
+
+	ERR_GRPC_LOAD_TLS_FAILED    = errors.T(1026, "load grpc tls credentials failed, cert file: {{.certFile}}, key file: {{.keyFile}}, raw error is: {{.err}}")
+	ERR_JSONRPC_INVALID_REQUEST = errors.T(1027, "invalid json-rpc request, raw error is: {{.err}}")
+	ERR_JSONRPC_INVALID_PARAMS  = errors.T(1028, "invalid json-rpc params of method {{.method}}, params should be object or array")
+	ERR_REQUEST_TIMEOUT         = errors.T(1029, "request timeout, id: {{.id}}")
+	ERR_ENTRANCE_BUSY           = errors.T(1030, "entrance {{.type}} is busy, max concurrency is {{.max}}")
+	ERR_CRON_SPEC_INVALID       = errors.T(1031, "cron spec of job {{.name}} is invalid, spec: {{.spec}}, raw error is: {{.err}}")
+	ERR_CRON_OVERLAP_INVALID    = errors.T(1032, "cron overlap of job {{.name}} is invalid: {{.overlap}}, it should be skip, queue or allow")
+	ERR_APP_NOT_EXIST           = errors.T(1033, "app not exist, name: {{.name}}")
+	ERR_HTTP_RESPONSE_INVALID   = errors.T(1034, "http response of {{.url}} is invalid, status: {{.status}}, raw error is: {{.err}}")
+	ERR_ASYNC_RESULT_NOT_EXIST  = errors.T(1035, "async result not exist or expired, id: {{.id}}")
+	ERR_ASYNC_CALLBACK_FAILED   = errors.T(1036, "async callback failed, id: {{.id}}, callback: {{.callback}}, raw error is: {{.err}}")
+
+	ERR_CODEC_NOT_EXIST              = errors.T(1037, "codec not exist: {{.codec}}")
+	ERR_ENVELOPE_VERSION_UNSUPPORTED = errors.T(1038, "envelope version {{.version}} of message {{.id}} is unsupported, min version is {{.min}}")
+	ERR_COMPRESSION_NOT_EXIST        = errors.T(1039, "compression not exist: {{.compression}}")
+	ERR_BLOB_STORE_FAILED            = errors.T(1040, "blob store {{.op}} {{.key}} failed, raw error is: {{.err}}")
+
+	ERR_REQUEST_BODY_TOO_LARGE   = errors.T(1041, "request body of {{.path}} is larger than {{.max}} bytes")
+	ERR_MESSAGE_TOO_LARGE        = errors.T(1042, "message is larger than {{.max}} bytes, at: {{.at}}")
+	ERR_TOO_MANY_CONTEXT_ENTRIES = errors.T(1043, "message {{.id}} has {{.size}} context entries, max is {{.max}}, at: {{.at}}")
+	ERR_TOO_MANY_COMMAND_ENTRIES = errors.T(1044, "message {{.id}} has {{.size}} command entries, max is {{.max}}, at: {{.at}}")
+
+	ERR_ENTRANCE_NOT_EXIST     = errors.T(1045, "entrance of {{.type}} not exist")
+	ERR_NEW_ENTRANCE_FAILED    = errors.T(1046, "create entrance of {{.type}} failed, raw error is: {{.err}}")
+	ERR_CONFIG_SECTION_INVALID = errors.T(1047, "config section {{.section}} should be an array")
+	ERR_CONFIG_INVALID         = errors.T(1048, "config is invalid, raw error is: {{.err}}")
+	ERR_CONFIG_ENV_NOT_SET     = errors.T(1049, "environment variable {{.name}} of config is not set")
+
+	ERR_CONFIG_DUPLICATE_NAME     = errors.T(1050, "name {{.name}} is duplicate, it is used at {{.at}}")
+	ERR_CONFIG_DUPLICATE_IN       = errors.T(1051, "in {{.in}} of {{.name}} is duplicate, it is used by {{.other}} at {{.at}}")
+	ERR_GRAPH_COMPONENT_NOT_EXIST = errors.T(1052, "component {{.component}} of graph {{.graph}} not exist")
+	ERR_GRAPH_IS_EMPTY            = errors.T(1053, "graph {{.name}} is empty")
+	ERR_MQ_TYPE_NOT_EXIST         = errors.T(1054, "mq type of {{.name}} not exist: {{.mqType}}")
+	ERR_ZMQ_URL_INVALID           = errors.T(1055, "zmq url {{.url}} is invalid, raw error is: {{.err}}")
+
+	ERR_CONFIG_WATCH_FAILED = errors.T(1056, "watch config files {{.files}} failed, raw error is: {{.err}}")
+	ERR_TAP_FAILED          = errors.T(1057, "tap {{.url}} failed, raw error is: {{.err}}")
+	ERR_RECORD_FAILED       = errors.T(1058, "record to {{.file}} failed, raw error is: {{.err}}")
+	ERR_GRPC_INVOKE_FAILED  = errors.T(1059, "grpc invoke failed, status: {{.status}}, raw error is: {{.err}}")
+
+	ERR_ASYNC_CALLBACK_NOT_ALLOWED = errors.T(1060, "async callback url {{.callback}} is not allowed")
 )
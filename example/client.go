@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gogap/casper/client"
+)
+
+func main() {
+	c := client.New(client.NewZMQTransport("tcp://127.0.0.1:5555", 8),
+		client.WithRetries(2, 100*time.Millisecond))
+	defer c.Close()
+
+	var resp struct {
+		Name string
+		Age  int
+	}
+
+	reply := client.Reply{}
+	err := c.Call(context.Background(), "demo", map[string]interface{}{"id": 1}, &resp,
+		client.WithHeader("X-Real-IP", "127.0.0.1"),
+		client.WithReply(&reply))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(reply.Id, resp.Name, resp.Age)
+}
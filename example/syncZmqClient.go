@@ -8,7 +8,7 @@ import (
 
 func main() {
 	msg, _ := casper.NewComponentMessage("", nil)
-	msg.Payload.SetContext(casper.REQ_X_API, "demo")
+	msg.Headers().Api = "demo"
 
 	reply, err := casper.CallService("zmq", "tcp://127.0.0.1:5555", msg)
 	if err != nil {
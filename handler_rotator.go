@@ -1,9 +1,7 @@
 package casper
 
 import (
-	"encoding/json"
 	"fmt"
-	"os"
 )
 
 type handler func(*Payload) (interface{}, error)
@@ -52,23 +50,10 @@ func (p *HandlerRotator) Rotate(name string) error {
 	return nil
 }
 
+// BuildHandlerRotatorConfig is LoadHandlerRotatorConfig, but panics on the
+// errors
 func BuildHandlerRotatorConfig(configPath string) {
-	var conf struct {
-		ComHandlers []struct {
-			Name    string `json:"component_name"`
-			Handler string `json:"handler"`
-		} `json:"handlers"`
-	}
-	r, err := os.Open(configPath)
-	if err != nil {
+	if err := LoadHandlerRotatorConfig(configPath); err != nil {
 		panic(err)
 	}
-	defer r.Close()
-
-	if err = json.NewDecoder(r).Decode(&conf); err != nil {
-		panic(err)
-	}
-	for _, v := range conf.ComHandlers {
-		rotatorConfig[v.Name] = v.Handler
-	}
 }
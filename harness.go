@@ -0,0 +1,46 @@
+package casper
+
+// CallHandler calls handler as the component does, without any mq, for the
+// tests of the handlers, the body and the context are encoded and decoded
+// by the codec, so the handler gets what it gets from the wire, e.g. the
+// numbers are json.Number
+//
+// the payload is returned for the commands the handler set, e.g. the http
+// headers and cookies
+func CallHandler(handler ComponentHandler, body interface{}, contexts map[string]interface{}) (result interface{}, payload *Payload, err error) {
+	var comMsg *ComponentMessage
+	if comMsg, err = NewComponentMessage(nil, body); err != nil {
+		return
+	}
+
+	for key, value := range contexts {
+		comMsg.Payload.SetContext(key, value)
+	}
+
+	if comMsg, err = codecRoundTrip(comMsg); err != nil {
+		return
+	}
+
+	payload = comMsg.Payload
+	if result, err = handler(payload); err != nil {
+		return
+	}
+
+	// the result is sent to the next component as well
+	comMsg.Payload.SetResult(result)
+	if comMsg, err = codecRoundTrip(comMsg); err != nil {
+		return
+	}
+	return comMsg.Payload.GetResult(), payload, nil
+}
+
+func codecRoundTrip(comMsg *ComponentMessage) (decoded *ComponentMessage, err error) {
+	var data []byte
+	if data, err = comMsg.Serialize(); err != nil {
+		return
+	}
+
+	decoded = new(ComponentMessage)
+	err = decoded.FromJson(data)
+	return
+}
@@ -0,0 +1,53 @@
+package casper
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCallHandler(t *testing.T) {
+	failed := errors.New("failed")
+
+	tests := []struct {
+		name     string
+		handler  ComponentHandler
+		body     interface{}
+		contexts map[string]interface{}
+		result   interface{}
+		err      error
+		commands componentCommands
+	}{
+		{"echo", func(payload *Payload) (interface{}, error) {
+			return payload.GetResult(), nil
+		}, map[string]interface{}{"n": 1, "s": "a"}, nil,
+			map[string]interface{}{"n": json.Number("1"), "s": "a"}, nil, nil},
+		{"struct", func(payload *Payload) (interface{}, error) {
+			return struct {
+				Id int64 `json:"id"`
+			}{1 << 62}, nil
+		}, nil, nil, map[string]interface{}{"id": json.Number("4611686018427387904")}, nil, nil},
+		{"context", func(payload *Payload) (interface{}, error) {
+			return payload.GetContextInt64("user_id")
+		}, nil, map[string]interface{}{"user_id": int64(1 << 62)}, json.Number("4611686018427387904"), nil, nil},
+		{"commands", func(payload *Payload) (interface{}, error) {
+			payload.AppendCommand("SET_HEADERS", map[string]interface{}{"name": "X-Id", "value": "1"})
+			return nil, nil
+		}, nil, nil, nil, nil, componentCommands{"SET_HEADERS": {map[string]interface{}{"name": "X-Id", "value": "1"}}}},
+		{"error", func(payload *Payload) (interface{}, error) {
+			return nil, failed
+		}, nil, nil, nil, failed, nil},
+	}
+
+	for _, test := range tests {
+		result, payload, err := CallHandler(test.handler, test.body, test.contexts)
+		if err != test.err {
+			t.Errorf("%s: expected the error %v, got %v", test.name, test.err, err)
+		} else if !reflect.DeepEqual(result, test.result) {
+			t.Errorf("%s: the result is %#v, not %#v", test.name, result, test.result)
+		} else if test.commands != nil && !reflect.DeepEqual(payload.command, test.commands) {
+			t.Errorf("%s: the commands are %#v, not %#v", test.name, payload.command, test.commands)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package casper
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gogap/errors"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+const (
+	DefaultMaxBodySize       = 8 * 1024 * 1024
+	DefaultMaxMessageSize    = 16 * 1024 * 1024
+	DefaultMaxContextEntries = 1024
+	DefaultMaxCommandEntries = 1024
+)
+
+// the errors of the limits, the http entrances respond 413 for them
+var limitErrorCodes = map[uint64]bool{
+	errorcode.ERR_REQUEST_BODY_TOO_LARGE.New().Code():   true,
+	errorcode.ERR_MESSAGE_TOO_LARGE.New().Code():        true,
+	errorcode.ERR_TOO_MANY_CONTEXT_ENTRIES.New().Code(): true,
+	errorcode.ERR_TOO_MANY_COMMAND_ENTRIES.New().Code(): true,
+}
+
+func isLimitExceeded(err error) bool {
+	if errors.IsErrCode(err) {
+		return limitErrorCodes[err.(errors.ErrCode).Code()]
+	}
+	return false
+}
+
+// the limit, or def if it is not set
+func limitOrDefault(limit, def int) int {
+	if limit <= 0 {
+		return def
+	}
+	return limit
+}
+
+func (p *ComponentMetadata) maxMessageSize() int {
+	return limitOrDefault(p.MaxMessageSize, DefaultMaxMessageSize)
+}
+
+// size is the bytes of the packet, both before and after decompression
+func (p *ComponentMetadata) checkMessageSize(size int) (err error) {
+	if max := p.maxMessageSize(); size > max {
+		err = errorcode.ERR_MESSAGE_TOO_LARGE.New(errors.Params{"max": max, "at": p.In})
+	}
+	return
+}
+
+func (p *ComponentMetadata) checkEntries(comMsg *ComponentMessage) (err error) {
+	if comMsg.Payload == nil {
+		return
+	}
+
+	if max := limitOrDefault(p.MaxContextEntries, DefaultMaxContextEntries); len(comMsg.Payload.context) > max {
+		err = errorcode.ERR_TOO_MANY_CONTEXT_ENTRIES.New(
+			errors.Params{"id": comMsg.Id, "size": len(comMsg.Payload.context), "max": max, "at": p.In})
+		return
+	}
+
+	if max := limitOrDefault(p.MaxCommandEntries, DefaultMaxCommandEntries); len(comMsg.Payload.command) > max {
+		err = errorcode.ERR_TOO_MANY_COMMAND_ENTRIES.New(
+			errors.Params{"id": comMsg.Id, "size": len(comMsg.Payload.command), "max": max, "at": p.In})
+		return
+	}
+	return
+}
+
+// readBody reads the request body, max <= 0 is DefaultMaxBodySize
+func readBody(r *http.Request, path string, max int64) (body []byte, err error) {
+	if max <= 0 {
+		max = DefaultMaxBodySize
+	}
+
+	if r.ContentLength > max {
+		err = errorcode.ERR_REQUEST_BODY_TOO_LARGE.New(errors.Params{"path": path, "max": max})
+		return
+	}
+
+	if body, err = ioutil.ReadAll(io.LimitReader(r.Body, max+1)); err != nil {
+		err = errorcode.ERR_BAD_REQUEST.New(errors.Params{"path": path, "err": err})
+		return
+	}
+
+	if int64(len(body)) > max {
+		err = errorcode.ERR_REQUEST_BODY_TOO_LARGE.New(errors.Params{"path": path, "max": max})
+		return
+	}
+	return
+}
+
+// readLimited reads all of r, it fails if there are more than max bytes
+func readLimited(r io.Reader, max int) (data []byte, err error) {
+	if data, err = ioutil.ReadAll(io.LimitReader(r, int64(max)+1)); err != nil {
+		return
+	}
+
+	if len(data) > max {
+		return nil, errorcode.ERR_MESSAGE_TOO_LARGE.New(errors.Params{"max": max, "at": "decompress"})
+	}
+	return
+}
@@ -0,0 +1,93 @@
+package casper
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gogap/errors"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+func errCodeOf(err error) uint64 {
+	if errors.IsErrCode(err) {
+		return err.(errors.ErrCode).Code()
+	}
+	return 0
+}
+
+func TestReadLimited(t *testing.T) {
+	tooLarge := errorcode.ERR_MESSAGE_TOO_LARGE.New().Code()
+
+	tests := []struct {
+		size, max int
+		code      uint64
+	}{
+		{0, 0, 0},
+		{1, 0, tooLarge},
+		{10, 10, 0},
+		{11, 10, tooLarge},
+		{1024, 64, tooLarge},
+	}
+
+	for _, test := range tests {
+		data, err := readLimited(bytes.NewReader(make([]byte, test.size)), test.max)
+		if code := errCodeOf(err); code != test.code {
+			t.Errorf("%d of %d: expected the error %d, got %v", test.size, test.max, test.code, err)
+		} else if err == nil && len(data) != test.size {
+			t.Errorf("%d of %d: read %d bytes", test.size, test.max, len(data))
+		}
+	}
+}
+
+func TestDecompressionBomb(t *testing.T) {
+	// a small packet expanding to a megabyte
+	message := make([]byte, 1024*1024)
+
+	for _, compression := range []string{"gzip", "zstd", "snappy"} {
+		packet := &Packet{Message: message}
+		if err := packet.Compress(compression, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		bomb := *packet
+		if err := bomb.Decompress(64 * 1024); errCodeOf(err) != errorcode.ERR_MESSAGE_TOO_LARGE.New().Code() {
+			t.Errorf("%s: %d bytes expanded over the max: %v", compression, len(packet.Message), err)
+		}
+
+		if err := packet.Decompress(len(message)); err != nil || len(packet.Message) != len(message) {
+			t.Errorf("%s: the message of the max is not decompressed: %v", compression, err)
+		}
+	}
+}
+
+func TestReadBody(t *testing.T) {
+	tooLarge := errorcode.ERR_REQUEST_BODY_TOO_LARGE.New().Code()
+
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		max           int64
+		code          uint64
+	}{
+		{"fit", `{"a": 1}`, 8, 8, 0},
+		{"content length", `{"a": 1}`, 8, 7, tooLarge},
+		{"no content length", `{"a": 1}`, -1, 7, tooLarge},
+		{"default", strings.Repeat("a", 1024), -1, 0, 0},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/api", strings.NewReader(test.body))
+		r.ContentLength = test.contentLength
+
+		body, err := readBody(r, "/api", test.max)
+		if code := errCodeOf(err); code != test.code {
+			t.Errorf("%s: expected the error %d, got %v", test.name, test.code, err)
+		} else if err == nil && string(body) != test.body {
+			t.Errorf("%s: read %q", test.name, body)
+		}
+	}
+}
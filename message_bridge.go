@@ -2,8 +2,10 @@ package casper
 
 import (
 	"strings"
+	"sync"
 
 	"github.com/gogap/errors"
+	"github.com/gogap/logs"
 
 	"github.com/gogap/casper/errorcode"
 )
@@ -18,15 +20,22 @@ type Messenger interface {
 	NewMessage(result interface{}) (msg *ComponentMessage, err error)
 	ReceiveMessage(msg *ComponentMessage) (err error)
 	SendMessage(graphName string, comMsg *ComponentMessage) (msgId string, ch chan *Payload, err error)
-	SendToComponent(compMetadata *ComponentMetadata, msg []byte) (total int, err error)
+	SendToComponent(compMetadata *ComponentMetadata, comMsg *ComponentMessage) (total int, err error)
 	OnMessageEvent(msgId string, event MessageEvent)
 }
 
 type MQChanMessenger struct {
-	graphs       Graphs
+	graphs       Graphs // replaced as a whole by SetGraphs, never modified
 	compMetadata *ComponentMetadata
 	mqCache      map[string]*EndPoint
 	requests     map[string]chan *Payload
+
+	mqLocker      sync.Mutex
+	requestLocker sync.RWMutex
+	graphsLocker  sync.RWMutex
+
+	blobs blobTracker
+	tap   *tapper
 }
 
 func NewMQChanMessenger(graphs Graphs, compMetadata ComponentMetadata) *MQChanMessenger {
@@ -45,7 +54,14 @@ func (p *MQChanMessenger) NewMessage(result interface{}) (msg *ComponentMessage,
 }
 
 func (p *MQChanMessenger) ReceiveMessage(msg *ComponentMessage) (err error) {
+	// the request might be timeout and removed, so keep it while sending
+	p.requestLocker.RLock()
+	defer p.requestLocker.RUnlock()
+
 	if ch, exist := p.requests[msg.Id]; !exist {
+		// nobody will read the result
+		deleteBlobs(msg.Payload.blobs)
+
 		bmsg, _ := msg.Serialize()
 		err = errorcode.ERR_MESSENGER_REQ_ID_NOT_EXIST.New(
 			errors.Params{
@@ -53,7 +69,13 @@ func (p *MQChanMessenger) ReceiveMessage(msg *ComponentMessage) (err error) {
 				"msg": string(bmsg)})
 		return
 	} else {
-		ch <- msg.Payload
+		p.blobs.track(msg.Id, msg.Payload.blobs)
+
+		select {
+		case ch <- msg.Payload:
+		default:
+			logs.Warn("drop the duplicate reply of request:", msg.Id)
+		}
 	}
 	return nil
 }
@@ -76,7 +98,7 @@ func (p *MQChanMessenger) SendMessage(graphName string, comMsg *ComponentMessage
 		}
 		com := GetComponentByName(graph[i])
 		if com == nil {
-			err = errorcode.ERR_COMPONENT_NOT_EXIST.New(errors.Params{"name": graphName})
+			err = errorcode.ERR_COMPONENT_NOT_EXIST.New(errors.Params{"name": graph[i]})
 			return
 		}
 		compConf := com.Metadata()
@@ -90,29 +112,56 @@ func (p *MQChanMessenger) SendMessage(graphName string, comMsg *ComponentMessage
 	ch = p.addRequest(comMsg.Id)
 
 	// Send Component message
-	var message []byte
-	if message, err = comMsg.Serialize(); err != nil {
-		err = errorcode.ERR_COMPONENT_MSG_SERIALIZE_FAILED.New(
-			errors.Params{
-				"in":     comMsg.entrance.In,
-				"mqType": comMsg.entrance.MQType,
-				"err":    err})
-		return
-	}
-
-	if _, err = p.SendToComponent(nextComp, message); err != nil {
+	if _, err = p.SendToComponent(nextComp, comMsg); err != nil {
+		p.OnMessageEvent(comMsg.Id, MSG_EVENT_PROCESSED)
 		return
 	}
 
 	return comMsg.Id, ch, nil
 }
 
-func (p *MQChanMessenger) SendToComponent(compMetadata *ComponentMetadata, msg []byte) (total int, err error) {
+// the message is encoded with the codec and the compression of the component,
+// it is not sent if it exceeds the limits of the component
+func (p *MQChanMessenger) SendToComponent(compMetadata *ComponentMetadata, comMsg *ComponentMessage) (total int, err error) {
 	if compMetadata == nil {
 		err = errorcode.ERR_COMPONENT_METADATA_IS_NIL.New()
 		return
 	}
 
+	if err = compMetadata.checkEntries(comMsg); err != nil {
+		return
+	}
+
+	if comMsg.Payload != nil {
+		if err = comMsg.Payload.offloadResult(); err != nil {
+			return
+		}
+	}
+
+	var packet *Packet
+	var encoded Packet // before compression, for the tap
+	if packet, err = EncodePacket(compMetadata.Codec, comMsg); err == nil {
+		encoded = *packet
+		err = packet.Compress(compMetadata.Compression, compMetadata.CompressThreshold)
+	}
+
+	if err != nil {
+		err = errorcode.ERR_COMPONENT_MSG_SERIALIZE_FAILED.New(
+			errors.Params{
+				"in":     compMetadata.In,
+				"mqType": compMetadata.MQType,
+				"err":    err})
+		return
+	}
+
+	if err = compMetadata.checkMessageSize(len(packet.Message)); err != nil {
+		return
+	}
+
+	// the zmq sockets are not thread safe
+	p.mqLocker.Lock()
+	defer p.mqLocker.Unlock()
+
 	if _, ok := p.mqCache[compMetadata.In]; ok == false {
 		mqtmp, err := NewMQ(compMetadata)
 		if err != nil {
@@ -125,7 +174,9 @@ func (p *MQChanMessenger) SendToComponent(compMetadata *ComponentMetadata, msg [
 			MessageQueue: mqtmp}
 	}
 
-	total, err = p.mqCache[compMetadata.In].SendToNext(msg)
+	if total, err = p.mqCache[compMetadata.In].SendToNext(packet); err == nil {
+		p.tap.publish(TAP_SENT, compMetadata, comMsg, &encoded)
+	}
 	return
 }
 
@@ -133,7 +184,11 @@ func (p *MQChanMessenger) OnMessageEvent(msgId string, event MessageEvent) {
 	switch event {
 	case MSG_EVENT_PROCESSED:
 		{
+			p.requestLocker.Lock()
 			delete(p.requests, msgId)
+			p.requestLocker.Unlock()
+
+			p.blobs.release(msgId)
 		}
 	}
 	return
@@ -145,14 +200,34 @@ func (p *MQChanMessenger) addRequest(msgId string) (ch chan *Payload) {
 		return nil
 	}
 
-	ch = make(chan *Payload)
+	// buffered, so the reply never blocks the component even if nobody waits
+	ch = make(chan *Payload, 1)
+
+	p.requestLocker.Lock()
 	p.requests[strMsgId] = ch
+	p.requestLocker.Unlock()
 
 	return
 }
 
+// Graphs are the graphs the new messages are sent by
+func (p *MQChanMessenger) Graphs() Graphs {
+	p.graphsLocker.RLock()
+	defer p.graphsLocker.RUnlock()
+
+	return p.graphs
+}
+
+// SetGraphs replaces the graphs, the messages already sent go on with the
+// components of the old ones
+func (p *MQChanMessenger) SetGraphs(graphs Graphs) {
+	p.graphsLocker.Lock()
+	p.graphs = graphs
+	p.graphsLocker.Unlock()
+}
+
 func (p *MQChanMessenger) GetGraph(name string) []string {
-	if g, ok := p.graphs[name]; ok {
+	if g, ok := p.Graphs()[name]; ok {
 		if len(g) >= 1 {
 			return g
 		}
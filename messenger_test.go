@@ -0,0 +1,88 @@
+package casper
+
+import (
+	"sync"
+
+	"github.com/gogap/errors"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+// the graph which testMessenger could not send to
+const testMissingGraph = "missing"
+
+// testMessenger replies by reply instead of sending the messages to the
+// components, a nil payload is never replied
+type testMessenger struct {
+	reply func(graphName string, comMsg *ComponentMessage) *Payload
+
+	locker    sync.Mutex
+	sent      []*ComponentMessage
+	processed map[string]bool
+}
+
+func newTestMessenger(reply func(graphName string, comMsg *ComponentMessage) *Payload) *testMessenger {
+	return &testMessenger{reply: reply, processed: make(map[string]bool)}
+}
+
+// the result of the payload is the request itself
+func echoReply(graphName string, comMsg *ComponentMessage) *Payload {
+	return testPayload(0, "OK", comMsg.Payload.GetResult())
+}
+
+func testPayload(code uint64, message string, result interface{}) *Payload {
+	return &Payload{Code: code, Message: message, result: result}
+}
+
+func (p *testMessenger) NewMessage(result interface{}) (*ComponentMessage, error) {
+	return NewComponentMessage(&ComponentMetadata{Name: "test.app", In: "test://app"}, result)
+}
+
+func (p *testMessenger) ReceiveMessage(msg *ComponentMessage) error {
+	return nil
+}
+
+func (p *testMessenger) SendMessage(graphName string, comMsg *ComponentMessage) (msgId string, ch chan *Payload, err error) {
+	if graphName == testMissingGraph {
+		err = errorcode.ERR_GRAPH_NOT_EXIST.New(errors.Params{"name": graphName})
+		return
+	}
+
+	p.locker.Lock()
+	p.sent = append(p.sent, comMsg)
+	p.locker.Unlock()
+
+	ch = make(chan *Payload, 1)
+	go func() {
+		payload := p.reply(graphName, comMsg)
+		if payload == nil {
+			return
+		}
+
+		// like the messenger, the reply of a processed request is dropped
+		p.locker.Lock()
+		defer p.locker.Unlock()
+		if !p.processed[comMsg.Id] {
+			ch <- payload
+		}
+	}()
+	return comMsg.Id, ch, nil
+}
+
+func (p *testMessenger) SendToComponent(compMetadata *ComponentMetadata, comMsg *ComponentMessage) (int, error) {
+	return 0, nil
+}
+
+func (p *testMessenger) OnMessageEvent(msgId string, event MessageEvent) {
+	if event == MSG_EVENT_PROCESSED {
+		p.locker.Lock()
+		p.processed[msgId] = true
+		p.locker.Unlock()
+	}
+}
+
+func (p *testMessenger) sentMessages() []*ComponentMessage {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	return append([]*ComponentMessage{}, p.sent...)
+}
@@ -8,15 +8,31 @@ import (
 
 var mqs map[string]mqType = make(map[string]mqType)
 
+// the checkers of the urls of the mq types, see checkMqUrl
+var mqUrlCheckers = make(map[string]func(string) error)
+
+// a message on the wire
+type Packet struct {
+	Codec       byte   // the codec, see Codec
+	Compression byte   // the compression, see Compressor
+	Message     []byte // the encoded ComponentMessage
+}
+
 // 消息接口
 type MessageQueue interface {
-	Ready() error                   // 初始化
-	RecvMessage() ([]byte, error)   // 读一条消息
-	SendToNext([]byte) (int, error) // 发送一条消息到下一节点
+	Ready() error                    // 初始化
+	RecvMessage() (*Packet, error)   // 读一条消息
+	SendToNext(*Packet) (int, error) // 发送一条消息到下一节点
 }
 
 type mqType func(string) MessageQueue
 
+// the mq types which drop the too large messages while receiving, NewMQ
+// sets the max message size of the component to them
+type messageSizeLimiter interface {
+	setMaxMessageSize(max int)
+}
+
 func registerMq(name string, one mqType) {
 	if one == nil {
 		panic("Register MQ nil")
@@ -27,6 +43,15 @@ func registerMq(name string, one mqType) {
 	mqs[name] = one
 }
 
+// checkMqUrl checks the url of the mq type, the mq types without checker
+// accept all the urls
+func checkMqUrl(mqType, url string) error {
+	if check, ok := mqUrlCheckers[mqType]; ok {
+		return check(url)
+	}
+	return nil
+}
+
 func NewMQ(compMeta *ComponentMetadata) (mq MessageQueue, err error) {
 
 	if compMeta == nil {
@@ -44,7 +69,11 @@ func NewMQ(compMeta *ComponentMetadata) (mq MessageQueue, err error) {
 	}
 
 	if newFun, ok := mqs[compMeta.MQType]; ok {
-		return newFun(compMeta.In), nil
+		mq = newFun(compMeta.In)
+		if limiter, ok := mq.(messageSizeLimiter); ok {
+			limiter.setMaxMessageSize(compMeta.maxMessageSize())
+		}
+		return mq, nil
 	}
 
 	err = errorcode.ERR_COULD_NOT_NEW_MSG_QUEUE.New(
@@ -1,6 +1,10 @@
 package casper
 
 import (
+	"net"
+	"strconv"
+	"strings"
+
 	"github.com/gogap/errors"
 	zmq "github.com/pebbe/zmq4"
 
@@ -10,16 +14,62 @@ import (
 const componentPacket byte = 0x01
 
 type mqZmq struct {
-	url    string
-	socket *zmq.Socket
+	url            string
+	socket         *zmq.Socket
+	maxMessageSize int
 }
 
 func init() {
 	registerMq("zmq", NewMqZmq)
+	mqUrlCheckers["zmq"] = checkZmqUrl
+}
+
+// checkZmqUrl checks the url is transport://endpoint, the endpoint of tcp
+// is host:port, the port could be * only for binding
+func checkZmqUrl(url string) (err error) {
+	invalid := func(reason string) error {
+		return errorcode.ERR_ZMQ_URL_INVALID.New(errors.Params{"url": url, "err": reason})
+	}
+
+	if url == "" {
+		return errorcode.ERR_ZMQ_URL_IS_EMPTY.New()
+	}
+
+	transport, endpoint := "", ""
+	if i := strings.Index(url, "://"); i > 0 {
+		transport, endpoint = url[:i], url[i+3:]
+	} else {
+		return invalid("it should be transport://endpoint")
+	}
+
+	switch transport {
+	case "tcp", "pgm", "epgm", "udp":
+		host, port, e := net.SplitHostPort(endpoint)
+		if e != nil {
+			return invalid(e.Error())
+		} else if host == "" {
+			return invalid("host is empty")
+		} else if port == "*" {
+			return
+		} else if n, e := strconv.Atoi(port); e != nil || n < 1 || n > 65535 {
+			return invalid("port " + port + " is invalid")
+		}
+	case "ipc", "inproc", "tipc", "vmci":
+		if endpoint == "" {
+			return invalid("endpoint is empty")
+		}
+	default:
+		return invalid("transport " + transport + " is unsupported")
+	}
+	return
 }
 
 func NewMqZmq(url string) MessageQueue {
-	return &mqZmq{url: url, socket: nil}
+	return &mqZmq{url: url, socket: nil, maxMessageSize: DefaultMaxMessageSize}
+}
+
+func (p *mqZmq) setMaxMessageSize(max int) {
+	p.maxMessageSize = max
 }
 
 func (p *mqZmq) Ready() (err error) {
@@ -27,11 +77,11 @@ func (p *mqZmq) Ready() (err error) {
 		err = errorcode.ERR_ZMQ_URL_IS_EMPTY.New()
 		return
 	}
-	p.socket, err = createZmqInputPort(p.url)
+	p.socket, err = createZmqInputPort(p.url, p.maxMessageSize)
 	return
 }
 
-func (p *mqZmq) RecvMessage() (msg []byte, err error) {
+func (p *mqZmq) RecvMessage() (packet *Packet, err error) {
 	var msgs [][]byte
 	if msgs, err = p.socket.RecvMessageBytes(0); err != nil {
 		err = errorcode.ERR_ZMQ_RECV_MSG_FAILED.New(
@@ -42,17 +92,18 @@ func (p *mqZmq) RecvMessage() (msg []byte, err error) {
 		return nil, err
 	}
 
-	if !isValidPacket(msgs) {
+	ok := false
+	if packet, ok = ParseZMQPacket(msgs); !ok {
 		err = errorcode.ERR_ZMQ_RECV_MSG_FAILED.New(
 			errors.Params{"url": p.url})
 
 		return nil, err
 	}
 
-	return msgs[1], nil
+	return packet, nil
 }
 
-func (p *mqZmq) SendToNext(msg []byte) (total int, err error) {
+func (p *mqZmq) SendToNext(packet *Packet) (total int, err error) {
 	if p.socket == nil {
 		p.socket, err = createZmqOutputPort(p.url)
 		if err != nil {
@@ -60,12 +111,12 @@ func (p *mqZmq) SendToNext(msg []byte) (total int, err error) {
 		}
 	}
 
-	packet := newPacket(msg)
-	return p.socket.SendMessage(packet)
+	return p.socket.SendMessage(NewZMQPacket(packet))
 }
 
-// Create a ZMQ PULL socket & bind to a given endpoint
-func createZmqInputPort(url string) (socket *zmq.Socket, err error) {
+// Create a ZMQ PULL socket & bind to a given endpoint, the frames larger
+// than maxMessageSize are dropped by zmq
+func createZmqInputPort(url string, maxMessageSize int) (socket *zmq.Socket, err error) {
 	if socket, err = zmq.NewSocket(zmq.PULL); err != nil {
 		err = errorcode.ERR_NEW_ZMQ_FAILED.New(
 			errors.Params{
@@ -76,6 +127,17 @@ func createZmqInputPort(url string) (socket *zmq.Socket, err error) {
 		return nil, err
 	}
 
+	if err = socket.SetMaxmsgsize(int64(maxMessageSize)); err != nil {
+		socket.Close()
+		err = errorcode.ERR_NEW_ZMQ_FAILED.New(
+			errors.Params{
+				"url":  url,
+				"type": "PULL",
+				"err":  err})
+
+		return nil, err
+	}
+
 	if err = socket.Bind(url); err != nil {
 		err = errorcode.ERR_ZMQ_COULD_NOT_BIND_URL.New(
 			errors.Params{
@@ -113,13 +175,41 @@ func createZmqOutputPort(url string) (socket *zmq.Socket, err error) {
 	return socket, nil
 }
 
+// the header frame is componentPacket, the codec id and the compression
+// id, the ids are omitted if they are json and none, so the old versions
+// could still read it
+func NewZMQPacket(packet *Packet) [][]byte {
+	if packet.Compression != COMPRESSION_NONE {
+		return [][]byte{[]byte{componentPacket, packet.Codec, packet.Compression}, packet.Message}
+	}
+	if packet.Codec == CODEC_JSON {
+		return newPacket(packet.Message)
+	}
+	return [][]byte{[]byte{componentPacket, packet.Codec}, packet.Message}
+}
+
+func ParseZMQPacket(frames [][]byte) (packet *Packet, ok bool) {
+	if !isValidPacket(frames) {
+		return nil, false
+	}
+
+	packet = &Packet{Codec: CODEC_JSON, Message: frames[1]}
+	if len(frames[0]) > 1 {
+		packet.Codec = frames[0][1]
+	}
+	if len(frames[0]) > 2 {
+		packet.Compression = frames[0][2]
+	}
+	return packet, true
+}
+
 func newPacket(msg []byte) [][]byte {
 	return [][]byte{[]byte{componentPacket}, msg}
 }
 
 func isValidPacket(msg interface{}) bool {
 	if msgb, ok := msg.([][]byte); ok {
-		if len(msgb[0]) == 1 && msgb[0][0] == componentPacket {
+		if len(msgb) == 2 && len(msgb[0]) >= 1 && msgb[0][0] == componentPacket {
 			return true
 		}
 	}
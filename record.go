@@ -0,0 +1,193 @@
+package casper
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogap/errors"
+	"github.com/gogap/logs"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+// the values of the redacted keys
+const REDACTED = "[REDACTED]"
+
+// a recorded request and its reply, one per line
+type Recording struct {
+	At       time.Time       `json:"at"`
+	Entrance string          `json:"entrance"`
+	Api      string          `json:"api"`
+	Request  json.RawMessage `json:"request,omitempty"` // the ComponentMessage, see ComponentMessage.Serialize, none if the request is rejected before the message is made
+	Async    bool            `json:"async,omitempty"`   // the reply is the pending one of the async invoker
+	Reply    RecordedReply   `json:"reply"`
+	Elapsed  int64           `json:"elapsed"` // millisecond
+}
+
+type RecordedReply struct {
+	Code    uint64          `json:"code"`
+	Message string          `json:"message"`
+	Result  json.RawMessage `json:"result,omitempty"`
+}
+
+// the request, the body is the result of the payload
+func (p *Recording) Message() (msg *ComponentMessage, err error) {
+	msg = new(ComponentMessage)
+	if err = msg.FromJson(p.Request); err != nil {
+		return nil, err
+	}
+	if msg.Payload == nil {
+		msg.Payload = &Payload{}
+	}
+	return
+}
+
+type EntranceRecordConf struct {
+	File   string   `json:"file"`   // the recordings are appended to it, as json lines
+	Redact []string `json:"redact"` // the keys of the context, the headers, the cookies, the bodies and the results, case insensitive
+}
+
+// Recorder writes the requests of an entrance and their final replies to
+// a file, the values of the redacted keys are replaced at any depth
+type Recorder struct {
+	file   string
+	redact map[string]bool
+	locker sync.Mutex
+	f      *os.File
+}
+
+func NewRecorder(conf EntranceRecordConf) (recorder *Recorder, err error) {
+	var f *os.File
+	if f, err = os.OpenFile(conf.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600); err != nil {
+		err = errorcode.ERR_RECORD_FAILED.New(errors.Params{"file": conf.File, "err": err})
+		return
+	}
+
+	recorder = &Recorder{file: conf.File, redact: map[string]bool{}, f: f}
+	for _, key := range conf.Redact {
+		recorder.redact[strings.ToLower(key)] = true
+	}
+
+	logs.Info("recording requests to:", conf.File)
+	return
+}
+
+// Close closes the file, the recordings after it are dropped, nil and the
+// closed ones do nothing
+func (p *Recorder) Close() (err error) {
+	if p == nil {
+		return
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.f != nil {
+		err = p.f.Close()
+		p.f = nil
+	}
+	return
+}
+
+// begin starts the recording once the request is received, nil records
+// nothing
+func (p *Recorder) begin(entrance, api string) (recording *Recording) {
+	if p == nil {
+		return nil
+	}
+	return &Recording{At: time.Now(), Entrance: entrance, Api: api}
+}
+
+// request keeps the message before it is sent, the message is changed on
+// the way, the recording is dropped if the message could not be kept
+func (p *Recorder) request(recording *Recording, comMsg *ComponentMessage) *Recording {
+	if p == nil || recording == nil {
+		return nil
+	}
+
+	var err error
+	if recording.Request, err = comMsg.Serialize(); err == nil {
+		recording.Request, err = p.redactJson(recording.Request)
+	}
+
+	if err != nil {
+		logs.Error(errorcode.ERR_RECORD_FAILED.New(errors.Params{"file": p.file, "err": err}))
+		return nil
+	}
+	return recording
+}
+
+func (p *Recorder) finish(recording *Recording, code uint64, message string, result interface{}) {
+	if p == nil || recording == nil {
+		return
+	}
+
+	recording.Elapsed = int64(time.Since(recording.At) / time.Millisecond)
+	recording.Reply = RecordedReply{Code: code, Message: message}
+
+	err := p.write(recording, result)
+	if err != nil {
+		logs.Error(errorcode.ERR_RECORD_FAILED.New(errors.Params{"file": p.file, "err": err}))
+	}
+}
+
+func (p *Recorder) write(recording *Recording, result interface{}) (err error) {
+	if result != nil {
+		if recording.Reply.Result, err = json.Marshal(result); err != nil {
+			return
+		}
+		if recording.Reply.Result, err = p.redactJson(recording.Reply.Result); err != nil {
+			return
+		}
+	}
+
+	var line []byte
+	if line, err = json.Marshal(recording); err != nil {
+		return
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.f == nil {
+		return os.ErrClosed
+	}
+	_, err = p.f.Write(append(line, '\n'))
+	return
+}
+
+func (p *Recorder) redactJson(data []byte) ([]byte, error) {
+	if len(p.redact) == 0 {
+		return data, nil
+	}
+
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(p.redactValue(v))
+}
+
+func (p *Recorder) redactValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, item := range value {
+			if p.redact[strings.ToLower(key)] {
+				value[key] = REDACTED
+			} else {
+				value[key] = p.redactValue(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = p.redactValue(item)
+		}
+	}
+	return v
+}
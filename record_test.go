@@ -0,0 +1,89 @@
+package casper
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecordFailedRequests(t *testing.T) {
+	file := t.TempDir() + "/record.jsonl"
+
+	entrance := new(EntranceMartini)
+	messenger := NewMQChanMessenger(Graphs{"g": {"record.missing"}}, ComponentMetadata{Name: "record.app", In: "tcp://127.0.0.1:5001"})
+	if err := entrance.Init(messenger, EntranceConfig{
+		"path":          "/api",
+		"max_body_size": 64,
+		"async":         map[string]interface{}{"enabled": true},
+		"record":        map[string]interface{}{"file": file}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		api     string
+		body    string
+		headers map[string]string
+		code    uint64
+		request bool // the message is recorded
+		async   bool
+	}{
+		// the component of the graph does not exist, so the message is not sent
+		{"not sent", "g", `{"hello": "record"}`, nil, http.StatusInternalServerError, true, false},
+		{"no api", "", `{}`, nil, http.StatusNotFound, false, false},
+		{"too large", "g", `{"hello": "` + strings.Repeat("a", 64) + `"}`, nil, http.StatusRequestEntityTooLarge, false, false},
+		{"not json", "g", `hello`, nil, http.StatusBadRequest, false, false},
+		{"callback not allowed", "g", `{}`, map[string]string{"X-Async": "true", "X-Callback-Url": "http://127.0.0.1/callback"}, 1060, true, true},
+		{"async not sent", "g", `{}`, map[string]string{"X-Async": "true"}, http.StatusInternalServerError, true, true},
+	}
+
+	r := func(api, body string, headers map[string]string) *http.Request {
+		r := httptest.NewRequest("POST", "/api", strings.NewReader(body))
+		if api != "" {
+			r.Header.Set(DefaultAPIHeader, api)
+		}
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		return r
+	}
+
+	for _, test := range tests {
+		entrance.postHandler()(httptest.NewRecorder(), r(test.api, test.body, test.headers))
+	}
+
+	// the app stops its entrance
+	if err := (&App{Entrance: entrance}).Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != len(tests) {
+		t.Fatalf("expected %d recordings, got %q", len(tests), data)
+	}
+
+	for i, test := range tests {
+		recording := Recording{}
+		if err = json.Unmarshal([]byte(lines[i]), &recording); err != nil {
+			t.Fatal(err)
+		}
+
+		if recording.Api != test.api || recording.Reply.Code != test.code || recording.Async != test.async || (len(recording.Request) > 0) != test.request {
+			t.Errorf("%s: unexpected recording: %s", test.name, lines[i])
+		}
+	}
+
+	// closed by Stop, the later ones are dropped
+	entrance.postHandler()(httptest.NewRecorder(), r("g", `{}`, nil))
+	if data, _ = ioutil.ReadFile(file); len(strings.Split(strings.TrimSpace(string(data)), "\n")) != len(tests) {
+		t.Fatalf("recorded after the entrance stopped: %q", data)
+	}
+}
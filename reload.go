@@ -0,0 +1,310 @@
+package casper
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gogap/errors"
+	"github.com/gogap/logs"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+// the editors write a file several times, the changes in it are reloaded once
+const configReloadDelay = 500 * time.Millisecond
+
+type graphsSetter interface {
+	Graphs() Graphs
+	SetGraphs(graphs Graphs)
+}
+
+// the file sets being watched, by the absolute paths, one watcher and one
+// SIGHUP handler for each
+var (
+	configWatches       = make(map[string]bool)
+	configWatchesLocker sync.Mutex
+)
+
+// WatchConfig reloads the components and the apps of the config files when
+// they change, or on SIGHUP, the files are loaded as LoadConfigs, if they
+// are invalid the old config is kept, see ReloadConfig
+//
+// LoadApps does not watch the files, the processes which want it call it
+// once after the apps are loaded, stop ends the watching and gives SIGHUP
+// back to its default
+func WatchConfig(filePaths ...string) (stop func(), err error) {
+	files := map[string]bool{}
+	absPaths := make([]string, 0, len(filePaths))
+	for _, filePath := range filePaths {
+		file, e := filepath.Abs(filePath)
+		if e != nil {
+			return nil, errorcode.ERR_CONFIG_WATCH_FAILED.New(errors.Params{"files": filePaths, "err": e})
+		}
+		files[file] = true
+		absPaths = append(absPaths, file)
+	}
+	key := strings.Join(absPaths, "\n")
+
+	configWatchesLocker.Lock()
+	defer configWatchesLocker.Unlock()
+
+	if configWatches[key] {
+		return nil, errorcode.ERR_CONFIG_WATCH_FAILED.New(errors.Params{"files": filePaths, "err": "the files are already watched"})
+	}
+
+	var watcher *fsnotify.Watcher
+	if watcher, err = fsnotify.NewWatcher(); err != nil {
+		return nil, errorcode.ERR_CONFIG_WATCH_FAILED.New(errors.Params{"files": filePaths, "err": err})
+	}
+
+	// the directories are watched, the files might be replaced by renaming
+	for file := range files {
+		if e := watcher.Add(filepath.Dir(file)); e != nil {
+			watcher.Close()
+			return nil, errorcode.ERR_CONFIG_WATCH_FAILED.New(errors.Params{"files": filePaths, "err": e})
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	done := make(chan bool)
+	go watchConfig(watcher, hup, done, files, filePaths)
+
+	configWatches[key] = true
+	logs.Info("watching config:", filePaths)
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			signal.Stop(hup)
+			close(done)
+			watcher.Close()
+
+			configWatchesLocker.Lock()
+			delete(configWatches, key)
+			configWatchesLocker.Unlock()
+
+			logs.Info("stop watching config:", filePaths)
+		})
+	}
+	return
+}
+
+func watchConfig(watcher *fsnotify.Watcher, hup chan os.Signal, done chan bool, files map[string]bool, filePaths []string) {
+	delay := time.NewTimer(configReloadDelay)
+	delay.Stop()
+	defer delay.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if files[filepath.Clean(event.Name)] && !event.Has(fsnotify.Chmod) {
+				delay.Reset(configReloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logs.Error(errorcode.ERR_CONFIG_WATCH_FAILED.New(errors.Params{"files": filePaths, "err": err}))
+		case <-hup:
+			logs.Info("reload config on SIGHUP:", filePaths)
+			reloadConfigFiles(filePaths)
+		case <-delay.C:
+			logs.Info("reload config on change:", filePaths)
+			reloadConfigFiles(filePaths)
+		}
+	}
+}
+
+func reloadConfigFiles(filePaths []string) {
+	conf, err := LoadConfigs(filePaths...)
+	if err != nil {
+		logs.Error("reload config", filePaths, "failed, the old one is kept:", err)
+		return
+	}
+
+	if err = ReloadConfig(conf); err != nil {
+		logs.Error("reload config", filePaths, "failed, the apps failed keep the old ones:", err)
+	}
+}
+
+// ReloadConfig reloads the components of conf once, and then the apps of
+// conf which are loaded, see Reload, the apps which could not be reloaded
+// keep the old ones, the errors of them are returned together
+func ReloadConfig(conf *CasperConfigs) (err error) {
+	changes := reloadComponents(conf.Components)
+
+	// the apps failed are reported together, the others are still reloaded
+	var errs ConfigErrors
+	for i := range conf.Apps {
+		app := GetAppByName(conf.Apps[i].Name)
+		if app == nil {
+			changes = append(changes, fmt.Sprintf("app %s is not loaded, it requires a restart", conf.Apps[i].Name))
+			continue
+		}
+
+		appChanges, e := app.reload(conf.Apps[i])
+		if e != nil {
+			errs = append(errs, conf.appError(i, e))
+			continue
+		}
+		changes = append(changes, appChanges...)
+	}
+
+	logReloadChanges("config", changes)
+	return errs.errOrNil()
+}
+
+// Reload swaps the graphs of the app and the metadata of the components with
+// the ones of conf, the messages already sent go on with the old ones, what
+// is changed is logged
+//
+// the components are added or replaced, but never removed, the running ones,
+// the entrance and the app itself require a restart to be changed
+func (p *App) Reload(conf *CasperConfigs) (err error) {
+	var appConf *AppConfig
+	for i := range conf.Apps {
+		if conf.Apps[i].Name == p.Name {
+			appConf = &conf.Apps[i]
+		}
+	}
+
+	if appConf == nil {
+		return errorcode.ERR_APP_NOT_EXIST.New(errors.Params{"name": p.Name})
+	}
+
+	changes := reloadComponents(conf.Components)
+
+	// the components are reloaded even if the app is not
+	appChanges, err := p.reload(*appConf)
+	logReloadChanges("app "+p.Name, append(changes, appChanges...))
+	return
+}
+
+// the components must be reloaded before, the graphs use them
+func (p *App) reload(appConf AppConfig) (changes []string, err error) {
+	p.reloadLocker.Lock()
+	defer p.reloadLocker.Unlock()
+
+	setter, ok := p.messenger.(graphsSetter)
+	if !ok {
+		return nil, errorcode.ERR_CONFIG_INVALID.New(errors.Params{"err": "the graphs of the messenger could not be reloaded"})
+	}
+
+	if diff := diffConfig(p.conf.ComponentConfig(), appConf.ComponentConfig()); diff != "" {
+		changes = append(changes, fmt.Sprintf("app %s changed, it requires a restart: %s", p.Name, diff))
+	}
+	if !reflect.DeepEqual(p.conf.Entrance, appConf.Entrance) {
+		changes = append(changes, fmt.Sprintf("entrance of app %s changed, it requires a restart", p.Name))
+	}
+
+	changes = append(changes, diffGraphs(setter.Graphs(), appConf.Graphs)...)
+
+	setter.SetGraphs(appConf.Graphs)
+	p.conf.Graphs = appConf.Graphs
+	return
+}
+
+func logReloadChanges(what string, changes []string) {
+	if len(changes) == 0 {
+		logs.Info(what, "reloaded, nothing changed")
+		return
+	}
+	logs.Info(fmt.Sprintf("%s reloaded, %d changes:\n\t%s", what, len(changes), strings.Join(changes, "\n\t")))
+}
+
+// the changed components are replaced, the messages use the copies of the
+// metadata, so they are not affected
+func reloadComponents(confs []ComponentConfig) (changes []string) {
+	componentsLocker.Lock()
+	defer componentsLocker.Unlock()
+
+	for _, conf := range confs {
+		old, exist := components[conf.Name]
+
+		diff := ""
+		if exist {
+			if diff = diffConfig(old.GetComponentConfig(), conf); diff == "" {
+				continue
+			} else if old.running {
+				changes = append(changes, fmt.Sprintf("component %s changed, it requires a restart: %s", conf.Name, diff))
+				continue
+			}
+		}
+
+		component, err := newComponent(conf, NewMQChanMessenger(nil, conf.Metadata()))
+		if err != nil {
+			changes = append(changes, fmt.Sprintf("component %s could not be reloaded: %v", conf.Name, err))
+			continue
+		}
+
+		if exist {
+			component.handler = old.handler
+			changes = append(changes, fmt.Sprintf("component %s changed: %s", conf.Name, diff))
+		} else {
+			changes = append(changes, fmt.Sprintf("component %s added", conf.Name))
+		}
+		components[conf.Name] = component
+	}
+	return
+}
+
+// the fields of the json tags, e.g. in: tcp://127.0.0.1:5001 -> tcp://127.0.0.1:5002
+func diffConfig(old, new ComponentConfig) string {
+	var diffs []string
+
+	oldValue, newValue := reflect.ValueOf(old), reflect.ValueOf(new)
+	for i := 0; i < oldValue.NumField(); i++ {
+		a, b := oldValue.Field(i).Interface(), newValue.Field(i).Interface()
+		if a != b {
+			name := strings.Split(oldValue.Type().Field(i).Tag.Get("json"), ",")[0]
+			diffs = append(diffs, fmt.Sprintf("%s: %v -> %v", name, a, b))
+		}
+	}
+	return strings.Join(diffs, ", ")
+}
+
+func diffGraphs(old, new Graphs) (changes []string) {
+	names := map[string]bool{}
+	for name := range old {
+		names[name] = true
+	}
+	for name := range new {
+		names[name] = true
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		oldGraph, oldExist := old[name]
+		newGraph, newExist := new[name]
+		switch {
+		case !oldExist:
+			changes = append(changes, fmt.Sprintf("graph %s added: %v", name, newGraph))
+		case !newExist:
+			changes = append(changes, fmt.Sprintf("graph %s removed", name))
+		case !reflect.DeepEqual(oldGraph, newGraph):
+			changes = append(changes, fmt.Sprintf("graph %s changed: %v -> %v", name, oldGraph, newGraph))
+		}
+	}
+	return
+}
@@ -0,0 +1,210 @@
+package casper
+
+import (
+	"testing"
+	"time"
+)
+
+// the packets sent to the memory mq, by the url
+type memoryPacket struct {
+	url    string
+	packet *Packet
+}
+
+var memoryPackets = make(chan memoryPacket, 64)
+
+type memoryMq struct {
+	url string
+}
+
+func init() {
+	registerMq("memory", func(url string) MessageQueue { return &memoryMq{url: url} })
+}
+
+func (p *memoryMq) Ready() error {
+	return nil
+}
+
+func (p *memoryMq) RecvMessage() (*Packet, error) {
+	select {}
+}
+
+func (p *memoryMq) SendToNext(packet *Packet) (int, error) {
+	memoryPackets <- memoryPacket{url: p.url, packet: packet}
+	return len(packet.Message), nil
+}
+
+// the message sent to url, it fails if it is sent to the others
+func receiveMemoryPacket(t *testing.T, url string) *ComponentMessage {
+	select {
+	case sent := <-memoryPackets:
+		if sent.url != url {
+			t.Fatalf("the message is sent to %s, not %s", sent.url, url)
+		}
+
+		comMsg := new(ComponentMessage)
+		if err := DecodePacket(sent.packet, comMsg); err != nil {
+			t.Fatal(err)
+		}
+		return comMsg
+	case <-time.After(time.Second):
+		t.Fatalf("nothing is sent to %s", url)
+	}
+	return nil
+}
+
+func graphIns(comMsg *ComponentMessage) (ins []string) {
+	for _, meta := range comMsg.graph {
+		ins = append(ins, meta.In)
+	}
+	return
+}
+
+func TestAppReload(t *testing.T) {
+	comps := []ComponentConfig{
+		{Name: "reload.a", MQType: "memory", In: "memory://a"},
+		{Name: "reload.b", MQType: "memory", In: "memory://b"},
+	}
+	for _, conf := range comps {
+		if _, err := NewComponent(conf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	appConf := AppConfig{
+		Name:     "reload.app",
+		MQType:   "memory",
+		In:       "memory://app",
+		Entrance: EntranceOptions{Type: "stdio"},
+		Graphs:   Graphs{"g": {"reload.a", "reload.b"}}}
+
+	app, err := NewApp(appConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// in flight while reloading
+	inFlight, _ := app.messenger.NewMessage(map[string]interface{}{"n": 1})
+	_, ch, err := app.messenger.SendMessage("g", inFlight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inFlight = receiveMemoryPacket(t, "memory://a")
+
+	newAppConf := appConf
+	newAppConf.Graphs = Graphs{"g": {"reload.a", "reload.c"}, "h": {"reload.b"}}
+
+	conf := &CasperConfigs{
+		Apps: []AppConfig{newAppConf},
+		Components: []ComponentConfig{
+			comps[0],
+			{Name: "reload.b", MQType: "memory", In: "memory://b2"},
+			{Name: "reload.c", MQType: "memory", In: "memory://c"},
+		}}
+
+	if err = app.Reload(conf); err != nil {
+		t.Fatal(err)
+	}
+
+	if graphs := app.messenger.(graphsSetter).Graphs(); len(graphs) != 2 || len(graphs["h"]) != 1 {
+		t.Fatalf("the graphs are not swapped: %v", graphs)
+	}
+	if in := GetComponentByName("reload.b").Metadata().In; in != "memory://b2" {
+		t.Fatalf("reload.b is not reloaded, its in is %s", in)
+	}
+
+	// the message already sent goes on with the old graph and the old
+	// metadata, and its reply still reaches the request
+	if ins := graphIns(inFlight); len(ins) != 2 || ins[1] != "memory://b" {
+		t.Fatalf("the graph of the message in flight is changed: %v", ins)
+	}
+
+	if err = app.messenger.ReceiveMessage(inFlight); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("the reply of the message in flight is lost")
+	}
+
+	// the new messages are sent by the new graphs
+	comMsg, _ := app.messenger.NewMessage(map[string]interface{}{"n": 2})
+	if _, _, err = app.messenger.SendMessage("g", comMsg); err != nil {
+		t.Fatal(err)
+	}
+	if ins := graphIns(receiveMemoryPacket(t, "memory://a")); len(ins) != 2 || ins[1] != "memory://c" {
+		t.Fatalf("the new message is not sent by the new graph: %v", ins)
+	}
+
+	comMsg, _ = app.messenger.NewMessage(map[string]interface{}{"n": 3})
+	if _, _, err = app.messenger.SendMessage("h", comMsg); err != nil {
+		t.Fatal(err)
+	}
+	receiveMemoryPacket(t, "memory://b2")
+
+	// the app of another name is not reloaded
+	conf.Apps[0].Name = "reload.other"
+	if err = app.Reload(conf); err == nil {
+		t.Fatal("the config without the app is reloaded")
+	}
+}
+
+func TestReloadConfigErrors(t *testing.T) {
+	// the graphs of its messenger could not be reloaded
+	apps["reload.broken"] = &App{Component: Component{Name: "reload.broken"}, messenger: newTestMessenger(nil)}
+	defer delete(apps, "reload.broken")
+
+	appConf := AppConfig{
+		Name:     "reload.ok",
+		MQType:   "memory",
+		In:       "memory://ok",
+		Entrance: EntranceOptions{Type: "stdio"},
+		Graphs:   Graphs{"g": {"self"}}}
+
+	app, err := NewApp(appConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newAppConf := appConf
+	newAppConf.Graphs = Graphs{"g": {"self"}, "h": {"reload.d"}}
+
+	conf := &CasperConfigs{
+		Apps:       []AppConfig{{Name: "reload.broken"}, newAppConf},
+		Components: []ComponentConfig{{Name: "reload.d", MQType: "memory", In: "memory://d"}}}
+
+	err = ReloadConfig(conf)
+	if errs, ok := err.(ConfigErrors); !ok || len(errs) != 1 {
+		t.Fatalf("expected the error of reload.broken, got %v", err)
+	}
+
+	// the others are still reloaded
+	if GetComponentByName("reload.d") == nil {
+		t.Error("the component is not reloaded")
+	}
+	if graphs := app.messenger.(graphsSetter).Graphs(); len(graphs) != 2 {
+		t.Errorf("the app after the failed one is not reloaded: %v", graphs)
+	}
+}
+
+func TestWatchConfigOnce(t *testing.T) {
+	file := t.TempDir() + "/casper.json"
+
+	stop, err := WatchConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = WatchConfig(file); err == nil {
+		t.Fatal("the files are watched twice")
+	}
+
+	stop()
+	stop()
+
+	if stop, err = WatchConfig(file); err != nil {
+		t.Fatal("the files could not be watched again after stop:", err)
+	}
+	stop()
+}
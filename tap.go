@@ -0,0 +1,242 @@
+package casper
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogap/errors"
+	"github.com/gogap/logs"
+	zmq "github.com/pebbe/zmq4"
+
+	"github.com/gogap/casper/errorcode"
+)
+
+const (
+	TAP_RECEIVED = "received" // the component received the message
+	TAP_SENT     = "sent"     // the component sent the message to the next one
+
+	// the events waiting for the zmq tap, the later ones are dropped
+	tapQueueSize = 1024
+)
+
+// a message seen by a tap
+type TapEvent struct {
+	Component string          `json:"component"`
+	In        string          `json:"in"`
+	Direction string          `json:"direction"`    // TAP_RECEIVED or TAP_SENT
+	To        string          `json:"to,omitempty"` // the in of the next one, if it is sent
+	At        time.Time       `json:"at"`
+	Id        string          `json:"id"`
+	Api       string          `json:"api,omitempty"`
+	Code      uint64          `json:"code"`
+	Message   json.RawMessage `json:"message"` // the ComponentMessage, see LoadMessage
+
+	packet *Packet // the encoded message, not compressed
+}
+
+// LoadMessage fills Message as ComponentMessage.Serialize, the message is
+// not serialized while it is published, the taps which need it call this
+// out of the way of the messages
+func (p *TapEvent) LoadMessage() (message json.RawMessage, err error) {
+	if p.Message != nil || p.packet == nil {
+		return p.Message, nil
+	}
+
+	// the json packets are what Serialize returns
+	if p.packet.Codec == CODEC_JSON {
+		p.Message = p.packet.Message
+		return p.Message, nil
+	}
+
+	comMsg := new(ComponentMessage)
+	if err = DecodePacket(p.packet, comMsg); err != nil {
+		return
+	}
+	if p.Message, err = comMsg.Serialize(); err != nil {
+		return
+	}
+	return p.Message, nil
+}
+
+// Tap receives the copies of the messages of the components, Publish is
+// called on the way of the messages, so it should not block, the Message of
+// the events is empty until LoadMessage
+type Tap interface {
+	Publish(event *TapEvent)
+}
+
+type TapFunc func(event *TapEvent)
+
+func (p TapFunc) Publish(event *TapEvent) {
+	p(event)
+}
+
+var (
+	taps       = map[string]Tap{}
+	tapsLocker sync.Mutex
+)
+
+// RegisterTap registers the in-process tap, the components with the tap
+// option of name publish to it
+func RegisterTap(name string, tap Tap) {
+	if tap == nil {
+		panic("tap is nil")
+	}
+
+	tapsLocker.Lock()
+	defer tapsLocker.Unlock()
+
+	if _, exist := taps[name]; exist {
+		panic("tap of " + name + " already exist")
+	}
+	taps[name] = tap
+}
+
+// getTap is the registered tap of url, or the zmq PUB socket bound to it,
+// the components of the same url share it
+func getTap(url string) (tap Tap, err error) {
+	tapsLocker.Lock()
+	defer tapsLocker.Unlock()
+
+	if tap = taps[url]; tap != nil {
+		return
+	}
+
+	var zmqTap *ZMQTap
+	if zmqTap, err = NewZMQTap(url); err != nil {
+		return
+	}
+	taps[url] = zmqTap
+	return zmqTap, nil
+}
+
+// the names of the registered taps, or the urls of the zmq taps
+func checkTapUrl(url string) error {
+	tapsLocker.Lock()
+	_, exist := taps[url]
+	tapsLocker.Unlock()
+
+	if exist {
+		return nil
+	}
+	return checkZmqUrl(url)
+}
+
+// packet is the one comMsg is decoded from or encoded to, before it is
+// compressed, it is kept for LoadMessage
+func newTapEvent(component, in, direction string, comMsg *ComponentMessage, packet *Packet) (event *TapEvent) {
+	event = &TapEvent{
+		Component: component,
+		In:        in,
+		Direction: direction,
+		At:        time.Now(),
+		Id:        comMsg.Id,
+		packet:    packet}
+
+	if comMsg.Payload != nil {
+		event.Api = comMsg.Payload.Headers().Api
+		event.Code = comMsg.Payload.Code
+	}
+	return
+}
+
+// ZMQTap publishes the events to a zmq PUB socket, the topic is the name of
+// the component, so the subscribers could filter by the prefix of it
+//
+// the socket is bound, so a tap url is of one process, the components of it
+// share the url, the other processes need the urls of their own, and the
+// subscribers connect to all of them
+type ZMQTap struct {
+	url    string
+	events chan *TapEvent
+}
+
+// the socket is bound, the events are sent by a goroutine because the zmq
+// sockets are not thread safe
+func NewZMQTap(url string) (tap *ZMQTap, err error) {
+	var socket *zmq.Socket
+	if socket, err = zmq.NewSocket(zmq.PUB); err != nil {
+		err = errorcode.ERR_NEW_ZMQ_FAILED.New(errors.Params{"url": url, "type": "PUB", "err": err})
+		return
+	}
+
+	if err = socket.Bind(url); err != nil {
+		socket.Close()
+		err = errorcode.ERR_ZMQ_COULD_NOT_BIND_URL.New(errors.Params{"url": url, "type": "PUB", "err": err})
+		return
+	}
+
+	tap = &ZMQTap{url: url, events: make(chan *TapEvent, tapQueueSize)}
+	go tap.run(socket)
+
+	logs.Info("tap is publishing to:", url)
+	return
+}
+
+func (p *ZMQTap) Publish(event *TapEvent) {
+	select {
+	case p.events <- event:
+	default:
+		// nobody should be slowed by the tap
+	}
+}
+
+func (p *ZMQTap) run(socket *zmq.Socket) {
+	for event := range p.events {
+		if _, err := event.LoadMessage(); err != nil {
+			logs.Error(errorcode.ERR_TAP_FAILED.New(errors.Params{"url": p.url, "err": err}))
+			continue
+		}
+
+		data, err := json.Marshal(event)
+		if err != nil {
+			logs.Error(errorcode.ERR_JSON_MARSHAL_ERROR.New(errors.Params{"err": err}))
+			continue
+		}
+
+		if _, err = socket.SendMessage(event.Component, data); err != nil {
+			logs.Error(errorcode.ERR_TAP_FAILED.New(errors.Params{"url": p.url, "err": err}))
+		}
+	}
+}
+
+// tapper publishes the messages of a component, nil publishes nothing
+type tapper struct {
+	url       string
+	tap       Tap
+	component string
+	in        string
+}
+
+func newTapper(url string, meta ComponentMetadata) (p *tapper, err error) {
+	if strings.TrimSpace(url) == "" {
+		return
+	}
+
+	var tap Tap
+	if tap, err = getTap(url); err != nil {
+		return
+	}
+	return &tapper{url: url, tap: tap, component: meta.Name, in: meta.In}, nil
+}
+
+func (p *tapper) publish(direction string, to *ComponentMetadata, comMsg *ComponentMessage, packet *Packet) {
+	if p == nil {
+		return
+	}
+
+	event := newTapEvent(p.component, p.in, direction, comMsg, packet)
+	if to != nil {
+		event.To = to.In
+	}
+	p.tap.Publish(event)
+}
+
+func (p *tapper) tapUrl() string {
+	if p == nil {
+		return ""
+	}
+	return p.url
+}
@@ -0,0 +1,43 @@
+package casper
+
+import (
+	"testing"
+)
+
+func TestTapEventLoadMessage(t *testing.T) {
+	for _, codecName := range []string{"json", "msgpack", "protobuf"} {
+		comMsg, err := NewComponentMessage(nil, map[string]interface{}{"hello": "tap"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		packet, err := EncodePacket(codecName, comMsg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		event := newTapEvent("tap.a", "tcp://127.0.0.1:5001", TAP_SENT, comMsg, packet)
+		if event.Message != nil {
+			t.Fatalf("%s: the message is serialized while publishing", codecName)
+		}
+
+		message, err := event.LoadMessage()
+		if err != nil {
+			t.Fatalf("%s: %v", codecName, err)
+		}
+
+		loaded := new(ComponentMessage)
+		if err = loaded.FromJson(message); err != nil {
+			t.Fatalf("%s: %v", codecName, err)
+		} else if loaded.Id != comMsg.Id {
+			t.Fatalf("%s: the id of the message is %s, not %s", codecName, loaded.Id, comMsg.Id)
+		}
+
+		var result map[string]interface{}
+		if err = loaded.Payload.UnmarshalResult(&result); err != nil {
+			t.Fatalf("%s: %v", codecName, err)
+		} else if result["hello"] != "tap" {
+			t.Fatalf("%s: the result of the message is %v", codecName, result)
+		}
+	}
+}